@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 )
 
 // Config represents the global configuration for the extensions.
@@ -13,6 +15,9 @@ type Config struct {
 // TelemetryConfig holds tracing and monitoring settings.
 type TelemetryConfig struct {
 	Langfuse LangfuseConfig
+	OTLP     OTLPConfig
+	JSON     JSONExporterConfig
+	Policy   TracePolicyConfig
 }
 
 // LangfuseConfig specifically for Langfuse backend.
@@ -23,6 +28,41 @@ type LangfuseConfig struct {
 	Insecure  bool
 }
 
+// OTLPConfig for any OpenTelemetry collector reachable over OTLP.
+// Tracing is enabled when Endpoint is set.
+type OTLPConfig struct {
+	Endpoint    string            // host:port, or a full URL for HTTP
+	Protocol    string            // "grpc" (default) or "http"
+	Headers     map[string]string // e.g. authentication headers
+	Insecure    bool
+	ServiceName string
+}
+
+// JSONExporterConfig for writing spans as JSON lines, for local debugging.
+type JSONExporterConfig struct {
+	Path string // "" disables, "-" writes to stdout
+}
+
+// TracePolicyConfig limits what traced spans contain. It applies to every
+// backend.
+type TracePolicyConfig struct {
+	// SampleRate is the fraction of runs traced, decided at the root span.
+	// 0 is treated as 1 (trace everything).
+	SampleRate float64
+	// MaxAttributeLength truncates string attributes (0 = no limit);
+	// AttributeLimits overrides it per attribute key, and is the only limit
+	// applied to captured input/output attributes.
+	MaxAttributeLength int
+	AttributeLimits    map[string]int
+	// Redact lists extra regular expressions whose matches are replaced in
+	// attributes, events and error messages, on top of the built-in rules
+	// for API keys, tokens and home directory paths.
+	Redact []string
+	// CaptureIO records full prompts and outputs as observation input and
+	// output. They are still redacted, but never truncated.
+	CaptureIO bool
+}
+
 // LogConfig for logging settings.
 type LogConfig struct {
 	Level string // debug, info, warn, error
@@ -39,6 +79,22 @@ func LoadFromEnv() *Config {
 				Host:      getEnv("LANGFUSE_HOST", "localhost:3000"),
 				Insecure:  getEnv("LANGFUSE_INSECURE", "false") == "true",
 			},
+			OTLP: OTLPConfig{
+				Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+				Protocol:    getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc"),
+				Headers:     parseHeaders(getEnv("OTEL_EXPORTER_OTLP_HEADERS", "")),
+				Insecure:    getEnv("OTEL_EXPORTER_OTLP_INSECURE", "false") == "true",
+				ServiceName: getEnv("OTEL_SERVICE_NAME", "trpc-agent"),
+			},
+			JSON: JSONExporterConfig{
+				Path: getEnv("TELEMETRY_JSON_PATH", ""),
+			},
+			Policy: TracePolicyConfig{
+				SampleRate:         getEnvFloat("TELEMETRY_SAMPLE_RATE", 1),
+				MaxAttributeLength: getEnvInt("TELEMETRY_MAX_ATTRIBUTE_LENGTH", 4096),
+				Redact:             splitNonEmpty(getEnv("TELEMETRY_REDACT", ""), ";"),
+				CaptureIO:          getEnv("TELEMETRY_CAPTURE_IO", "false") == "true",
+			},
 		},
 		Log: LogConfig{
 			Level: getEnv("LOG_LEVEL", "info"),
@@ -46,6 +102,47 @@ func LoadFromEnv() *Config {
 	}
 }
 
+// parseHeaders parses "k1=v1,k2=v2" as used by OTEL_EXPORTER_OTLP_HEADERS.
+func parseHeaders(raw string) map[string]string {
+	if raw == "" {
+		return nil
+	}
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		headers[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return headers
+}
+
+// splitNonEmpty splits raw by sep, dropping empty items.
+func splitNonEmpty(raw, sep string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func getEnvInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(getEnv(key, "")); err == nil {
+		return n
+	}
+	return fallback
+}
+
+func getEnvFloat(key string, fallback float64) float64 {
+	if f, err := strconv.ParseFloat(getEnv(key, ""), 64); err == nil {
+		return f
+	}
+	return fallback
+}
+
 func getEnv(key, fallback string) string {
 	if value, ok := os.LookupEnv(key); ok {
 		return value
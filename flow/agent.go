@@ -26,6 +26,14 @@ func (b *AgentBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 	if len(steps) == 0 {
 		return nil, fmt.Errorf("no steps to build agent")
 	}
+	steps, err := applyRunWindow(steps, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	NewMiddlewareChain(opts.Middlewares...).BindFlow(pipeline.FlowInfo{
+		Mode:  pipeline.FlowAgent,
+		Exits: map[string]bool{"agent": true},
+	})
 
 	sg := graph.NewStateGraph(graph.MessagesStateSchema())
 
@@ -61,6 +69,7 @@ func (b *AgentBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 	if err != nil {
 		return nil, err
 	}
+	toolSets = scopeToolSets("agent", combinedToolSets, toolSets, opts)
 	if len(toolSets) > 0 {
 		nodeOpts = append(nodeOpts, graph.WithToolSets(toolSets))
 	}
@@ -72,14 +81,19 @@ func (b *AgentBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 	if preCb != nil {
 		nodeOpts = append(nodeOpts, graph.WithPreNodeCallback(preCb))
 	}
+	if modelCbs := chain.ModelCallbacks("agent", steps[0]); modelCbs != nil {
+		nodeOpts = append(nodeOpts, graph.WithModelCallbacks(modelCbs))
+	}
+	nodeOpts = append(nodeOpts, nodeErrorOptions("agent", steps[0], opts)...)
 
 	sg.AddLLMNode("agent", opts.Model, instruction, nil, nodeOpts...)
 
 	// Tools node
 	if len(toolSets) > 0 {
 		tid := "agent:tools"
-		toolsNode := graph.NewToolsNodeFunc(nil, graph.WithToolSets(toolSets))
-		sg.AddNode(tid, toolsNode, graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool))
+		toolsNode := graph.NewToolsNodeFunc(nil, toolsNodeOptions("agent", steps[0], toolSets, opts)...)
+		toolsOpts := append([]graph.Option{graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool)}, nodeErrorOptions("agent", steps[0], opts)...)
+		sg.AddNode(tid, toolsNode, toolsOpts...)
 		sg.AddToolsConditionalEdges("agent", tid, graph.End)
 		sg.AddEdge(tid, "agent")
 	} else {
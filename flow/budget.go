@@ -0,0 +1,398 @@
+package flow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/token"
+
+	"trpc.group/trpc-go/trpc-agent-go/graph"
+	"trpc.group/trpc-go/trpc-agent-go/model"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+const (
+	// StateKeyBudgetExceeded holds the spend of the budget a step exceeded.
+	// The step's confirm node interrupts in block mode while it is set.
+	StateKeyBudgetExceeded = "pipeline_budget_exceeded"
+	// StateKeyBudgetApproved holds the budget scopes the user allowed to
+	// overrun by resuming a budget interrupt.
+	StateKeyBudgetApproved = "pipeline_budget_approved"
+
+	// BudgetScopeRun is the scope of the run-wide budget. Step budgets use
+	// "step:<id>".
+	BudgetScopeRun = "run"
+
+	defaultDegradeAt       = 0.8
+	defaultToolOutputLimit = 4000
+)
+
+// BudgetLimit caps the tokens and estimated cost of a scope. Zero fields are
+// unlimited.
+type BudgetLimit struct {
+	Tokens int
+	Cost   float64
+}
+
+// BudgetConfig configures a BudgetMiddleware.
+type BudgetConfig struct {
+	Run   BudgetLimit            // whole run
+	Step  BudgetLimit            // default for every step
+	Steps map[string]BudgetLimit // per-step overrides of Step
+	// DegradeAt is the fraction of a limit at which degradation starts
+	// (default 0.8).
+	DegradeAt float64
+	Pricing   token.Pricing // used to estimate cost; cost limits need it
+}
+
+// BudgetOption configures optional degradation behavior.
+type BudgetOption func(*BudgetMiddleware)
+
+// WithBudgetCompressor compresses the request history of every LLM call made
+// while degraded. The compressed prefix is reused for later calls of the step.
+func WithBudgetCompressor(c memory.ForceCompressor) BudgetOption {
+	return func(m *BudgetMiddleware) { m.compressor = c }
+}
+
+// WithCheaperModel answers LLM calls made while degraded with m instead of
+// the step's model.
+func WithCheaperModel(cheaper model.Model) BudgetOption {
+	return func(m *BudgetMiddleware) { m.cheaper = cheaper }
+}
+
+// WithToolOutputLimit sets the size in bytes tool results are trimmed to
+// while degraded (default 4000).
+func WithToolOutputLimit(n int) BudgetOption {
+	return func(m *BudgetMiddleware) { m.toolOutputLimit = n }
+}
+
+// BudgetMiddleware implements pipeline.CallbackMiddleware and
+// pipeline.FlowMiddleware.
+// It accounts the tokens and estimated cost of every LLM call per step and
+// per run, and enforces BudgetConfig limits:
+//
+//   - Once a limit reaches DegradeAt, LLM calls are degraded: the history is
+//     compressed, a cheaper model answers and tool results are trimmed,
+//     depending on the options given.
+//   - Once a limit is reached, the step's next LLM call is skipped and its
+//     confirm node interrupts in block mode with the spend. Resuming the
+//     interrupt accepts the overrun of that budget and re-enters the step.
+//     Agent mode has no confirm node; the run fails with *BudgetExceededError.
+//
+// A BudgetMiddleware accounts one run at a time; call Reset before the next.
+type BudgetMiddleware struct {
+	cfg             BudgetConfig
+	usage           *token.Monitor
+	compressor      memory.ForceCompressor
+	cheaper         model.Model
+	toolOutputLimit int
+
+	mu         sync.Mutex
+	compressed map[string]compressedHistory // per step
+	mode       pipeline.FlowMode            // from BindFlow
+}
+
+// compressedHistory is the compressed form of the first srcLen messages of a
+// step's history, whose hash is srcHash.
+type compressedHistory struct {
+	srcLen  int
+	srcHash [sha256.Size]byte
+	msgs    []model.Message
+}
+
+// NewBudgetMiddleware creates a budget middleware.
+func NewBudgetMiddleware(cfg BudgetConfig, opts ...BudgetOption) *BudgetMiddleware {
+	if cfg.DegradeAt <= 0 || cfg.DegradeAt >= 1 {
+		cfg.DegradeAt = defaultDegradeAt
+	}
+	m := &BudgetMiddleware{
+		cfg:             cfg,
+		usage:           token.NewMonitor(0, token.WithPricing(cfg.Pricing)),
+		toolOutputLimit: defaultToolOutputLimit,
+		compressed:      make(map[string]compressedHistory),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Usage returns the monitor the middleware accounts into, e.g. for reports.
+func (m *BudgetMiddleware) Usage() *token.Monitor {
+	return m.usage
+}
+
+// Reset clears the accounted spend for a new run.
+func (m *BudgetMiddleware) Reset() {
+	m.usage.Reset()
+	m.mu.Lock()
+	m.compressed = make(map[string]compressedHistory)
+	m.mu.Unlock()
+}
+
+// BudgetStatus is the state of the budget closest to its limit.
+type BudgetStatus struct {
+	Scope string
+	Limit BudgetLimit
+	Spent token.UsageAggregate
+	Ratio float64 // highest of tokens and cost spent relative to the limit
+}
+
+// Exceeded reports whether the limit is reached.
+func (s BudgetStatus) Exceeded() bool {
+	return s.Ratio >= 1
+}
+
+// BudgetExceededError is returned when a budget is exceeded in a flow without
+// confirm nodes.
+type BudgetExceededError struct {
+	StepID string
+	Status BudgetStatus
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget %s exceeded at step %s: %s", e.Status.Scope, e.StepID, spendSummary(e.Status))
+}
+
+// Status returns the budget of stepID closest to its limit, ignoring scopes
+// in skip.
+func (m *BudgetMiddleware) Status(stepID string, skip map[string]any) BudgetStatus {
+	var worst BudgetStatus
+	consider := func(scope string, limit BudgetLimit, spent token.UsageAggregate) {
+		if _, ok := skip[scope]; ok {
+			return
+		}
+		ratio := 0.0
+		if limit.Tokens > 0 {
+			ratio = float64(spent.TotalTokens) / float64(limit.Tokens)
+		}
+		if limit.Cost > 0 {
+			ratio = max(ratio, spent.Cost/limit.Cost)
+		}
+		if ratio > worst.Ratio || worst.Scope == "" {
+			worst = BudgetStatus{Scope: scope, Limit: limit, Spent: spent, Ratio: ratio}
+		}
+	}
+	consider("step:"+stepID, m.stepLimit(stepID), m.usage.StepUsage(stepID))
+	consider(BudgetScopeRun, m.cfg.Run, m.usage.Total())
+	return worst
+}
+
+func (m *BudgetMiddleware) stepLimit(stepID string) BudgetLimit {
+	if limit, ok := m.cfg.Steps[stepID]; ok {
+		return limit
+	}
+	return m.cfg.Step
+}
+
+func (m *BudgetMiddleware) degraded(stepID string) bool {
+	return m.Status(stepID, nil).Ratio >= m.cfg.DegradeAt
+}
+
+// WrapPreNode returns a callback that skips the step's LLM call once a budget
+// not yet approved by the user is exceeded, handing the spend to the confirm
+// node.
+func (m *BudgetMiddleware) WrapPreNode(stepID string, _ *pipeline.StepDefinition) graph.BeforeNodeCallback {
+	return func(_ context.Context, _ *graph.NodeCallbackContext, state graph.State) (any, error) {
+		approved, _ := state[StateKeyBudgetApproved].(map[string]any)
+		status := m.Status(stepID, approved)
+		if !status.Exceeded() {
+			return nil, nil
+		}
+
+		logger.L().Warn("Budget exceeded, pausing step",
+			"step", stepID, "scope", status.Scope, "spend", spendSummary(status))
+		if m.flowMode() == pipeline.FlowAgent {
+			return nil, &BudgetExceededError{StepID: stepID, Status: status}
+		}
+		return graph.State{
+			StateKeyBudgetExceeded:    budgetState(status),
+			StateKeyPipelineErrorCode: "",
+		}, nil
+	}
+}
+
+// WrapPostNode returns nil (the confirm node handles budget interrupts).
+func (m *BudgetMiddleware) WrapPostNode(_ string, _ *pipeline.StepDefinition) graph.AfterNodeCallback {
+	return nil
+}
+
+// BindFlow records the mode of the built flow: agent flows have no confirm
+// node to pause in, so exceeding a budget fails the run.
+func (m *BudgetMiddleware) BindFlow(info pipeline.FlowInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = info.Mode
+}
+
+// NodeErrorCallback returns nil (node errors do not affect budgets).
+func (m *BudgetMiddleware) NodeErrorCallback(_ string, _ *pipeline.StepDefinition) graph.OnNodeErrorCallback {
+	return nil
+}
+
+func (m *BudgetMiddleware) flowMode() pipeline.FlowMode {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode
+}
+
+// ModelCallbacks returns callbacks that account each LLM call and, while
+// degraded, compress the request history and answer with the cheaper model.
+func (m *BudgetMiddleware) ModelCallbacks(stepID string, _ *pipeline.StepDefinition) *model.Callbacks {
+	cbs := model.NewCallbacks()
+	cbs.RegisterBeforeModel(func(ctx context.Context, args *model.BeforeModelArgs) (*model.BeforeModelResult, error) {
+		if args.Request == nil || !m.degraded(stepID) {
+			return nil, nil
+		}
+		if m.compressor != nil {
+			args.Request.Messages = m.compressHistory(ctx, stepID, args.Request.Messages)
+		}
+		if m.cheaper == nil {
+			return nil, nil
+		}
+		rsp, err := generateFinal(ctx, m.cheaper, args.Request)
+		if err != nil {
+			logger.L().Warn("Cheaper model failed, using step model", "step", stepID, "error", err)
+			return nil, nil
+		}
+		// Keep the context of earlier callbacks (e.g. tracing spans).
+		return &model.BeforeModelResult{Context: ctx, CustomResponse: rsp}, nil
+	})
+	cbs.RegisterAfterModel(func(_ context.Context, args *model.AfterModelArgs) (*model.AfterModelResult, error) {
+		rsp := args.Response
+		if rsp == nil || rsp.IsPartial || rsp.Usage == nil {
+			return nil, nil
+		}
+		m.usage.RecordUsage(token.TokenUsage{
+			StepID:           stepID,
+			NodeType:         string(graph.NodeTypeLLM),
+			Model:            rsp.Model,
+			PromptTokens:     rsp.Usage.PromptTokens,
+			CompletionTokens: rsp.Usage.CompletionTokens,
+			TotalTokens:      rsp.Usage.TotalTokens,
+			Timestamp:        time.Now(),
+		})
+		return nil, nil
+	})
+	return cbs
+}
+
+// ToolCallbacks returns callbacks that trim tool results while degraded.
+func (m *BudgetMiddleware) ToolCallbacks(stepID string, _ *pipeline.StepDefinition) *tool.Callbacks {
+	if m.toolOutputLimit <= 0 {
+		return nil
+	}
+	cbs := tool.NewCallbacks()
+	cbs.RegisterAfterTool(func(_ context.Context, args *tool.AfterToolArgs) (*tool.AfterToolResult, error) {
+		if args.Error != nil || args.Result == nil || !m.degraded(stepID) {
+			return nil, nil
+		}
+		out, ok := args.Result.(string)
+		if !ok {
+			b, err := json.Marshal(args.Result)
+			if err != nil {
+				return nil, nil
+			}
+			out = string(b)
+		}
+		if len(out) <= m.toolOutputLimit {
+			return nil, nil
+		}
+		cut := m.toolOutputLimit
+		for cut > 0 && !utf8.RuneStart(out[cut]) {
+			cut--
+		}
+		trimmed := fmt.Sprintf("%s\n...(已截断 %d 字节以节省预算)", out[:cut], len(out)-cut)
+		return &tool.AfterToolResult{CustomResult: trimmed}, nil
+	})
+	return cbs
+}
+
+// compressHistory replaces msgs with their compressed form. While the step's
+// history only grows, later calls reuse the compressed prefix instead of
+// summarizing again; a history whose earlier messages were rewritten (e.g. by
+// another middleware) is compressed anew.
+func (m *BudgetMiddleware) compressHistory(ctx context.Context, stepID string, msgs []model.Message) []model.Message {
+	m.mu.Lock()
+	prev, ok := m.compressed[stepID]
+	m.mu.Unlock()
+	if ok && prev.srcLen <= len(msgs) && historyHash(msgs[:prev.srcLen]) == prev.srcHash {
+		return append(append([]model.Message(nil), prev.msgs...), msgs[prev.srcLen:]...)
+	}
+
+	compressed, err := m.compressor.Compress(ctx, msgs)
+	if err != nil {
+		logger.L().Warn("Budget compression failed", "step", stepID, "error", err)
+		return msgs
+	}
+	m.mu.Lock()
+	m.compressed[stepID] = compressedHistory{srcLen: len(msgs), srcHash: historyHash(msgs), msgs: compressed}
+	m.mu.Unlock()
+	return compressed
+}
+
+// historyHash returns the hash of msgs' JSON encoding.
+func historyHash(msgs []model.Message) [sha256.Size]byte {
+	data, _ := json.Marshal(msgs)
+	return sha256.Sum256(data)
+}
+
+// generateFinal calls llm and returns its final (non-partial) response.
+func generateFinal(ctx context.Context, llm model.Model, req *model.Request) (*model.Response, error) {
+	ch, err := llm.GenerateContent(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var final *model.Response
+	for rsp := range ch {
+		if rsp.Error != nil {
+			return nil, responseError{rsp.Error}
+		}
+		if !rsp.IsPartial {
+			final = rsp
+		}
+	}
+	if final == nil {
+		return nil, fmt.Errorf("model %s returned no final response", llm.Info().Name)
+	}
+	return final, nil
+}
+
+// budgetState encodes a status for graph state. Plain maps survive
+// checkpoint serialization.
+func budgetState(s BudgetStatus) map[string]any {
+	return map[string]any{
+		"scope":       s.Scope,
+		"tokens":      s.Spent.TotalTokens,
+		"cost":        s.Spent.Cost,
+		"limitTokens": s.Limit.Tokens,
+		"limitCost":   s.Limit.Cost,
+	}
+}
+
+// spendSummary formats the spend of a status against its limit.
+func spendSummary(s BudgetStatus) string {
+	out := fmt.Sprintf("%d tokens", s.Spent.TotalTokens)
+	if s.Limit.Tokens > 0 {
+		out += fmt.Sprintf(" / %d", s.Limit.Tokens)
+	}
+	out += fmt.Sprintf(", cost %.4f", s.Spent.Cost)
+	if s.Limit.Cost > 0 {
+		out += fmt.Sprintf(" / %.4f", s.Limit.Cost)
+	}
+	return out
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ pipeline.CallbackMiddleware = (*BudgetMiddleware)(nil)
+	_ pipeline.FlowMiddleware     = (*BudgetMiddleware)(nil)
+)
@@ -0,0 +1,188 @@
+package flow
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/token"
+
+	"trpc.group/trpc-go/trpc-agent-go/graph"
+	"trpc.group/trpc-go/trpc-agent-go/model"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// replyModel streams a partial chunk and then a final reply.
+type replyModel struct {
+	name  string
+	calls int
+}
+
+func (r *replyModel) GenerateContent(_ context.Context, _ *model.Request) (<-chan *model.Response, error) {
+	r.calls++
+	ch := make(chan *model.Response, 2)
+	ch <- &model.Response{IsPartial: true}
+	ch <- &model.Response{Model: r.name, Choices: []model.Choice{{Message: model.NewAssistantMessage("done")}}}
+	close(ch)
+	return ch, nil
+}
+
+func (r *replyModel) Info() model.Info {
+	return model.Info{Name: r.name}
+}
+
+// countingCompressor keeps the last message and counts its calls.
+type countingCompressor struct {
+	calls int
+}
+
+func (c *countingCompressor) Compress(_ context.Context, msgs []model.Message) ([]model.Message, error) {
+	c.calls++
+	return []model.Message{model.NewSystemMessage("summary"), msgs[len(msgs)-1]}, nil
+}
+
+type budgetTestKey struct{}
+
+func recordSpend(t *testing.T, cbs *model.Callbacks, tokens int) {
+	t.Helper()
+	rsp := &model.Response{Model: "gpt-4o", Usage: &model.Usage{PromptTokens: tokens, TotalTokens: tokens}}
+	if _, err := cbs.RunAfterModel(context.Background(), &model.AfterModelArgs{Response: rsp}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBudgetMiddleware_DegradesNearLimit(t *testing.T) {
+	cheaper := &replyModel{name: "gpt-4o-mini"}
+	compressor := &countingCompressor{}
+	mw := NewBudgetMiddleware(BudgetConfig{
+		Step:      BudgetLimit{Tokens: 1000},
+		DegradeAt: 0.5,
+		Pricing:   token.Pricing{"gpt-4o": {InputPerMillion: 2.5}},
+	}, WithCheaperModel(cheaper), WithBudgetCompressor(compressor), WithToolOutputLimit(8))
+	step := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1"}}
+	modelCbs, toolCbs := mw.ModelCallbacks("1.1", step), mw.ToolCallbacks("1.1", step)
+
+	req := &model.Request{Messages: []model.Message{model.NewUserMessage("a"), model.NewUserMessage("b")}}
+	before, err := modelCbs.RunBeforeModel(context.Background(), &model.BeforeModelArgs{Request: req})
+	if err != nil || (before != nil && before.CustomResponse != nil) {
+		t.Fatalf("should not degrade below threshold: %+v, %v", before, err)
+	}
+
+	recordSpend(t, modelCbs, 600)
+	if got := mw.Usage().UsageByStep()["1.1"]; got.TotalTokens != 600 || got.Cost == 0 {
+		t.Fatalf("usage not accounted: %+v", got)
+	}
+
+	ctx := context.WithValue(context.Background(), budgetTestKey{}, "kept")
+	before, err = modelCbs.RunBeforeModel(ctx, &model.BeforeModelArgs{Request: req})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before.CustomResponse == nil || before.CustomResponse.Model != "gpt-4o-mini" {
+		t.Fatalf("expected cheaper model response, got %+v", before.CustomResponse)
+	}
+	if before.Context.Value(budgetTestKey{}) != "kept" {
+		t.Error("context of earlier callbacks lost")
+	}
+	if len(req.Messages) != 2 || req.Messages[0].Content != "summary" {
+		t.Errorf("request history not compressed: %+v", req.Messages)
+	}
+
+	// Later calls reuse the compressed prefix.
+	req.Messages = []model.Message{model.NewUserMessage("a"), model.NewUserMessage("b"), model.NewUserMessage("c")}
+	if _, err := modelCbs.RunBeforeModel(ctx, &model.BeforeModelArgs{Request: req}); err != nil {
+		t.Fatal(err)
+	}
+	if compressor.calls != 1 || len(req.Messages) != 3 || req.Messages[2].Content != "c" {
+		t.Errorf("expected compressed prefix reuse, calls=%d msgs=%+v", compressor.calls, req.Messages)
+	}
+
+	// A history whose earlier messages changed is compressed again.
+	req.Messages = []model.Message{model.NewSystemMessage("new prompt"), model.NewUserMessage("b"), model.NewUserMessage("d")}
+	if _, err := modelCbs.RunBeforeModel(ctx, &model.BeforeModelArgs{Request: req}); err != nil {
+		t.Fatal(err)
+	}
+	if compressor.calls != 2 || len(req.Messages) != 2 || req.Messages[1].Content != "d" {
+		t.Errorf("expected recompression of a rewritten history, calls=%d msgs=%+v", compressor.calls, req.Messages)
+	}
+
+	after, err := toolCbs.RunAfterTool(context.Background(), &tool.AfterToolArgs{Result: "0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := after.CustomResult.(string); !strings.HasPrefix(out, "01234567\n") {
+		t.Errorf("tool output not trimmed: %q", out)
+	}
+}
+
+func TestBudgetMiddleware_BlocksWhenExceeded(t *testing.T) {
+	mw := NewBudgetMiddleware(BudgetConfig{Run: BudgetLimit{Tokens: 1000}})
+	step := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1"}}
+	pre := mw.WrapPreNode("1.1", step)
+
+	if result, err := pre(context.Background(), nil, graph.State{}); result != nil || err != nil {
+		t.Fatalf("should pass under budget: %v, %v", result, err)
+	}
+	recordSpend(t, mw.ModelCallbacks("1.1", step), 1200)
+
+	result, err := pre(context.Background(), nil, graph.State{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, _ := result.(graph.State)
+	spend, _ := st[StateKeyBudgetExceeded].(map[string]any)
+	if spend["scope"] != BudgetScopeRun || spend["tokens"] != 1200 || spend["limitTokens"] != 1000 {
+		t.Fatalf("expected run budget spend in state, got %v", result)
+	}
+
+	approved := graph.State{StateKeyBudgetApproved: map[string]any{BudgetScopeRun: true}}
+	if result, err := pre(context.Background(), nil, approved); result != nil || err != nil {
+		t.Fatalf("approved overrun should pass: %v, %v", result, err)
+	}
+
+	// Agent mode is taken from the bound flow, not from the step ID.
+	if _, err := mw.WrapPreNode("agent", step)(context.Background(), nil, graph.State{}); err != nil {
+		t.Fatalf("unbound middleware should pause, got %v", err)
+	}
+	mw.BindFlow(pipeline.FlowInfo{Mode: pipeline.FlowAgent})
+	var exceeded *BudgetExceededError
+	if _, err := mw.WrapPreNode("agent", step)(context.Background(), nil, graph.State{}); !errors.As(err, &exceeded) {
+		t.Fatalf("agent mode should fail with BudgetExceededError, got %v", err)
+	}
+
+	mw.Reset()
+	if result, _ := pre(context.Background(), nil, graph.State{}); result != nil {
+		t.Fatal("reset should clear the spend")
+	}
+}
+
+func TestConfirmNode_BudgetInterrupt(t *testing.T) {
+	node := makeConfirmNode("1.1", pipeline.AdvanceAuto)
+	spend := map[string]any{"scope": "step:1.1", "tokens": 1200, "cost": 0.5}
+
+	_, err := node(context.Background(), graph.State{StateKeyBudgetExceeded: spend})
+	interrupt, ok := graph.GetInterruptError(err)
+	if !ok {
+		t.Fatalf("expected interrupt, got %v", err)
+	}
+	prompt, _ := interrupt.Value.(map[string]any)
+	if prompt["advance"] != string(pipeline.AdvanceBlock) || !strings.Contains(prompt["message"].(string), "1200") {
+		t.Errorf("unexpected interrupt prompt: %v", prompt)
+	}
+
+	resumed := graph.State{StateKeyBudgetExceeded: spend, graph.ResumeChannel: "continue"}
+	result, err := node(context.Background(), resumed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, ok := result.(*graph.Command)
+	if !ok || cmd.GoTo != "1.1" {
+		t.Fatalf("expected to re-enter the step, got %+v", result)
+	}
+	approved, _ := cmd.Update[StateKeyBudgetApproved].(map[string]any)
+	if approved["step:1.1"] != true || len(cmd.Update[StateKeyBudgetExceeded].(map[string]any)) != 0 {
+		t.Errorf("unexpected update: %v", cmd.Update)
+	}
+}
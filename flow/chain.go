@@ -25,6 +25,14 @@ func (b *ChainBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 	if len(steps) == 0 {
 		return nil, fmt.Errorf("no steps to build chain")
 	}
+	steps, err := applyRunWindow(steps, opts, true)
+	if err != nil {
+		return nil, err
+	}
+	NewMiddlewareChain(opts.Middlewares...).BindFlow(pipeline.FlowInfo{
+		Mode:  pipeline.FlowChain,
+		Exits: map[string]bool{steps[len(steps)-1].Frontmatter.Step: true},
+	})
 
 	sg := graph.NewStateGraph(graph.MessagesStateSchema())
 
@@ -63,11 +71,16 @@ func (b *ChainBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 		if preCb != nil {
 			nodeOpts = append(nodeOpts, graph.WithPreNodeCallback(preCb))
 		}
+		if modelCbs := chain.ModelCallbacks(stepID, step); modelCbs != nil {
+			nodeOpts = append(nodeOpts, graph.WithModelCallbacks(modelCbs))
+		}
+		nodeOpts = append(nodeOpts, nodeErrorOptions(stepID, step, opts)...)
 
 		toolSets, err := resolveToolSets(step.Frontmatter.EffectiveTools(), opts.ToolSets, opts.AllowMissing)
 		if err != nil {
 			return nil, err
 		}
+		toolSets = scopeToolSets(stepID, step.Frontmatter.EffectiveTools(), toolSets, opts)
 		if len(toolSets) > 0 {
 			nodeOpts = append(nodeOpts, graph.WithToolSets(toolSets))
 		}
@@ -77,7 +90,7 @@ func (b *ChainBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 		// Confirm node
 		cid := confirmNodeID(stepID)
 		confirmNode := makeConfirmNode(stepID, step.Frontmatter.Advance)
-		confirmOpts := []graph.Option{graph.WithName(cid)}
+		confirmOpts := append([]graph.Option{graph.WithName(cid)}, nodeErrorOptions(stepID, step, opts)...)
 
 		postCb := chain.WrapPostNode(stepID, step)
 		if postCb != nil {
@@ -89,8 +102,9 @@ func (b *ChainBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 		// Tools node (if needed)
 		if len(toolSets) > 0 {
 			tid := toolsNodeID(stepID)
-			toolsNode := wrapToolsNode(graph.NewToolsNodeFunc(nil, graph.WithToolSets(toolSets)))
-			sg.AddNode(tid, toolsNode, graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool))
+			toolsNode := wrapToolsNode(graph.NewToolsNodeFunc(nil, toolsNodeOptions(stepID, step, toolSets, opts)...))
+			toolsOpts := append([]graph.Option{graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool)}, nodeErrorOptions(stepID, step, opts)...)
+			sg.AddNode(tid, toolsNode, toolsOpts...)
 		}
 	}
 
@@ -26,6 +26,11 @@ func (b *GraphBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 	if len(steps) == 0 {
 		return nil, fmt.Errorf("no steps to build graph")
 	}
+	steps, err := applyRunWindow(steps, opts, false)
+	if err != nil {
+		return nil, err
+	}
+	NewMiddlewareChain(opts.Middlewares...).BindFlow(pipeline.FlowInfo{Mode: pipeline.FlowGraph, Exits: graphExits(steps)})
 
 	sg := graph.NewStateGraph(graph.MessagesStateSchema())
 
@@ -52,6 +57,7 @@ func (b *GraphBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 		if err != nil {
 			return nil, err
 		}
+		toolSets = scopeToolSets(stepID, step.Frontmatter.EffectiveTools(), toolSets, opts)
 		stepTools[stepID] = toolSets
 		if len(toolSets) > 0 {
 			nodeOpts = append(nodeOpts, graph.WithToolSets(toolSets))
@@ -63,8 +69,9 @@ func (b *GraphBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 
 		if len(toolSets) > 0 {
 			tid := toolsNodeID(stepID)
-			toolsNode := wrapToolsNode(graph.NewToolsNodeFunc(nil, graph.WithToolSets(toolSets)))
-			sg.AddNode(tid, toolsNode, graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool))
+			toolsNode := wrapToolsNode(graph.NewToolsNodeFunc(nil, toolsNodeOptions(stepID, step, toolSets, opts)...))
+			toolsOpts := append([]graph.Option{graph.WithName(tid), graph.WithNodeType(graph.NodeTypeTool)}, nodeErrorOptions(stepID, step, opts)...)
+			sg.AddNode(tid, toolsNode, toolsOpts...)
 		}
 	}
 
@@ -82,9 +89,13 @@ func (b *GraphBuilder) Build(steps []*pipeline.StepDefinition, opts pipeline.Flo
 
 // buildLLMNodeOptions constructs the instruction and graph options for an LLM node.
 func (b *GraphBuilder) buildLLMNodeOptions(step *pipeline.StepDefinition, stepID string, opts pipeline.FlowOptions) (string, []graph.Option, error) {
+	assembler, err := stepAssembler(opts)
+	if err != nil {
+		return "", nil, err
+	}
 	var instruction string
-	if opts.Assembler != nil {
-		built, err := opts.Assembler.BuildStatic(step, opts.BaseVars)
+	if assembler != nil {
+		built, err := assembler.BuildStatic(step, opts.BaseVars)
 		if err != nil {
 			return "", nil, fmt.Errorf("build instruction for %s: %w", stepID, err)
 		}
@@ -120,8 +131,12 @@ func (b *GraphBuilder) buildLLMNodeOptions(step *pipeline.StepDefinition, stepID
 	if preCb != nil {
 		nodeOpts = append(nodeOpts, graph.WithPreNodeCallback(preCb))
 	}
+	if modelCbs := chain.ModelCallbacks(stepID, step); modelCbs != nil {
+		nodeOpts = append(nodeOpts, graph.WithModelCallbacks(modelCbs))
+	}
 
 	nodeOpts = append(nodeOpts, graph.WithPostNodeCallback(clearPipelineErrorCode))
+	nodeOpts = append(nodeOpts, nodeErrorOptions(stepID, step, opts)...)
 
 	return instruction, nodeOpts, nil
 }
@@ -130,7 +145,7 @@ func (b *GraphBuilder) buildLLMNodeOptions(step *pipeline.StepDefinition, stepID
 func (b *GraphBuilder) addConfirmNode(sg *graph.StateGraph, step *pipeline.StepDefinition, stepID string, opts pipeline.FlowOptions) {
 	cid := confirmNodeID(stepID)
 	confirmNode := makeConfirmNode(stepID, step.Frontmatter.Advance)
-	confirmOpts := []graph.Option{graph.WithName(cid)}
+	confirmOpts := append([]graph.Option{graph.WithName(cid)}, nodeErrorOptions(stepID, step, opts)...)
 
 	// Middleware post-node callbacks for artifact recording
 	chain := NewMiddlewareChain(opts.Middlewares...)
@@ -179,6 +194,18 @@ func (b *GraphBuilder) addEdges(sg *graph.StateGraph, step *pipeline.StepDefinit
 	}
 }
 
+// graphExits returns the steps after which the graph ends: steps without
+// next, and the finish step.
+func graphExits(steps []*pipeline.StepDefinition) map[string]bool {
+	exits := map[string]bool{steps[len(steps)-1].Frontmatter.Step: true}
+	for _, s := range steps {
+		if s.Frontmatter.Next == "" {
+			exits[s.Frontmatter.Step] = true
+		}
+	}
+	return exits
+}
+
 // setEntryAndFinish sets the graph entry and finish points.
 func (b *GraphBuilder) setEntryAndFinish(sg *graph.StateGraph, steps []*pipeline.StepDefinition) {
 	entryID := steps[0].Frontmatter.Step
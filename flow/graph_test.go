@@ -2,9 +2,12 @@ package flow
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"testing/fstest"
 
 	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/prompt"
 
 	"trpc.group/trpc-go/trpc-agent-go/model"
 	"trpc.group/trpc-go/trpc-agent-go/tool"
@@ -130,3 +133,73 @@ func TestGraphBuilder_DuplicateStep(t *testing.T) {
 		t.Fatal("expected error for duplicate step")
 	}
 }
+
+type recordingScope struct {
+	steps []string
+	names []string
+}
+
+func (r *recordingScope) ScopeToolSets(stepID string, names []string, toolSets []tool.ToolSet) []tool.ToolSet {
+	r.steps = append(r.steps, stepID)
+	r.names = append(r.names, names...)
+	return toolSets
+}
+
+func TestGraphBuilder_ToolScope(t *testing.T) {
+	steps := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Advance: pipeline.AdvanceAuto, Next: "3.1"}},
+		{Frontmatter: pipeline.Frontmatter{Step: "3.1", Tools: []string{"eda"}, Advance: pipeline.AdvanceAuto}},
+	}
+	scope := &recordingScope{}
+	_, err := NewGraphBuilder().Build(steps, pipeline.FlowOptions{
+		Model:     stubModel{},
+		ToolSets:  map[string]tool.ToolSet{"eda": stubToolSet{name: "eda"}},
+		ToolScope: scope,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(scope.steps) != 1 || scope.steps[0] != "3.1" {
+		t.Errorf("expected only step 3.1 to be scoped, got %v", scope.steps)
+	}
+	if len(scope.names) != 1 || scope.names[0] != "eda" {
+		t.Errorf("expected tool set names [eda], got %v", scope.names)
+	}
+}
+
+// plainAssembler is a PromptAssembler without strict mode.
+type plainAssembler struct{}
+
+func (plainAssembler) BuildStatic(step *pipeline.StepDefinition, _ map[string]string) (string, error) {
+	return step.Body, nil
+}
+
+func (plainAssembler) BuildDynamic(_ context.Context, step *pipeline.StepDefinition, _ map[string]string) (string, error) {
+	return step.Body, nil
+}
+
+func (plainAssembler) HasDynamicContent() bool { return false }
+
+func TestGraphBuilder_StrictTemplates(t *testing.T) {
+	steps := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Advance: pipeline.AdvanceAuto}, Body: "Write {{undefined_var}}."},
+	}
+	assembler := prompt.NewAssembler("core.md", "", workspaceFS{fstest.MapFS{}}, nil)
+	opts := pipeline.FlowOptions{Model: stubModel{}, Assembler: assembler}
+
+	if _, err := NewGraphBuilder().Build(steps, opts); err != nil {
+		t.Fatalf("non-strict build: %v", err)
+	}
+	opts.StrictTemplates = true
+	if _, err := NewGraphBuilder().Build(steps, opts); err == nil || !strings.Contains(err.Error(), "undefined_var") {
+		t.Fatalf("expected undefined variable error, got %v", err)
+	}
+	if _, err := assembler.BuildStatic(steps[0], nil); err != nil {
+		t.Fatalf("strict build must not change the caller's assembler: %v", err)
+	}
+
+	opts.Assembler = plainAssembler{}
+	if _, err := NewGraphBuilder().Build(steps, opts); err == nil {
+		t.Fatal("expected error for an assembler without strict mode")
+	}
+}
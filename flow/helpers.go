@@ -33,6 +33,53 @@ func resolveToolSets(names []string, available map[string]tool.ToolSet, allowMis
 	return result, nil
 }
 
+// scopeToolSets applies opts.ToolScope to the tool sets resolveToolSets
+// returned for names.
+func scopeToolSets(stepID string, names []string, toolSets []tool.ToolSet, opts pipeline.FlowOptions) []tool.ToolSet {
+	if opts.ToolScope == nil || len(toolSets) == 0 {
+		return toolSets
+	}
+	var resolved []string
+	for _, name := range names {
+		if opts.ToolSets[name] != nil {
+			resolved = append(resolved, name)
+		}
+	}
+	return opts.ToolScope.ScopeToolSets(stepID, resolved, toolSets)
+}
+
+// stepAssembler returns opts.Assembler, made strict when opts.StrictTemplates
+// is set.
+func stepAssembler(opts pipeline.FlowOptions) (pipeline.PromptAssembler, error) {
+	if !opts.StrictTemplates || opts.Assembler == nil {
+		return opts.Assembler, nil
+	}
+	strict, ok := opts.Assembler.(pipeline.StrictAssembler)
+	if !ok {
+		return nil, fmt.Errorf("strict templates: assembler %T does not support strict mode", opts.Assembler)
+	}
+	return strict.StrictTemplates(), nil
+}
+
+// toolsNodeOptions returns the options of a step's tools node, including the
+// tool callbacks of opts.Middlewares.
+func toolsNodeOptions(stepID string, step *pipeline.StepDefinition, toolSets []tool.ToolSet, opts pipeline.FlowOptions) []graph.Option {
+	nodeOpts := []graph.Option{graph.WithToolSets(toolSets)}
+	if cbs := NewMiddlewareChain(opts.Middlewares...).ToolCallbacks(stepID, step); cbs != nil {
+		nodeOpts = append(nodeOpts, graph.WithToolCallbacks(cbs))
+	}
+	return nodeOpts
+}
+
+// nodeErrorOptions returns the options attaching the middleware error
+// callback of a step to one of its nodes.
+func nodeErrorOptions(stepID string, step *pipeline.StepDefinition, opts pipeline.FlowOptions) []graph.Option {
+	if cb := NewMiddlewareChain(opts.Middlewares...).NodeErrorCallback(stepID, step); cb != nil {
+		return []graph.Option{graph.WithNodeErrorCallback(cb)}
+	}
+	return nil
+}
+
 func makeFallbackRouter(fallback map[string]string) graph.ConditionalFunc {
 	return func(_ context.Context, state graph.State) (string, error) {
 		if code, ok := state[StateKeyPipelineErrorCode].(string); ok && code != "" {
@@ -100,6 +147,9 @@ func makeConfirmNode(stepID string, mode pipeline.AdvanceMode) graph.NodeFunc {
 		prompt = fmt.Sprintf("阶段 %s 已完成，等待用户输入", stepID)
 	}
 	return func(ctx context.Context, state graph.State) (any, error) {
+		if spend, ok := state[StateKeyBudgetExceeded].(map[string]any); ok && len(spend) > 0 {
+			return budgetInterrupt(ctx, state, stepID, spend)
+		}
 		if mode == pipeline.AdvanceAuto {
 			return graph.State{StateKeyPipelineErrorCode: ""}, nil
 		}
@@ -111,3 +161,34 @@ func makeConfirmNode(stepID string, mode pipeline.AdvanceMode) graph.NodeFunc {
 		return nil, err
 	}
 }
+
+// budgetInterrupt pauses a step whose budget is exceeded in block mode,
+// showing the spend. Resuming accepts the overrun of that budget and
+// re-enters the step, whose LLM call was skipped.
+func budgetInterrupt(ctx context.Context, state graph.State, stepID string, spend map[string]any) (any, error) {
+	scope, _ := spend["scope"].(string)
+	message := fmt.Sprintf("阶段 %s 超出预算 (%s)：已用 %v tokens，费用约 %.4f，继续将允许超出该预算",
+		stepID, scope, spend["tokens"], spend["cost"])
+	if _, err := graph.Interrupt(ctx, state, stepID+":budget", map[string]any{
+		"message": message,
+		"stage":   stepID,
+		"advance": string(pipeline.AdvanceBlock),
+		"budget":  spend,
+	}); err != nil {
+		return nil, err
+	}
+
+	approved := map[string]any{scope: true}
+	if prev, ok := state[StateKeyBudgetApproved].(map[string]any); ok {
+		for k, v := range prev {
+			approved[k] = v
+		}
+	}
+	return &graph.Command{
+		Update: graph.State{
+			StateKeyBudgetExceeded: map[string]any{},
+			StateKeyBudgetApproved: approved,
+		},
+		GoTo: stepID,
+	}, nil
+}
@@ -10,6 +10,7 @@ import (
 
 	"trpc.group/trpc-go/trpc-agent-go/graph"
 	"trpc.group/trpc-go/trpc-agent-go/model"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
 )
 
 // MiddlewareChain combines multiple Middleware into one.
@@ -86,6 +87,83 @@ func (c *MiddlewareChain) WrapPostNode(stepID string, step *pipeline.StepDefinit
 	}
 }
 
+// ModelCallbacks merges the model callbacks of every pipeline.CallbackMiddleware
+// in the chain, in order. Returns nil if there are none.
+func (c *MiddlewareChain) ModelCallbacks(stepID string, step *pipeline.StepDefinition) *model.Callbacks {
+	var merged *model.Callbacks
+	for _, mw := range c.items {
+		cm, ok := mw.(pipeline.CallbackMiddleware)
+		if !ok {
+			continue
+		}
+		cbs := cm.ModelCallbacks(stepID, step)
+		if cbs == nil {
+			continue
+		}
+		if merged == nil {
+			merged = model.NewCallbacks()
+		}
+		merged.BeforeModel = append(merged.BeforeModel, cbs.BeforeModel...)
+		merged.AfterModel = append(merged.AfterModel, cbs.AfterModel...)
+	}
+	return merged
+}
+
+// ToolCallbacks merges the tool callbacks of every pipeline.CallbackMiddleware
+// in the chain, in order. Returns nil if there are none.
+func (c *MiddlewareChain) ToolCallbacks(stepID string, step *pipeline.StepDefinition) *tool.Callbacks {
+	var merged *tool.Callbacks
+	for _, mw := range c.items {
+		cm, ok := mw.(pipeline.CallbackMiddleware)
+		if !ok {
+			continue
+		}
+		cbs := cm.ToolCallbacks(stepID, step)
+		if cbs == nil {
+			continue
+		}
+		if merged == nil {
+			merged = tool.NewCallbacks()
+		}
+		merged.BeforeTool = append(merged.BeforeTool, cbs.BeforeTool...)
+		merged.AfterTool = append(merged.AfterTool, cbs.AfterTool...)
+	}
+	return merged
+}
+
+// BindFlow passes info to every pipeline.FlowMiddleware in the chain.
+func (c *MiddlewareChain) BindFlow(info pipeline.FlowInfo) {
+	for _, mw := range c.items {
+		if fm, ok := mw.(pipeline.FlowMiddleware); ok {
+			fm.BindFlow(info)
+		}
+	}
+}
+
+// NodeErrorCallback returns a single OnNodeErrorCallback that runs the error
+// callbacks of every pipeline.FlowMiddleware in the chain, in order. Returns
+// nil if there are none.
+func (c *MiddlewareChain) NodeErrorCallback(stepID string, step *pipeline.StepDefinition) graph.OnNodeErrorCallback {
+	var callbacks []graph.OnNodeErrorCallback
+	for _, mw := range c.items {
+		fm, ok := mw.(pipeline.FlowMiddleware)
+		if !ok {
+			continue
+		}
+		if cb := fm.NodeErrorCallback(stepID, step); cb != nil {
+			callbacks = append(callbacks, cb)
+		}
+	}
+	if len(callbacks) == 0 {
+		return nil
+	}
+	return func(ctx context.Context, cbCtx *graph.NodeCallbackContext, state graph.State, err error) {
+		for _, cb := range callbacks {
+			cb(ctx, cbCtx, state, err)
+		}
+	}
+}
+
 // CompressionMiddleware implements pipeline.Middleware.
 // It checks token usage before each LLM node and triggers compression when needed.
 type CompressionMiddleware struct {
@@ -224,8 +302,9 @@ func (m *ArtifactRecordMiddleware) WrapPostNode(stepID string, step *pipeline.St
 
 // Verify interface compliance at compile time.
 var (
-	_ pipeline.Middleware = (*MiddlewareChain)(nil)
-	_ pipeline.Middleware = (*CompressionMiddleware)(nil)
-	_ pipeline.Middleware = (*PromptInjectionMiddleware)(nil)
-	_ pipeline.Middleware = (*ArtifactRecordMiddleware)(nil)
+	_ pipeline.Middleware         = (*MiddlewareChain)(nil)
+	_ pipeline.CallbackMiddleware = (*MiddlewareChain)(nil)
+	_ pipeline.Middleware         = (*CompressionMiddleware)(nil)
+	_ pipeline.Middleware         = (*PromptInjectionMiddleware)(nil)
+	_ pipeline.Middleware         = (*ArtifactRecordMiddleware)(nil)
 )
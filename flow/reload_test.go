@@ -0,0 +1,34 @@
+package flow
+
+import (
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+func TestReloadableGraph_KeepsPreviousOnFailure(t *testing.T) {
+	rg := NewReloadableGraph(NewGraphBuilder(), pipeline.FlowOptions{Model: stubModel{}})
+	if rg.Graph() != nil {
+		t.Fatal("expected nil graph before first rebuild")
+	}
+
+	steps := []*pipeline.StepDefinition{{Frontmatter: pipeline.Frontmatter{Step: "1.1"}, Body: "a"}}
+	if err := rg.Rebuild(steps); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	first := rg.Graph()
+	if first == nil || rg.Version() != 1 {
+		t.Fatalf("expected graph version 1, got %d", rg.Version())
+	}
+
+	dup := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1"}, Body: "a"},
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1"}, Body: "b"},
+	}
+	if err := rg.Rebuild(dup); err == nil {
+		t.Fatal("expected error for duplicate step")
+	}
+	if rg.Graph() != first || rg.Version() != 1 || len(rg.Steps()) != 1 {
+		t.Fatal("expected previous graph to stay current")
+	}
+}
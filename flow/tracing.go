@@ -0,0 +1,524 @@
+package flow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/telemetry"
+
+	"trpc.group/trpc-go/trpc-agent-go/agent"
+	"trpc.group/trpc-go/trpc-agent-go/graph"
+	"trpc.group/trpc-go/trpc-agent-go/model"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// TracingMiddleware implements pipeline.CallbackMiddleware.
+// It emits one trace per pipeline run: a root span, a chain/agent span per
+// step, and generation, tool and compression spans nested under the step.
+//
+// Node callbacks cannot replace the context, so spans are nested through
+// per-run state rather than the callback context. A run is either started
+// explicitly with StartRun, or opened on the first node of a graph
+// invocation and ended once the run reaches the end of the graph or a node
+// fails.
+//
+// List it first in FlowOptions.Middlewares so the step span exists before
+// other middlewares (e.g. compression) run. A TracingMiddleware belongs to
+// one built flow.
+type TracingMiddleware struct {
+	tracer telemetry.Tracer // nil means the global tracer
+
+	mu        sync.Mutex
+	runs      map[string]*traceRun // runs opened per invocation ID
+	mode      pipeline.FlowMode    // from BindFlow
+	exits     map[string]bool      // steps ending the run, from BindFlow
+	finalStep string               // last step registered, if not bound
+	hasPost   map[string]bool      // steps ended by a post-node callback
+}
+
+// NewTracingMiddleware creates a tracing middleware. A nil tracer uses the
+// global tracer (telemetry.Get) at run time.
+func NewTracingMiddleware(tracer telemetry.Tracer) *TracingMiddleware {
+	return &TracingMiddleware{
+		tracer:  tracer,
+		runs:    make(map[string]*traceRun),
+		hasPost: make(map[string]bool),
+	}
+}
+
+// traceRun holds the spans of one pipeline run.
+type traceRun struct {
+	ctx   context.Context // carries the root span
+	span  telemetry.Span
+	key   string // invocation ID for runs opened by the middleware, "" for StartRun
+	owner *TracingMiddleware
+
+	mu       sync.Mutex
+	steps    map[string]*traceStep
+	previous map[string]telemetry.Span // last ended span per step, for retry links
+	attempts map[string]int
+	current  string
+	ended    bool
+}
+
+// traceStep holds the span of one step execution.
+type traceStep struct {
+	ctx  context.Context
+	span telemetry.Span
+}
+
+// traceCall is the span of one generation or tool call, carried in the
+// callback context from the before to the after callback.
+type traceCall struct {
+	span telemetry.Span
+	once sync.Once
+}
+
+type (
+	runKey  struct{ m *TracingMiddleware }
+	callKey struct{ m *TracingMiddleware }
+)
+
+func (m *TracingMiddleware) tr() telemetry.Tracer {
+	if m.tracer != nil {
+		return m.tracer
+	}
+	return telemetry.Get()
+}
+
+// StartRun opens the root span of a pipeline run. Pass the returned context
+// to the graph executor and call end once the run finishes; err marks the
+// run as failed. Session, user and tags attached with telemetry.WithRun are
+// inherited by every span of the run; runID is attached if ctx has none.
+func (m *TracingMiddleware) StartRun(ctx context.Context, runID string) (context.Context, func(err error)) {
+	info, _ := telemetry.RunFromContext(ctx)
+	if info.RunID == "" {
+		info.RunID = runID
+		ctx = telemetry.WithRun(ctx, info)
+	}
+	ctx, span := m.tr().StartSpan(ctx, "pipeline.run", telemetry.WithAttributes(map[string]any{
+		telemetry.AttrTraceName:       "pipeline " + info.RunID,
+		telemetry.AttrObservationType: telemetry.ObservationTypeChain,
+	}))
+	run := newTraceRun(ctx, span, "", m)
+	ctx = context.WithValue(ctx, runKey{m}, run)
+	return ctx, run.end
+}
+
+// lookup returns the run of ctx, opening one for the invocation if the run
+// was not started with StartRun.
+func (m *TracingMiddleware) lookup(ctx context.Context, invocationID string) *traceRun {
+	if run, ok := ctx.Value(runKey{m}).(*traceRun); ok {
+		return run
+	}
+	if invocationID == "" {
+		if inv, ok := agent.InvocationFromContext(ctx); ok && inv != nil {
+			invocationID = inv.InvocationID
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if run := m.runs[invocationID]; run != nil {
+		return run
+	}
+	runCtx, span := m.tr().StartSpan(context.WithoutCancel(ctx), "pipeline.run", telemetry.WithAttributes(map[string]any{
+		telemetry.AttrTraceName:            "pipeline",
+		telemetry.AttrObservationType:      telemetry.ObservationTypeChain,
+		telemetry.AttrPipelineInvocationID: invocationID,
+	}))
+	run := newTraceRun(runCtx, span, invocationID, m)
+	m.runs[invocationID] = run
+	return run
+}
+
+func newTraceRun(ctx context.Context, span telemetry.Span, key string, owner *TracingMiddleware) *traceRun {
+	return &traceRun{
+		ctx:      ctx,
+		span:     span,
+		key:      key,
+		owner:    owner,
+		steps:    make(map[string]*traceStep),
+		previous: make(map[string]telemetry.Span),
+		attempts: make(map[string]int),
+	}
+}
+
+// step returns the open span of stepID, opening it if needed. A step that
+// runs again in the same run (fallback or retry) gets a new span linked to
+// the previous attempt.
+func (r *traceRun) step(stepID string, step *pipeline.StepDefinition) *traceStep {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.current = stepID
+	if s := r.steps[stepID]; s != nil {
+		return s
+	}
+	obsType := telemetry.ObservationTypeChain
+	if r.owner.agentMode() || len(step.Frontmatter.EffectiveTools()) > 0 {
+		obsType = telemetry.ObservationTypeAgent
+	}
+	r.attempts[stepID]++
+	opts := []telemetry.SpanOption{telemetry.WithAttributes(map[string]any{
+		telemetry.AttrObservationType:     obsType,
+		telemetry.AttrPipelineStepID:      stepID,
+		telemetry.AttrPipelineStepTitle:   step.Frontmatter.Title,
+		telemetry.AttrPipelineStepAttempt: r.attempts[stepID],
+	})}
+	if prev := r.previous[stepID]; prev != nil {
+		opts = append(opts, telemetry.WithLinks(prev))
+	}
+	ctx, span := r.owner.tr().StartSpan(r.ctx, "step "+stepID, opts...)
+	s := &traceStep{ctx: ctx, span: span}
+	r.steps[stepID] = s
+	return s
+}
+
+// parentCtx returns the context to nest compression spans under: the
+// current step, or the run itself.
+func (r *traceRun) parentCtx() context.Context {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if s := r.steps[r.current]; s != nil {
+		return s.ctx
+	}
+	return r.ctx
+}
+
+// endStep ends the span of stepID and, if last is set, the run opened by the
+// middleware.
+func (r *traceRun) endStep(stepID string, err error, last bool) {
+	r.mu.Lock()
+	s := r.steps[stepID]
+	delete(r.steps, stepID)
+	if s != nil {
+		r.previous[stepID] = s.span
+	}
+	r.mu.Unlock()
+
+	if s != nil {
+		endSpan(s.span, err)
+	}
+	if r.key != "" && last {
+		r.end(err)
+	}
+}
+
+// end ends any open step spans and the root span.
+func (r *traceRun) end(err error) {
+	r.mu.Lock()
+	if r.ended {
+		r.mu.Unlock()
+		return
+	}
+	r.ended = true
+	steps := r.steps
+	r.steps = make(map[string]*traceStep)
+	r.mu.Unlock()
+
+	for _, s := range steps {
+		endSpan(s.span, err)
+	}
+	endSpan(r.span, err)
+
+	if r.key != "" {
+		r.owner.mu.Lock()
+		if r.owner.runs[r.key] == r {
+			delete(r.owner.runs, r.key)
+		}
+		r.owner.mu.Unlock()
+	}
+}
+
+// exit reports whether the run ends after stepID. Without BindFlow, the
+// last step registered by the builder ends it.
+func (m *TracingMiddleware) exit(stepID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.exits != nil {
+		return m.exits[stepID]
+	}
+	return stepID == m.finalStep
+}
+
+// BindFlow records the mode of the built flow and the steps after which it
+// ends.
+func (m *TracingMiddleware) BindFlow(info pipeline.FlowInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mode = info.Mode
+	m.exits = info.Exits
+}
+
+// agentMode reports whether the middleware is bound to an agent flow.
+func (m *TracingMiddleware) agentMode() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mode == pipeline.FlowAgent
+}
+
+// NodeErrorCallback returns a callback that ends the step span and the run
+// when any node of the step fails.
+func (m *TracingMiddleware) NodeErrorCallback(stepID string, _ *pipeline.StepDefinition) graph.OnNodeErrorCallback {
+	return func(ctx context.Context, cbCtx *graph.NodeCallbackContext, _ graph.State, err error) {
+		var invocationID string
+		if cbCtx != nil {
+			invocationID = cbCtx.InvocationID
+		}
+		m.lookup(ctx, invocationID).endStep(stepID, err, true)
+	}
+}
+
+// endSpan sets the span status from err and ends it. Interrupts (e.g. a
+// confirm node waiting for the user) are not failures.
+func endSpan(span telemetry.Span, err error) {
+	switch {
+	case err == nil:
+		span.SetStatus(telemetry.StatusOK, "")
+	case graph.IsInterruptError(err):
+		span.SetAttributes(telemetry.BoolAttr(telemetry.AttrPipelineInterrupted, true))
+		span.SetStatus(telemetry.StatusOK, "")
+	default:
+		span.RecordError(err)
+		span.SetStatus(telemetry.StatusError, err.Error())
+	}
+	span.End()
+}
+
+// WrapPreNode returns a callback that opens the step span before the LLM
+// node runs. Re-entries of the node (tool loops) reuse the open span.
+func (m *TracingMiddleware) WrapPreNode(stepID string, step *pipeline.StepDefinition) graph.BeforeNodeCallback {
+	m.mu.Lock()
+	m.finalStep = stepID
+	m.mu.Unlock()
+
+	return func(ctx context.Context, cbCtx *graph.NodeCallbackContext, _ graph.State) (any, error) {
+		var invocationID string
+		if cbCtx != nil {
+			invocationID = cbCtx.InvocationID
+		}
+		m.lookup(ctx, invocationID).step(stepID, step)
+		return nil, nil
+	}
+}
+
+// WrapPostNode returns a callback that ends the step span once the step's
+// confirm node completes, and the run if it ends after the step.
+func (m *TracingMiddleware) WrapPostNode(stepID string, _ *pipeline.StepDefinition) graph.AfterNodeCallback {
+	m.mu.Lock()
+	m.hasPost[stepID] = true
+	m.mu.Unlock()
+
+	return func(ctx context.Context, cbCtx *graph.NodeCallbackContext, _ graph.State, result any, nodeErr error) (any, error) {
+		var invocationID string
+		if cbCtx != nil {
+			invocationID = cbCtx.InvocationID
+		}
+		// A confirm node re-entering a step (budget approval) routes away
+		// from the end of the graph.
+		cmd, reroutes := result.(*graph.Command)
+		reroutes = reroutes && cmd.GoTo != "" && cmd.GoTo != graph.End
+		m.lookup(ctx, invocationID).endStep(stepID, nodeErr, m.exit(stepID) && !reroutes)
+		return nil, nodeErr
+	}
+}
+
+// ModelCallbacks returns callbacks that trace each LLM call as a generation
+// with model and usage attributes, and the prompt and response when the
+// tracer captures IO (see telemetry.CapturesIO). Steps without a post-node
+// callback (agent mode) end with the first final response that requests no
+// tools.
+func (m *TracingMiddleware) ModelCallbacks(stepID string, step *pipeline.StepDefinition) *model.Callbacks {
+	cbs := model.NewCallbacks()
+	cbs.RegisterBeforeModel(func(ctx context.Context, args *model.BeforeModelArgs) (*model.BeforeModelResult, error) {
+		s := m.lookup(ctx, "").step(stepID, step)
+		attrs := map[string]any{
+			telemetry.AttrObservationType: telemetry.ObservationTypeGeneration,
+			telemetry.AttrPipelineStepID:  stepID,
+		}
+		if telemetry.CapturesIO(m.tr()) && args.Request != nil {
+			attrs[telemetry.AttrObservationInput] = marshalIO(args.Request.Messages)
+		}
+		spanCtx, span := m.tr().StartSpan(s.ctx, "generation", telemetry.WithAttributes(attrs))
+		ctx = telemetry.ContextWithSpan(ctx, spanCtx)
+		return &model.BeforeModelResult{Context: context.WithValue(ctx, callKey{m}, &traceCall{span: span})}, nil
+	})
+	cbs.RegisterAfterModel(func(ctx context.Context, args *model.AfterModelArgs) (*model.AfterModelResult, error) {
+		call, ok := ctx.Value(callKey{m}).(*traceCall)
+		if !ok {
+			return nil, nil
+		}
+		rsp := args.Response
+		err := args.Error
+		if err == nil && rsp != nil && rsp.Error != nil {
+			err = responseError{rsp.Error}
+		}
+		if err == nil && rsp != nil && rsp.IsPartial {
+			return nil, nil
+		}
+		call.once.Do(func() {
+			if rsp != nil {
+				setGenerationAttributes(call.span, rsp)
+				if telemetry.CapturesIO(m.tr()) && len(rsp.Choices) > 0 {
+					call.span.SetAttributes(telemetry.StringAttr(telemetry.AttrObservationOutput, marshalIO(rsp.Choices[0].Message)))
+				}
+			}
+			endSpan(call.span, err)
+		})
+		if err == nil && !m.endsByPostNode(stepID) && rsp != nil && !hasToolCalls(rsp) {
+			m.lookup(ctx, "").endStep(stepID, nil, m.exit(stepID))
+		}
+		return nil, nil
+	})
+	return cbs
+}
+
+// ToolCallbacks returns callbacks that trace each tool invocation, with the
+// pipeline error code on failure and, when the tracer captures IO, the
+// arguments and result.
+func (m *TracingMiddleware) ToolCallbacks(stepID string, step *pipeline.StepDefinition) *tool.Callbacks {
+	cbs := tool.NewCallbacks()
+	cbs.RegisterBeforeTool(func(ctx context.Context, args *tool.BeforeToolArgs) (*tool.BeforeToolResult, error) {
+		s := m.lookup(ctx, "").step(stepID, step)
+		attrs := map[string]any{
+			telemetry.AttrObservationType: telemetry.ObservationTypeTool,
+			telemetry.AttrPipelineStepID:  stepID,
+			telemetry.AttrToolName:        args.ToolName,
+			telemetry.AttrToolCallID:      args.ToolCallID,
+		}
+		if telemetry.CapturesIO(m.tr()) {
+			attrs[telemetry.AttrObservationInput] = string(args.Arguments)
+		}
+		spanCtx, span := m.tr().StartSpan(s.ctx, "tool "+args.ToolName, telemetry.WithAttributes(attrs))
+		// The tool runs with the framework context; carry the tool span into
+		// it so HTTP MCP servers receive it as traceparent.
+		ctx = telemetry.ContextWithSpan(ctx, spanCtx)
+		return &tool.BeforeToolResult{Context: context.WithValue(ctx, callKey{m}, &traceCall{span: span})}, nil
+	})
+	cbs.RegisterAfterTool(func(ctx context.Context, args *tool.AfterToolArgs) (*tool.AfterToolResult, error) {
+		call, ok := ctx.Value(callKey{m}).(*traceCall)
+		if !ok {
+			return nil, nil
+		}
+		call.once.Do(func() {
+			if telemetry.CapturesIO(m.tr()) && args.Result != nil {
+				call.span.SetAttributes(telemetry.StringAttr(telemetry.AttrObservationOutput, marshalIO(args.Result)))
+			}
+			if args.Error != nil {
+				code := pipeline.ClassifyToolError(args.Error)
+				call.span.SetAttributes(telemetry.StringAttr(telemetry.AttrToolErrorCode, string(code)))
+			}
+			endSpan(call.span, args.Error)
+		})
+		return nil, nil
+	})
+	return cbs
+}
+
+// WrapCompressor returns c recording a compression span under the current
+// step each time it compresses, with a "summary" event when a summary
+// message was produced.
+func (m *TracingMiddleware) WrapCompressor(c memory.Compressor) memory.Compressor {
+	return &tracingCompressor{inner: c, m: m}
+}
+
+func (m *TracingMiddleware) endsByPostNode(stepID string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.hasPost[stepID]
+}
+
+type tracingCompressor struct {
+	inner memory.Compressor
+	m     *TracingMiddleware
+}
+
+func (c *tracingCompressor) CompressIfNeeded(ctx context.Context, msgs []model.Message, currentTokens int) ([]model.Message, bool, error) {
+	start := time.Now()
+	compressed, didCompress, err := c.inner.CompressIfNeeded(ctx, msgs, currentTokens)
+	if !didCompress && err == nil {
+		return compressed, didCompress, err
+	}
+
+	parent := c.m.lookup(ctx, "").parentCtx()
+	_, span := c.m.tr().StartSpan(parent, "compression", telemetry.WithAttributes(map[string]any{
+		telemetry.AttrObservationType:     telemetry.ObservationTypeSpan,
+		telemetry.AttrCompressionTokens:   currentTokens,
+		telemetry.AttrCompressionMsgsIn:   len(msgs),
+		telemetry.AttrCompressionDuration: time.Since(start).Milliseconds(),
+	}))
+	if didCompress {
+		span.SetAttributes(telemetry.IntAttr(telemetry.AttrCompressionMsgsOut, len(compressed)))
+		for _, msg := range compressed {
+			if memory.IsSummaryMessage(msg.Content) {
+				span.AddEvent("summary", telemetry.IntAttr(telemetry.AttrSummaryLength, len(msg.Content)))
+				break
+			}
+		}
+	}
+	endSpan(span, err)
+	return compressed, didCompress, err
+}
+
+// setGenerationAttributes records the model and token usage of a response.
+func setGenerationAttributes(span telemetry.Span, rsp *model.Response) {
+	if rsp.Model != "" {
+		span.SetAttributes(telemetry.StringAttr(telemetry.AttrObservationModel, rsp.Model))
+	}
+	if rsp.Usage == nil {
+		return
+	}
+	usage, _ := json.Marshal(map[string]int{
+		"input":  rsp.Usage.PromptTokens,
+		"output": rsp.Usage.CompletionTokens,
+		"total":  rsp.Usage.TotalTokens,
+	})
+	span.SetAttributes(
+		telemetry.StringAttr(telemetry.AttrObservationUsageDetails, string(usage)),
+		telemetry.IntAttr(telemetry.AttrUsageInputTokens, rsp.Usage.PromptTokens),
+		telemetry.IntAttr(telemetry.AttrUsageOutputTokens, rsp.Usage.CompletionTokens),
+	)
+}
+
+// marshalIO encodes a captured input or output as JSON. Strings are kept
+// as-is.
+func marshalIO(v any) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(b)
+}
+
+func hasToolCalls(rsp *model.Response) bool {
+	for _, choice := range rsp.Choices {
+		if len(choice.Message.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// responseError reports an API-level model error.
+type responseError struct {
+	err *model.ResponseError
+}
+
+func (e responseError) Error() string {
+	return e.err.Type + ": " + e.err.Message
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ pipeline.CallbackMiddleware = (*TracingMiddleware)(nil)
+	_ pipeline.FlowMiddleware     = (*TracingMiddleware)(nil)
+	_ memory.Compressor           = (*tracingCompressor)(nil)
+)
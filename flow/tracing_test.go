@@ -0,0 +1,327 @@
+package flow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/telemetry"
+
+	"trpc.group/trpc-go/trpc-agent-go/graph"
+	"trpc.group/trpc-go/trpc-agent-go/model"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+func readSpans(t *testing.T, buf *bytes.Buffer) map[string]telemetry.JSONSpan {
+	t.Helper()
+	spans := make(map[string]telemetry.JSONSpan)
+	sc := bufio.NewScanner(buf)
+	for sc.Scan() {
+		var s telemetry.JSONSpan
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatalf("invalid span: %v", err)
+		}
+		spans[s.Name] = s
+	}
+	return spans
+}
+
+// summaryCompressor always compresses into a single summary message.
+type summaryCompressor struct{}
+
+func (summaryCompressor) CompressIfNeeded(_ context.Context, _ []model.Message, _ int) ([]model.Message, bool, error) {
+	return []model.Message{memory.FormatSummaryMessage("earlier work")}, true, nil
+}
+
+func TestTracingMiddleware_NestsSpansUnderRun(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(telemetry.NewJSON(&buf, "test"))
+	step := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1", Title: "Spec", Tools: []string{"eda"}}}
+
+	pre := mw.WrapPreNode("1.1", step)
+	post := mw.WrapPostNode("1.1", step)
+	modelCbs := mw.ModelCallbacks("1.1", step)
+	toolCbs := mw.ToolCallbacks("1.1", step)
+	compressor := mw.WrapCompressor(summaryCompressor{})
+
+	ctx, end := mw.StartRun(context.Background(), "run-1")
+
+	if _, err := pre(ctx, &graph.NodeCallbackContext{NodeID: "1.1"}, graph.State{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := compressor.CompressIfNeeded(ctx, []model.Message{model.NewUserMessage("a"), model.NewUserMessage("b")}, 9000); err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := modelCbs.RunBeforeModel(ctx, &model.BeforeModelArgs{Request: &model.Request{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genCtx := before.Context
+	partial := &model.Response{IsPartial: true}
+	final := &model.Response{Model: "gpt-test", Usage: &model.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120}}
+	for _, rsp := range []*model.Response{partial, final} {
+		if _, err := modelCbs.RunAfterModel(genCtx, &model.AfterModelArgs{Response: rsp}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	toolBefore, err := toolCbs.RunBeforeTool(ctx, &tool.BeforeToolArgs{ToolName: "synth", ToolCallID: "call-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{}
+	telemetry.InjectTraceContext(toolBefore.Context, header)
+	if header.Get("traceparent") == "" {
+		t.Error("tool context should carry the tool span for propagation")
+	}
+	toolErr := pipeline.ToolError{Code: pipeline.ErrCodeTimeout, Err: errors.New("deadline")}
+	if _, err := toolCbs.RunAfterTool(toolBefore.Context, &tool.AfterToolArgs{ToolName: "synth", Error: toolErr}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := post(ctx, nil, graph.State{}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	end(nil)
+
+	spans := readSpans(t, &buf)
+	run, stepSpan := spans["pipeline.run"], spans["step 1.1"]
+	if run.SpanID == "" || stepSpan.ParentSpanID != run.SpanID {
+		t.Fatalf("step not nested under run: %+v", spans)
+	}
+	if stepSpan.Attributes[telemetry.AttrObservationType] != telemetry.ObservationTypeAgent {
+		t.Errorf("expected agent step, got %v", stepSpan.Attributes[telemetry.AttrObservationType])
+	}
+	for _, name := range []string{"generation", "tool synth", "compression"} {
+		if s := spans[name]; s.ParentSpanID != stepSpan.SpanID || s.TraceID != run.TraceID {
+			t.Errorf("%s not nested under step: %+v", name, s)
+		}
+	}
+	if ev := spans["compression"].Events; len(ev) != 1 || ev[0].Name != "summary" {
+		t.Errorf("expected summary event on compression span, got %+v", ev)
+	}
+
+	gen := spans["generation"]
+	if gen.Attributes[telemetry.AttrObservationModel] != "gpt-test" || gen.Attributes[telemetry.AttrUsageInputTokens] != float64(100) {
+		t.Errorf("unexpected generation attributes: %v", gen.Attributes)
+	}
+	if gen.Attributes[telemetry.AttrObservationUsageDetails] != `{"input":100,"output":20,"total":120}` {
+		t.Errorf("unexpected usage details: %v", gen.Attributes[telemetry.AttrObservationUsageDetails])
+	}
+
+	toolSpan := spans["tool synth"]
+	if toolSpan.Status != "Error" || toolSpan.Attributes[telemetry.AttrToolErrorCode] != string(pipeline.ErrCodeTimeout) {
+		t.Errorf("tool error not recorded: %+v", toolSpan)
+	}
+}
+
+func TestTracingMiddleware_OpensRunPerInvocation(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(telemetry.NewJSON(&buf, "test"))
+	first := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1"}}
+	last := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "2.1"}}
+
+	pre1, post1 := mw.WrapPreNode("1.1", first), mw.WrapPostNode("1.1", first)
+	pre2, post2 := mw.WrapPreNode("2.1", last), mw.WrapPostNode("2.1", last)
+
+	ctx := context.Background()
+	cbCtx := &graph.NodeCallbackContext{InvocationID: "inv-1"}
+	pre1(ctx, cbCtx, graph.State{})
+	post1(ctx, cbCtx, graph.State{}, nil, nil)
+	if buf.Len() == 0 || bytes.Contains(buf.Bytes(), []byte(`"pipeline.run"`)) {
+		t.Fatal("run should stay open until the final step completes")
+	}
+	pre2(ctx, cbCtx, graph.State{})
+	post2(ctx, cbCtx, graph.State{}, nil, nil)
+
+	spans := readSpans(t, &buf)
+	run := spans["pipeline.run"]
+	if run.SpanID == "" || run.Attributes[telemetry.AttrPipelineInvocationID] != "inv-1" {
+		t.Fatalf("run span missing: %+v", spans)
+	}
+	if spans["step 1.1"].ParentSpanID != run.SpanID || spans["step 2.1"].ParentSpanID != run.SpanID {
+		t.Fatal("steps not nested under the invocation's run")
+	}
+	if len(mw.runs) != 0 {
+		t.Fatal("ended run not released")
+	}
+}
+
+func TestTracingMiddleware_EndsRunOnEarlyExit(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(telemetry.NewJSON(&buf, "test"))
+	steps := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Advance: pipeline.AdvanceAuto, Next: "2.1", Fallback: map[string]string{"default": "1.5"}}},
+		{Frontmatter: pipeline.Frontmatter{Step: "1.5", Advance: pipeline.AdvanceAuto}},
+		{Frontmatter: pipeline.Frontmatter{Step: "2.1", Advance: pipeline.AdvanceAuto}},
+	}
+	if _, err := NewGraphBuilder().Build(steps, pipeline.FlowOptions{Model: stubModel{}, Middlewares: []pipeline.Middleware{mw}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cbCtx := &graph.NodeCallbackContext{InvocationID: "inv-1"}
+	for _, stepID := range []string{"1.1", "1.5"} {
+		mw.WrapPreNode(stepID, steps[0])(ctx, cbCtx, graph.State{})
+		if stepID == "1.5" {
+			// Re-entering the step after a budget approval keeps the run open.
+			reenter := &graph.Command{GoTo: stepID}
+			mw.WrapPostNode(stepID, steps[0])(ctx, cbCtx, graph.State{}, reenter, nil)
+			if len(mw.runs) != 1 {
+				t.Fatal("run should stay open while a confirm node re-enters its step")
+			}
+			mw.WrapPreNode(stepID, steps[0])(ctx, cbCtx, graph.State{})
+		}
+		mw.WrapPostNode(stepID, steps[0])(ctx, cbCtx, graph.State{}, nil, nil)
+	}
+
+	if run := readSpans(t, &buf)["pipeline.run"]; run.SpanID == "" || run.Status != "Ok" {
+		t.Fatalf("run should end after the fallback step without next: %+v", run)
+	}
+	if len(mw.runs) != 0 {
+		t.Fatal("ended run not released")
+	}
+}
+
+func TestTracingMiddleware_EndsRunOnNodeError(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(telemetry.NewJSON(&buf, "test"))
+	steps := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Advance: pipeline.AdvanceAuto}},
+		{Frontmatter: pipeline.Frontmatter{Step: "2.1", Advance: pipeline.AdvanceAuto}},
+	}
+	if _, err := NewChainBuilder().Build(steps, pipeline.FlowOptions{Model: stubModel{}, Middlewares: []pipeline.Middleware{mw}}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cbCtx := &graph.NodeCallbackContext{InvocationID: "inv-1"}
+	mw.WrapPreNode("1.1", steps[0])(ctx, cbCtx, graph.State{})
+	mw.NodeErrorCallback("1.1", steps[0])(ctx, cbCtx, graph.State{}, errors.New("model unavailable"))
+
+	spans := readSpans(t, &buf)
+	if run := spans["pipeline.run"]; run.Status != "Error" || run.StatusMessage != "model unavailable" {
+		t.Fatalf("run should end with the node error: %+v", run)
+	}
+	if spans["step 1.1"].Status != "Error" {
+		t.Errorf("step should end with the node error: %+v", spans["step 1.1"])
+	}
+	if len(mw.runs) != 0 {
+		t.Fatal("failed run not released")
+	}
+}
+
+// callbackRecorder records the steps builders request callbacks for.
+type callbackRecorder struct {
+	model, tools []string
+}
+
+func (r *callbackRecorder) WrapPreNode(string, *pipeline.StepDefinition) graph.BeforeNodeCallback {
+	return nil
+}
+
+func (r *callbackRecorder) WrapPostNode(string, *pipeline.StepDefinition) graph.AfterNodeCallback {
+	return nil
+}
+
+func (r *callbackRecorder) ModelCallbacks(stepID string, _ *pipeline.StepDefinition) *model.Callbacks {
+	r.model = append(r.model, stepID)
+	return model.NewCallbacks()
+}
+
+func (r *callbackRecorder) ToolCallbacks(stepID string, _ *pipeline.StepDefinition) *tool.Callbacks {
+	r.tools = append(r.tools, stepID)
+	return tool.NewCallbacks()
+}
+
+func TestGraphBuilder_AttachesCallbackMiddleware(t *testing.T) {
+	steps := []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Advance: pipeline.AdvanceAuto, Next: "3.1"}},
+		{Frontmatter: pipeline.Frontmatter{Step: "3.1", Tools: []string{"eda"}, Advance: pipeline.AdvanceAuto}},
+	}
+	rec := &callbackRecorder{}
+	_, err := NewGraphBuilder().Build(steps, pipeline.FlowOptions{
+		Model:       stubModel{},
+		ToolSets:    map[string]tool.ToolSet{"eda": stubToolSet{name: "eda"}},
+		Middlewares: []pipeline.Middleware{&stubMiddleware{}, rec},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.model) != 2 || len(rec.tools) != 1 || rec.tools[0] != "3.1" {
+		t.Errorf("unexpected callback requests: model=%v tools=%v", rec.model, rec.tools)
+	}
+}
+
+func TestTracingMiddleware_LinksRetriedSteps(t *testing.T) {
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(telemetry.NewJSON(&buf, "test"))
+	step := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1"}}
+	pre, post := mw.WrapPreNode("1.1", step), mw.WrapPostNode("1.1", step)
+
+	ctx, end := mw.StartRun(context.Background(), "run-1")
+	pre(ctx, nil, graph.State{})
+	post(ctx, nil, graph.State{}, nil, errors.New("lint failed"))
+	pre(ctx, nil, graph.State{})
+	post(ctx, nil, graph.State{}, nil, nil)
+	end(nil)
+
+	var attempts []telemetry.JSONSpan
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var s telemetry.JSONSpan
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatal(err)
+		}
+		if s.Name == "step 1.1" {
+			attempts = append(attempts, s)
+		}
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attempts))
+	}
+	first, second := attempts[0], attempts[1]
+	if first.Status != "Error" || len(first.Events) != 1 || first.Events[0].Name != "exception" {
+		t.Errorf("first attempt should record the error: %+v", first)
+	}
+	if second.Attributes[telemetry.AttrPipelineStepAttempt] != float64(2) {
+		t.Errorf("unexpected attempt: %v", second.Attributes[telemetry.AttrPipelineStepAttempt])
+	}
+	if len(second.Links) != 1 || second.Links[0].SpanID != first.SpanID {
+		t.Errorf("retry not linked to first attempt: %+v", second.Links)
+	}
+}
+
+func TestTracingMiddleware_CapturesIOWhenEnabled(t *testing.T) {
+	policy, err := telemetry.NewTracePolicy(config.TracePolicyConfig{CaptureIO: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	mw := NewTracingMiddleware(policy.Wrap(telemetry.NewJSON(&buf, "test")))
+	step := &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: "1.1"}}
+	toolCbs := mw.ToolCallbacks("1.1", step)
+
+	ctx, end := mw.StartRun(context.Background(), "run-1")
+	before, err := toolCbs.RunBeforeTool(ctx, &tool.BeforeToolArgs{ToolName: "read", Arguments: []byte(`{"path":"/home/alice/a.v"}`)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := toolCbs.RunAfterTool(before.Context, &tool.AfterToolArgs{ToolName: "read", Result: "module a;"}); err != nil {
+		t.Fatal(err)
+	}
+	end(nil)
+
+	attrs := readSpans(t, &buf)["tool read"].Attributes
+	if attrs[telemetry.AttrObservationInput] != `{"path":"/home/[REDACTED]/a.v"}` || attrs[telemetry.AttrObservationOutput] != "module a;" {
+		t.Errorf("unexpected captured IO: %v", attrs)
+	}
+}
@@ -0,0 +1,174 @@
+package flow
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/step"
+)
+
+// RunWindow selects the steps of a startAt..stopAfter run window, ordered by
+// step ID. The window holds startAt (default: the first step) and the steps
+// reachable from it, not going past stopAfter. Upstream holds the steps that
+// can reach startAt; their outputs are the window's inputs.
+//
+// Steps are linked by their next and fallback edges, or by step order when
+// sequential is set (chain and agent flows). Edges to earlier steps (retries
+// and loops) extend neither the window nor the upstream.
+func RunWindow(steps []*pipeline.StepDefinition, startAt, stopAfter string, sequential bool) (window, upstream []*pipeline.StepDefinition, err error) {
+	sorted := slices.Clone(steps)
+	slices.SortStableFunc(sorted, func(a, b *pipeline.StepDefinition) int {
+		return step.CompareStepIDs(a.Frontmatter.Step, b.Frontmatter.Step)
+	})
+	if len(sorted) == 0 {
+		return nil, nil, fmt.Errorf("no steps")
+	}
+
+	index := make(map[string]int, len(sorted))
+	for i, s := range sorted {
+		index[s.Frontmatter.Step] = i
+	}
+	start := 0
+	if startAt != "" {
+		i, ok := index[startAt]
+		if !ok {
+			return nil, nil, fmt.Errorf("start step %s not found", startAt)
+		}
+		start = i
+	}
+	if _, ok := index[stopAfter]; stopAfter != "" && !ok {
+		return nil, nil, fmt.Errorf("stop step %s not found", stopAfter)
+	}
+
+	// successors returns the forward edges of step i.
+	successors := func(i int) []int {
+		if sequential {
+			if i+1 < len(sorted) {
+				return []int{i + 1}
+			}
+			return nil
+		}
+		fm := sorted[i].Frontmatter
+		var out []int
+		add := func(target string) {
+			if j, ok := index[target]; ok && j > i {
+				out = append(out, j)
+			}
+		}
+		add(fm.Next)
+		for _, target := range fm.Fallback {
+			add(target)
+		}
+		return out
+	}
+
+	inWindow := make([]bool, len(sorted))
+	inWindow[start] = true
+	for i := start; i < len(sorted); i++ {
+		if !inWindow[i] || sorted[i].Frontmatter.Step == stopAfter {
+			continue
+		}
+		for _, j := range successors(i) {
+			inWindow[j] = true
+		}
+	}
+	if stopAfter != "" && !inWindow[index[stopAfter]] {
+		return nil, nil, fmt.Errorf("stop step %s is not reachable from step %s", stopAfter, sorted[start].Frontmatter.Step)
+	}
+
+	reaches := make([]bool, len(sorted))
+	reaches[start] = true
+	for i := start - 1; i >= 0; i-- {
+		for _, j := range successors(i) {
+			if reaches[j] {
+				reaches[i] = true
+				break
+			}
+		}
+	}
+
+	for i, s := range sorted {
+		switch {
+		case inWindow[i]:
+			window = append(window, s)
+		case reaches[i]:
+			upstream = append(upstream, s)
+		}
+	}
+	return window, upstream, nil
+}
+
+// applyRunWindow restricts steps to the StartAt..StopAfter window of opts
+// (see RunWindow). Upstream outputs must exist in opts.Workspace and are
+// seeded into opts.Artifacts. Inside the window, next and fallback
+// references to steps outside it end the run instead. Without StartAt and
+// StopAfter the steps are returned unchanged.
+func applyRunWindow(steps []*pipeline.StepDefinition, opts pipeline.FlowOptions, sequential bool) ([]*pipeline.StepDefinition, error) {
+	if opts.StartAt == "" && opts.StopAfter == "" {
+		return steps, nil
+	}
+
+	window, upstream, err := RunWindow(steps, opts.StartAt, opts.StopAfter, sequential)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StartAt != "" {
+		if err := seedUpstream(upstream, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	inWindow := make(map[string]bool, len(window))
+	for _, s := range window {
+		inWindow[s.Frontmatter.Step] = true
+	}
+
+	out := make([]*pipeline.StepDefinition, 0, len(window))
+	for _, s := range window {
+		cp := *s
+		if !inWindow[cp.Frontmatter.Next] {
+			cp.Frontmatter.Next = ""
+		}
+		if len(s.Frontmatter.Fallback) > 0 {
+			cp.Frontmatter.Fallback = make(map[string]string, len(s.Frontmatter.Fallback))
+			for code, target := range s.Frontmatter.Fallback {
+				if inWindow[target] {
+					cp.Frontmatter.Fallback[code] = target
+				}
+			}
+		}
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+// seedUpstream verifies that every declared output of the upstream steps
+// exists and records them as completed artifacts.
+func seedUpstream(upstream []*pipeline.StepDefinition, opts pipeline.FlowOptions) error {
+	if opts.Workspace == nil {
+		return fmt.Errorf("start at %s: Workspace is required to check upstream outputs", opts.StartAt)
+	}
+
+	var missing []string
+	for _, s := range upstream {
+		for _, out := range s.Frontmatter.Output {
+			if info, err := opts.Workspace.Stat(out); err != nil || info.IsDir() {
+				missing = append(missing, fmt.Sprintf("%s (step %s)", out, s.Frontmatter.Step))
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("start at %s: missing upstream outputs: %s", opts.StartAt, strings.Join(missing, ", "))
+	}
+
+	if opts.Artifacts != nil {
+		for _, s := range upstream {
+			if out := s.Frontmatter.PrimaryOutput(); out != "" {
+				opts.Artifacts.RecordCompleted(s.Frontmatter.Step, s.Frontmatter.Title, out)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package flow
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+// workspaceFS wraps fstest.MapFS to implement pipeline.FileSystem.
+type workspaceFS struct {
+	fstest.MapFS
+}
+
+func (w workspaceFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(w.MapFS, name) }
+
+func (w workspaceFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(w.MapFS, name) }
+
+func windowSteps() []*pipeline.StepDefinition {
+	mk := func(id, out, next string, fallback map[string]string) *pipeline.StepDefinition {
+		return &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{
+			Step: id, Title: "step " + id, Output: pipeline.OutputField{out}, Next: next, Fallback: fallback,
+		}}
+	}
+	return []*pipeline.StepDefinition{
+		mk("1.1", "docs/a.md", "2.1", nil),
+		mk("2.1", "docs/b.md", "3.1", nil),
+		mk("3.1", "docs/c.md", "4.1", map[string]string{"default": "1.1", "tool_timeout": "3.1"}),
+		mk("4.1", "docs/d.md", "", nil),
+	}
+}
+
+func TestApplyRunWindow_SeedsUpstream(t *testing.T) {
+	ws := workspaceFS{fstest.MapFS{
+		"docs/a.md": &fstest.MapFile{Data: []byte("a\n")},
+		"docs/b.md": &fstest.MapFile{Data: []byte("b\nb\n")},
+	}}
+	tracker := memory.NewFileTracker(ws)
+
+	steps, err := applyRunWindow(windowSteps(), pipeline.FlowOptions{
+		StartAt: "2.1", StopAfter: "3.1", Workspace: ws, Artifacts: tracker,
+	}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 2 || steps[0].Frontmatter.Step != "2.1" || steps[1].Frontmatter.Step != "3.1" {
+		t.Fatalf("unexpected window: %d steps", len(steps))
+	}
+	if steps[1].Frontmatter.Next != "" {
+		t.Fatalf("expected run to end after 3.1, got next %q", steps[1].Frontmatter.Next)
+	}
+	if fb := steps[1].Frontmatter.Fallback; len(fb) != 1 || fb["tool_timeout"] != "3.1" {
+		t.Fatalf("expected only in-window fallback, got %v", fb)
+	}
+	if a := tracker.GetArtifact("1.1"); a == nil || a.FilePath != "docs/a.md" {
+		t.Fatalf("expected upstream artifact seeded, got %+v", a)
+	}
+	if tracker.GetArtifact("2.1") != nil {
+		t.Fatal("in-window step should not be seeded")
+	}
+}
+
+func TestRunWindow_FollowsEdges(t *testing.T) {
+	mk := func(id, next string, fallback map[string]string) *pipeline.StepDefinition {
+		return &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: id, Next: next, Fallback: fallback}}
+	}
+	// Sorted as strings, as the loader does: 2.10 comes before 2.9. Step 1.5
+	// only runs when 1.1 falls back and ends the run.
+	steps := []*pipeline.StepDefinition{
+		mk("1.1", "2.9", map[string]string{"default": "1.5"}),
+		mk("1.5", "", nil),
+		mk("2.10", "3.1", nil),
+		mk("2.9", "2.10", nil),
+		mk("3.1", "", map[string]string{"default": "2.9"}),
+	}
+	ids := func(steps []*pipeline.StepDefinition) string {
+		var out []string
+		for _, s := range steps {
+			out = append(out, s.Frontmatter.Step)
+		}
+		return strings.Join(out, ",")
+	}
+
+	window, upstream, err := RunWindow(steps, "2.10", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(window) != "2.10,3.1" || ids(upstream) != "1.1,2.9" {
+		t.Errorf("window %s, upstream %s", ids(window), ids(upstream))
+	}
+
+	window, upstream, err = RunWindow(steps, "", "2.10", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(window) != "1.1,1.5,2.9,2.10" || len(upstream) != 0 {
+		t.Errorf("window %s, upstream %s", ids(window), ids(upstream))
+	}
+
+	window, upstream, err = RunWindow(steps, "2.9", "2.10", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids(window) != "2.9,2.10" || ids(upstream) != "1.1,1.5" {
+		t.Errorf("sequential window %s, upstream %s", ids(window), ids(upstream))
+	}
+
+	if _, _, err := RunWindow(steps, "2.10", "1.5", false); err == nil {
+		t.Error("expected unreachable stop step error")
+	}
+}
+
+func TestApplyRunWindow_Errors(t *testing.T) {
+	ws := workspaceFS{fstest.MapFS{"docs/a.md": &fstest.MapFile{Data: []byte("a")}}}
+	cases := map[string]pipeline.FlowOptions{
+		"missing output":  {StartAt: "3.1", Workspace: ws},
+		"no workspace":    {StartAt: "2.1"},
+		"unknown start":   {StartAt: "9.9", Workspace: ws},
+		"stop before run": {StartAt: "2.1", StopAfter: "1.1", Workspace: ws},
+	}
+	for name, opts := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := applyRunWindow(windowSteps(), opts, false); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	_, err := applyRunWindow(windowSteps(), pipeline.FlowOptions{StartAt: "3.1", Workspace: ws}, false)
+	if err == nil || !strings.Contains(err.Error(), "docs/b.md (step 2.1)") {
+		t.Fatalf("expected missing output listed, got %v", err)
+	}
+}
+
+func TestGraphBuilder_StopAfter(t *testing.T) {
+	g, err := NewGraphBuilder().Build(windowSteps(), pipeline.FlowOptions{Model: stubModel{}, StopAfter: "2.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if g == nil {
+		t.Fatal("expected non-nil graph")
+	}
+}
@@ -1,8 +1,10 @@
 package logger
 
 import (
+	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/charmbracelet/log"
 )
@@ -11,6 +13,24 @@ type Logger = *log.Logger
 
 var global Logger
 
+var (
+	outputMu sync.Mutex
+	output   io.Writer = os.Stdout
+)
+
+// SetOutput sends the global logger, and loggers created by New from now on,
+// to w, and returns the previous writer. Use it to keep logs off stdout when
+// stdout carries a protocol, e.g. MCP over stdio.
+func SetOutput(w io.Writer) io.Writer {
+	l := L()
+	outputMu.Lock()
+	prev := output
+	output = w
+	outputMu.Unlock()
+	l.SetOutput(w)
+	return prev
+}
+
 func Init(level string) {
 	global = New(level)
 }
@@ -28,7 +48,10 @@ func L() Logger {
 }
 
 func New(level string) Logger {
-	logger := log.NewWithOptions(os.Stdout, log.Options{
+	outputMu.Lock()
+	w := output
+	outputMu.Unlock()
+	logger := log.NewWithOptions(w, log.Options{
 		ReportTimestamp: true,
 		TimeFormat:      "2006-01-02 15:04:05",
 	})
@@ -5,13 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 )
 
 // MCPConfig is the root configuration structure matching mcp.json
 type MCPConfig struct {
 	MCPServers map[string]MCPServerConfig `json:"mcpServers"`
 	Defaults   MCPDefaults                `json:"defaults"`
+	// Stages maps stage names (or globs such as "sim*") to server names or
+	// globs, e.g. {"simulation": ["eda", "wave-*"]}. See StageRegistry.
+	Stages map[string][]string `json:"stages,omitempty"`
+	// Policy scopes tools per step and constrains their calls. See Policy.
+	Policy PolicyConfig `json:"policy,omitempty"`
 }
 
 // MCPServerConfig defines a single MCP server configuration
@@ -31,65 +36,56 @@ type MCPServerConfig struct {
 	Disabled bool              `json:"disabled"`
 	Env      map[string]string `json:"env,omitempty"`
 	Timeout  int               `json:"timeout,omitempty"`
-	Tools    []string          `json:"tools,omitempty"`
+	// Tools and Deny are tool-name globs: only tools matching Tools (all
+	// when empty) and not matching Deny are exposed.
+	Tools []string `json:"tools,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
 }
 
 // MCPDefaults defines default settings
 type MCPDefaults struct {
 	Timeout int `json:"timeout"` // seconds
 	Retries int `json:"retries"`
+	// MaxConcurrentInit bounds how many servers initialize in parallel (default 4)
+	MaxConcurrentInit int `json:"maxConcurrentInit,omitempty"`
 }
 
-// LoadConfig loads MCP configuration from a JSON file
-func LoadConfig(configPath string) (*MCPConfig, error) {
+// maxConcurrentInit returns the configured init concurrency or its default
+func (d MCPDefaults) maxConcurrentInit() int {
+	if d.MaxConcurrentInit > 0 {
+		return d.MaxConcurrentInit
+	}
+	return 4
+}
+
+// LoadConfig loads MCP configuration from a JSON file.
+// ${workspace} and relative ${file:...} paths default to the file's directory.
+func LoadConfig(configPath string, opts ...LoadOption) (*MCPConfig, error) {
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read mcp.json: %w", err)
 	}
+	return ParseConfig(data, append([]LoadOption{WithWorkspace(filepath.Dir(configPath))}, opts...)...)
+}
 
+// ParseConfig parses mcp.json content and interpolates variables (see Interpolate).
+// ${workspace} defaults to the current directory.
+func ParseConfig(data []byte, opts ...LoadOption) (*MCPConfig, error) {
 	var config MCPConfig
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse mcp.json: %w", err)
 	}
 
-	// Interpolate environment variables
-	interpolateConfig(&config)
-
-	return &config, nil
-}
-
-// interpolateConfig replaces ${env:VAR} with actual environment variable values
-func interpolateConfig(config *MCPConfig) {
-	for _, serverCfg := range config.MCPServers {
-		// Interpolate command
-		serverCfg.Command = interpolateEnv(serverCfg.Command)
-
-		// Interpolate args
-		for i, arg := range serverCfg.Args {
-			serverCfg.Args[i] = interpolateEnv(arg)
-		}
-
-		// Interpolate serverUrl
-		serverCfg.ServerUrl = interpolateEnv(serverCfg.ServerUrl)
-
-		// Interpolate headers
-		for k, v := range serverCfg.Headers {
-			serverCfg.Headers[k] = interpolateEnv(v)
-		}
-
-		// Interpolate env values
-		for k, v := range serverCfg.Env {
-			serverCfg.Env[k] = interpolateEnv(v)
-		}
+	lo := loadOptions{lookupEnv: os.LookupEnv}
+	for _, o := range opts {
+		o(&lo)
 	}
-}
-
-// interpolateEnv replaces ${env:VAR} with environment variable value
-func interpolateEnv(s string) string {
-	if strings.HasPrefix(s, "${env:") && strings.HasSuffix(s, "}") {
-		varName := strings.TrimPrefix(s, "${env:")
-		varName = strings.TrimSuffix(varName, "}")
-		return os.Getenv(varName)
+	if lo.workspace == "" {
+		lo.workspace = "."
+	}
+	if err := interpolateConfig(&config, lo); err != nil {
+		return nil, err
 	}
-	return s
+
+	return &config, nil
 }
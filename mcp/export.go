@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/package-register/trpc-agent-go-extensions/logger"
@@ -18,9 +19,16 @@ import (
 type ExportOption func(*exportOptions)
 
 type exportOptions struct {
-	toolSchemaPath     string // A: raw tool declarations
-	openAISchemaPath   string // C: OpenAI function-calling format
-	configTemplatePath string // B: mcp.json template with discovered tools
+	toolSchemaPath      string // A: raw tool declarations
+	openAISchemaPath    string // C: OpenAI function-calling format
+	configTemplatePath  string // B: mcp.json template with discovered tools
+	anthropicSchemaPath string // D: Anthropic tool-use format
+	geminiSchemaPath    string // E: Gemini function declarations
+	jsonSchemaPath      string // F: JSON Schema bundle with shared $defs
+	lockfilePath        string // tool-signature lockfile to check against
+	driftMode           DriftMode
+
+	health *HealthConfig // WithHealthCheck
 }
 
 // WithExportToolSchema enables exporting raw tool schema JSON after init.
@@ -38,6 +46,21 @@ func WithExportConfigTemplate(path string) ExportOption {
 	return func(o *exportOptions) { o.configTemplatePath = path }
 }
 
+// WithExportAnthropicSchema enables exporting Anthropic tool-use JSON after init.
+func WithExportAnthropicSchema(path string) ExportOption {
+	return func(o *exportOptions) { o.anthropicSchemaPath = path }
+}
+
+// WithExportGeminiSchema enables exporting Gemini function declarations after init.
+func WithExportGeminiSchema(path string) ExportOption {
+	return func(o *exportOptions) { o.geminiSchemaPath = path }
+}
+
+// WithExportJSONSchemaBundle enables exporting a JSON Schema bundle after init.
+func WithExportJSONSchemaBundle(path string) ExportOption {
+	return func(o *exportOptions) { o.jsonSchemaPath = path }
+}
+
 // ── Export data structures ──
 
 // ToolSchemaExport is the top-level structure for raw tool schema export (A).
@@ -93,13 +116,23 @@ type ConfigTemplateServer struct {
 
 // ExportToolSchema exports all discovered tool declarations to a JSON file (A).
 func ExportToolSchema(ctx context.Context, sets *MCPToolSets, config *MCPConfig, path string) error {
-	export := ToolSchemaExport{
+	return writeJSON(path, NewToolSchemaExport(ctx, sets.ToolSetMap(), config))
+}
+
+// NewToolSchemaExport collects the tool declarations of every tool set,
+// sorted by name. It is the input of the other exporters and of
+// DiffToolSchema.
+func NewToolSchemaExport(ctx context.Context, toolSets map[string]tool.ToolSet, config *MCPConfig) *ToolSchemaExport {
+	export := &ToolSchemaExport{
 		ExportedAt: time.Now().Format(time.RFC3339),
 		Servers:    make(map[string]ServerToolsExport),
 	}
 
-	for name, ts := range sets.toolSets {
-		serverCfg := config.MCPServers[name]
+	for name, ts := range toolSets {
+		var serverCfg MCPServerConfig
+		if config != nil {
+			serverCfg = config.MCPServers[name]
+		}
 		serverExport := ServerToolsExport{
 			URL:       serverCfg.ServerUrl,
 			Transport: serverCfg.Transport,
@@ -111,10 +144,10 @@ func ExportToolSchema(ctx context.Context, sets *MCPToolSets, config *MCPConfig,
 				serverExport.Tools = append(serverExport.Tools, *decl)
 			}
 		}
+		sort.Slice(serverExport.Tools, func(i, j int) bool { return serverExport.Tools[i].Name < serverExport.Tools[j].Name })
 		export.Servers[name] = serverExport
 	}
-
-	return writeJSON(path, export)
+	return export
 }
 
 // ExportOpenAISchema exports tool declarations in OpenAI function-calling format (C).
@@ -208,6 +241,30 @@ func runExports(ctx context.Context, sets *MCPToolSets, config *MCPConfig, opts
 			log.Info("Config template generated", "path", opts.configTemplatePath)
 		}
 	}
+
+	if opts.anthropicSchemaPath != "" {
+		if err := ExportAnthropicSchema(ctx, sets, opts.anthropicSchemaPath); err != nil {
+			log.Error("Failed to export Anthropic schema", "path", opts.anthropicSchemaPath, "error", err)
+		} else {
+			log.Info("Anthropic schema exported", "path", opts.anthropicSchemaPath)
+		}
+	}
+
+	if opts.geminiSchemaPath != "" {
+		if err := ExportGeminiSchema(ctx, sets, opts.geminiSchemaPath); err != nil {
+			log.Error("Failed to export Gemini schema", "path", opts.geminiSchemaPath, "error", err)
+		} else {
+			log.Info("Gemini schema exported", "path", opts.geminiSchemaPath)
+		}
+	}
+
+	if opts.jsonSchemaPath != "" {
+		if err := ExportJSONSchemaBundle(ctx, sets, opts.jsonSchemaPath); err != nil {
+			log.Error("Failed to export JSON Schema bundle", "path", opts.jsonSchemaPath, "error", err)
+		} else {
+			log.Info("JSON Schema bundle exported", "path", opts.jsonSchemaPath)
+		}
+	}
 }
 
 // writeJSON marshals v to JSON and writes to path.
@@ -0,0 +1,246 @@
+package mcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// SchemaDiff lists the tool signature changes between two exports. Tools are
+// identified as "<server>/<tool>".
+type SchemaDiff struct {
+	Added   []string     `json:"added,omitempty"`
+	Removed []string     `json:"removed,omitempty"`
+	Changed []ToolChange `json:"changed,omitempty"`
+}
+
+// ToolChange describes how one tool's declaration changed.
+type ToolChange struct {
+	Tool     string   `json:"tool"`
+	Changes  []string `json:"changes"`
+	Breaking bool     `json:"breaking"`
+}
+
+// Empty reports whether the exports declare the same tools.
+func (d SchemaDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Breaking reports whether existing callers may fail: a tool or parameter
+// was removed, a parameter became required, or a parameter type changed.
+func (d SchemaDiff) Breaking() bool {
+	if len(d.Removed) > 0 {
+		return true
+	}
+	for _, c := range d.Changed {
+		if c.Breaking {
+			return true
+		}
+	}
+	return false
+}
+
+// String renders the diff one change per line.
+func (d SchemaDiff) String() string {
+	var out string
+	for _, name := range d.Added {
+		out += "+ " + name + "\n"
+	}
+	for _, name := range d.Removed {
+		out += "- " + name + "\n"
+	}
+	for _, c := range d.Changed {
+		for _, change := range c.Changes {
+			out += "~ " + c.Tool + ": " + change + "\n"
+		}
+	}
+	return out
+}
+
+// LoadToolSchemaExport reads a file written by ExportToolSchema.
+func LoadToolSchemaExport(path string) (*ToolSchemaExport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tool schema: %w", err)
+	}
+	var export ToolSchemaExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("parse tool schema %s: %w", path, err)
+	}
+	return &export, nil
+}
+
+// DiffToolSchema compares the tool declarations of two raw exports, e.g. of
+// two releases of the upstream MCP servers.
+func DiffToolSchema(oldExport, newExport *ToolSchemaExport) SchemaDiff {
+	oldTools, newTools := declarationsByKey(oldExport), declarationsByKey(newExport)
+
+	var d SchemaDiff
+	for key, nd := range newTools {
+		od, ok := oldTools[key]
+		if !ok {
+			d.Added = append(d.Added, key)
+			continue
+		}
+		if c := diffDeclaration(key, od, nd); len(c.Changes) > 0 {
+			d.Changed = append(d.Changed, c)
+		}
+	}
+	for key := range oldTools {
+		if _, ok := newTools[key]; !ok {
+			d.Removed = append(d.Removed, key)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Tool < d.Changed[j].Tool })
+	return d
+}
+
+func declarationsByKey(export *ToolSchemaExport) map[string]tool.Declaration {
+	out := make(map[string]tool.Declaration)
+	if export == nil {
+		return out
+	}
+	for server, srv := range export.Servers {
+		for _, decl := range srv.Tools {
+			out[server+"/"+decl.Name] = decl
+		}
+	}
+	return out
+}
+
+func diffDeclaration(key string, od, nd tool.Declaration) ToolChange {
+	c := ToolChange{Tool: key}
+	if od.Description != nd.Description {
+		c.Changes = append(c.Changes, "description changed")
+	}
+	diffSchema(&c, "", od.InputSchema, nd.InputSchema)
+	if canonicalSchema(od.OutputSchema) != canonicalSchema(nd.OutputSchema) {
+		c.Changes = append(c.Changes, "output schema changed")
+	}
+	return c
+}
+
+// diffSchema records parameter-level changes below prefix. Changes it cannot
+// name precisely are reported as "schema changed".
+func diffSchema(c *ToolChange, prefix string, oldS, newS *tool.Schema) {
+	if canonicalSchema(oldS) == canonicalSchema(newS) {
+		return
+	}
+	where := "input"
+	if prefix != "" {
+		where = "parameter " + prefix
+	}
+	if oldS == nil || newS == nil {
+		c.Changes = append(c.Changes, where+" schema changed")
+		c.Breaking = c.Breaking || newS != nil && len(newS.Required) > 0
+		return
+	}
+
+	reported := len(c.Changes)
+	if oldS.Type != newS.Type {
+		c.Changes = append(c.Changes, fmt.Sprintf("%s type %s → %s", where, orAny(oldS.Type), orAny(newS.Type)))
+		c.Breaking = true
+	}
+	if oldS.Description != newS.Description && prefix != "" {
+		c.Changes = append(c.Changes, where+" description changed")
+	}
+	if oldEnum, newEnum := enumStrings(oldS.Enum), enumStrings(newS.Enum); !slices.Equal(oldEnum, newEnum) {
+		c.Changes = append(c.Changes, where+" enum changed")
+		c.Breaking = c.Breaking || enumNarrowed(oldEnum, newEnum)
+	}
+
+	for _, name := range unionKeys(oldS.Properties, newS.Properties) {
+		path := joinParam(prefix, name)
+		op, np := oldS.Properties[name], newS.Properties[name]
+		switch {
+		case op == nil:
+			c.Changes = append(c.Changes, "parameter "+path+" added")
+			if slices.Contains(newS.Required, name) {
+				c.Breaking = true
+			}
+		case np == nil:
+			c.Changes = append(c.Changes, "parameter "+path+" removed")
+			c.Breaking = true
+		default:
+			diffSchema(c, path, op, np)
+		}
+		wasReq, isReq := slices.Contains(oldS.Required, name), slices.Contains(newS.Required, name)
+		switch {
+		case op != nil && np != nil && !wasReq && isReq:
+			c.Changes = append(c.Changes, "parameter "+path+" now required")
+			c.Breaking = true
+		case op != nil && np != nil && wasReq && !isReq:
+			c.Changes = append(c.Changes, "parameter "+path+" no longer required")
+		}
+	}
+	if oldS.Items != nil || newS.Items != nil {
+		diffSchema(c, joinParam(prefix, "[]"), oldS.Items, newS.Items)
+	}
+	if len(c.Changes) == reported {
+		c.Changes = append(c.Changes, where+" schema changed")
+	}
+}
+
+func joinParam(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	if name == "[]" {
+		return prefix + "[]"
+	}
+	return prefix + "." + name
+}
+
+func unionKeys(a, b map[string]*tool.Schema) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	for k := range a {
+		seen[k] = true
+	}
+	for k := range b {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func enumStrings(values []any) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = fmt.Sprint(v)
+	}
+	return out
+}
+
+// enumNarrowed reports whether newEnum rejects a value oldEnum accepted: an
+// enum is introduced on a free parameter or an allowed value is removed.
+func enumNarrowed(oldEnum, newEnum []string) bool {
+	if len(newEnum) == 0 {
+		return false
+	}
+	if len(oldEnum) == 0 {
+		return true
+	}
+	for _, v := range oldEnum {
+		if !slices.Contains(newEnum, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func orAny(t string) string {
+	if t == "" {
+		return "any"
+	}
+	return t
+}
@@ -0,0 +1,360 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// ── Anthropic tool-use format (D) ──
+
+// AnthropicSchemaExport is the top-level structure for Anthropic tool export.
+type AnthropicSchemaExport struct {
+	ExportedAt string          `json:"exported_at"`
+	Tools      []AnthropicTool `json:"tools"`
+}
+
+// AnthropicTool is one tool in the Anthropic Messages API "tools" format.
+type AnthropicTool struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	InputSchema *tool.Schema `json:"input_schema"`
+}
+
+// ExportAnthropicSchema exports tool declarations in Anthropic tool-use format (D).
+func ExportAnthropicSchema(ctx context.Context, sets *MCPToolSets, path string) error {
+	return writeJSON(path, BuildAnthropicSchema(NewToolSchemaExport(ctx, sets.ToolSetMap(), nil)))
+}
+
+// BuildAnthropicSchema converts a raw export to Anthropic tool-use format.
+// Tools without an input schema get an empty object schema, which the API
+// requires.
+func BuildAnthropicSchema(export *ToolSchemaExport) AnthropicSchemaExport {
+	out := AnthropicSchemaExport{ExportedAt: export.ExportedAt, Tools: []AnthropicTool{}}
+	for _, decl := range sortedDeclarations(export) {
+		schema := decl.decl.InputSchema
+		if schema == nil {
+			schema = &tool.Schema{Type: "object", Properties: map[string]*tool.Schema{}}
+		}
+		out.Tools = append(out.Tools, AnthropicTool{
+			Name:        decl.decl.Name,
+			Description: decl.decl.Description,
+			InputSchema: schema,
+		})
+	}
+	return out
+}
+
+// ── Gemini function declarations (E) ──
+
+// GeminiSchemaExport is the top-level structure for Gemini tool export.
+type GeminiSchemaExport struct {
+	ExportedAt           string                      `json:"exported_at"`
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"function_declarations"`
+}
+
+// GeminiFunctionDeclaration is one function in Gemini's "tools" format.
+type GeminiFunctionDeclaration struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description,omitempty"`
+	Parameters  *GeminiSchema `json:"parameters,omitempty"`
+}
+
+// GeminiSchema is the OpenAPI subset Gemini accepts: no $ref, $defs,
+// defaults or additionalProperties, and string-only enums.
+type GeminiSchema struct {
+	Type        string                   `json:"type,omitempty"`
+	Description string                   `json:"description,omitempty"`
+	Enum        []string                 `json:"enum,omitempty"`
+	Properties  map[string]*GeminiSchema `json:"properties,omitempty"`
+	Required    []string                 `json:"required,omitempty"`
+	Items       *GeminiSchema            `json:"items,omitempty"`
+}
+
+// maxRefDepth bounds $ref inlining for recursive schemas.
+const maxRefDepth = 8
+
+// ExportGeminiSchema exports tool declarations as Gemini function declarations (E).
+func ExportGeminiSchema(ctx context.Context, sets *MCPToolSets, path string) error {
+	return writeJSON(path, BuildGeminiSchema(NewToolSchemaExport(ctx, sets.ToolSetMap(), nil)))
+}
+
+// BuildGeminiSchema converts a raw export to Gemini function declarations.
+// Local $refs are inlined (recursion is cut at a fixed depth) and
+// unsupported keywords are dropped.
+func BuildGeminiSchema(export *ToolSchemaExport) GeminiSchemaExport {
+	out := GeminiSchemaExport{ExportedAt: export.ExportedAt, FunctionDeclarations: []GeminiFunctionDeclaration{}}
+	for _, decl := range sortedDeclarations(export) {
+		fd := GeminiFunctionDeclaration{Name: decl.decl.Name, Description: decl.decl.Description}
+		if s := decl.decl.InputSchema; s != nil && len(s.Properties) > 0 {
+			fd.Parameters = toGeminiSchema(s, s.Defs, 0)
+		}
+		out.FunctionDeclarations = append(out.FunctionDeclarations, fd)
+	}
+	return out
+}
+
+func toGeminiSchema(s *tool.Schema, defs map[string]*tool.Schema, depth int) *GeminiSchema {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		target := defs[strings.TrimPrefix(s.Ref, "#/$defs/")]
+		if target == nil || depth >= maxRefDepth {
+			return &GeminiSchema{Type: "object", Description: s.Description}
+		}
+		g := toGeminiSchema(target, defs, depth+1)
+		if s.Description != "" {
+			g.Description = s.Description
+		}
+		return g
+	}
+
+	g := &GeminiSchema{Type: s.Type, Description: s.Description}
+	for _, v := range s.Enum {
+		g.Enum = append(g.Enum, fmt.Sprint(v))
+	}
+	if len(g.Enum) > 0 && g.Type == "" {
+		g.Type = "string"
+	}
+	if len(s.Properties) > 0 {
+		g.Properties = make(map[string]*GeminiSchema, len(s.Properties))
+		for name, p := range s.Properties {
+			g.Properties[name] = toGeminiSchema(p, defs, depth)
+		}
+		g.Required = s.Required
+	}
+	g.Items = toGeminiSchema(s.Items, defs, depth)
+	return g
+}
+
+// ── JSON Schema bundle (F) ──
+
+// JSONSchemaBundleURI is the JSON Schema dialect of the bundle.
+const JSONSchemaBundleURI = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchemaBundle is a standalone JSON Schema document. Each tool's input
+// schema is a definition named "<server>.<tool>"; object schemas shared by
+// several tools are deduplicated into common definitions referenced with
+// $ref.
+type JSONSchemaBundle struct {
+	Schema     string                  `json:"$schema"`
+	ExportedAt string                  `json:"$comment,omitempty"`
+	Defs       map[string]*tool.Schema `json:"$defs"`
+}
+
+// ExportJSONSchemaBundle exports all tool input schemas as a JSON Schema bundle (F).
+func ExportJSONSchemaBundle(ctx context.Context, sets *MCPToolSets, path string) error {
+	return writeJSON(path, BuildJSONSchemaBundle(NewToolSchemaExport(ctx, sets.ToolSetMap(), nil)))
+}
+
+// BuildJSONSchemaBundle converts a raw export to a JSON Schema bundle.
+// Definitions local to a tool are hoisted as "<server>.<tool>.<name>", then
+// every object schema that occurs more than once across the bundle is moved
+// to a shared definition named after the property it first appeared under.
+func BuildJSONSchemaBundle(export *ToolSchemaExport) JSONSchemaBundle {
+	bundle := JSONSchemaBundle{
+		Schema:     JSONSchemaBundleURI,
+		ExportedAt: "exported at " + export.ExportedAt,
+		Defs:       make(map[string]*tool.Schema),
+	}
+
+	// Hoist tool inputs and their local $defs.
+	for _, d := range sortedDeclarations(export) {
+		key := d.server + "." + d.decl.Name
+		schema := cloneSchema(d.decl.InputSchema)
+		if schema == nil {
+			schema = &tool.Schema{Type: "object"}
+		}
+		if schema.Description == "" {
+			schema.Description = d.decl.Description
+		}
+		local := schema.Defs
+		schema.Defs = nil
+		rename := func(ref string) string {
+			if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok && local[name] != nil {
+				return "#/$defs/" + key + "." + name
+			}
+			return ref
+		}
+		rewriteRefs(schema, rename)
+		for name, def := range local {
+			rewriteRefs(def, rename)
+			bundle.Defs[key+"."+name] = def
+		}
+		bundle.Defs[key] = schema
+	}
+
+	// Count object schemas below the definition roots.
+	keys := sortedSchemaKeys(bundle.Defs)
+	counts := make(map[string]int)
+	first := make(map[string]*tool.Schema)
+	hint := make(map[string]string)
+	for _, key := range keys {
+		walkSchemas(bundle.Defs[key], "", func(s *tool.Schema, prop string) {
+			if len(s.Properties) == 0 {
+				return
+			}
+			c := canonicalSchema(s)
+			counts[c]++
+			if _, ok := first[c]; !ok {
+				first[c], hint[c] = cloneSchema(s), prop
+			}
+		})
+	}
+
+	names := make(map[string]string) // canonical JSON → shared definition
+	var shared []string
+	for c, n := range counts {
+		if n > 1 {
+			shared = append(shared, c)
+		}
+	}
+	sort.Strings(shared)
+	for _, c := range shared {
+		names[c] = uniqueDefName(bundle.Defs, defNameFromHint(hint[c]))
+		bundle.Defs[names[c]] = nil // reserve
+	}
+	for _, c := range shared {
+		bundle.Defs[names[c]] = dedupeSchema(first[c], names, true)
+	}
+	for _, key := range keys {
+		bundle.Defs[key] = dedupeSchema(bundle.Defs[key], names, true)
+	}
+	return bundle
+}
+
+// dedupeSchema replaces shared subschemas of s with $refs. The root itself
+// is never replaced when root is true.
+func dedupeSchema(s *tool.Schema, names map[string]string, root bool) *tool.Schema {
+	if s == nil {
+		return nil
+	}
+	if !root && len(s.Properties) > 0 {
+		if name, ok := names[canonicalSchema(s)]; ok {
+			return &tool.Schema{Ref: "#/$defs/" + name}
+		}
+	}
+	for k, p := range s.Properties {
+		s.Properties[k] = dedupeSchema(p, names, false)
+	}
+	s.Items = dedupeSchema(s.Items, names, false)
+	return s
+}
+
+// walkSchemas calls fn for every subschema below s (not s itself), with the
+// name of the property it appears under (the parent's for array items).
+func walkSchemas(s *tool.Schema, prop string, fn func(*tool.Schema, string)) {
+	if s == nil {
+		return
+	}
+	for _, k := range sortedSchemaKeys(s.Properties) {
+		p := s.Properties[k]
+		if p == nil {
+			continue
+		}
+		fn(p, k)
+		walkSchemas(p, k, fn)
+	}
+	if s.Items != nil {
+		fn(s.Items, prop)
+		walkSchemas(s.Items, prop, fn)
+	}
+}
+
+func rewriteRefs(s *tool.Schema, rename func(string) string) {
+	if s == nil {
+		return
+	}
+	if s.Ref != "" {
+		s.Ref = rename(s.Ref)
+	}
+	for _, p := range s.Properties {
+		rewriteRefs(p, rename)
+	}
+	rewriteRefs(s.Items, rename)
+	for _, d := range s.Defs {
+		rewriteRefs(d, rename)
+	}
+}
+
+// defNameFromHint turns a property name such as "clock_config" into a
+// definition name such as "ClockConfig".
+func defNameFromHint(hint string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(hint, func(r rune) bool { return r == '_' || r == '-' || r == '.' || r == ' ' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	if b.Len() == 0 {
+		return "Shared"
+	}
+	return b.String()
+}
+
+func uniqueDefName(defs map[string]*tool.Schema, base string) string {
+	name := base
+	for i := 2; ; i++ {
+		if _, taken := defs[name]; !taken {
+			return name
+		}
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// ── Helpers ──
+
+type serverDeclaration struct {
+	server string
+	decl   tool.Declaration
+}
+
+// sortedDeclarations flattens an export, ordered by server then tool name.
+func sortedDeclarations(export *ToolSchemaExport) []serverDeclaration {
+	var out []serverDeclaration
+	for server, srv := range export.Servers {
+		for _, decl := range srv.Tools {
+			out = append(out, serverDeclaration{server: server, decl: decl})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].server != out[j].server {
+			return out[i].server < out[j].server
+		}
+		return out[i].decl.Name < out[j].decl.Name
+	})
+	return out
+}
+
+func sortedSchemaKeys(m map[string]*tool.Schema) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// canonicalSchema returns a stable JSON encoding of s (map keys are sorted
+// by encoding/json).
+func canonicalSchema(s *tool.Schema) string {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func cloneSchema(s *tool.Schema) *tool.Schema {
+	if s == nil {
+		return nil
+	}
+	var out tool.Schema
+	if err := json.Unmarshal([]byte(canonicalSchema(s)), &out); err != nil {
+		return nil
+	}
+	return &out
+}
@@ -0,0 +1,200 @@
+package mcp
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+func clockSchema() *tool.Schema {
+	return &tool.Schema{
+		Type: "object",
+		Properties: map[string]*tool.Schema{
+			"period_ns": {Type: "number"},
+			"edge":      {Type: "string", Enum: []any{"rise", "fall"}},
+		},
+		Required: []string{"period_ns"},
+	}
+}
+
+func sampleExport() *ToolSchemaExport {
+	return &ToolSchemaExport{
+		ExportedAt: "2026-01-01T00:00:00Z",
+		Servers: map[string]ServerToolsExport{
+			"eda": {Tools: []tool.Declaration{
+				{
+					Name:        "run_sim",
+					Description: "Run a simulation",
+					InputSchema: &tool.Schema{
+						Type: "object",
+						Properties: map[string]*tool.Schema{
+							"top":          {Type: "string"},
+							"clock_config": clockSchema(),
+							"corner":       {Ref: "#/$defs/Corner"},
+						},
+						Required: []string{"top"},
+						Defs: map[string]*tool.Schema{
+							"Corner": {Type: "string", Enum: []any{"tt", "ss", "ff"}},
+						},
+					},
+				},
+				{
+					Name: "synth",
+					InputSchema: &tool.Schema{
+						Type:       "object",
+						Properties: map[string]*tool.Schema{"clock_config": clockSchema()},
+					},
+				},
+			}},
+			"fs": {Tools: []tool.Declaration{{Name: "list"}}},
+		},
+	}
+}
+
+func TestBuildAnthropicSchema(t *testing.T) {
+	out := BuildAnthropicSchema(sampleExport())
+	if len(out.Tools) != 3 || out.Tools[0].Name != "run_sim" || out.Tools[2].Name != "list" {
+		t.Fatalf("unexpected tools %+v", out.Tools)
+	}
+	if out.Tools[2].InputSchema == nil || out.Tools[2].InputSchema.Type != "object" {
+		t.Error("tools without schema need an empty object input_schema")
+	}
+	data, _ := json.Marshal(out.Tools[0])
+	if !strings.Contains(string(data), `"input_schema"`) {
+		t.Errorf("missing input_schema: %s", data)
+	}
+}
+
+func TestBuildGeminiSchema(t *testing.T) {
+	out := BuildGeminiSchema(sampleExport())
+	fd := out.FunctionDeclarations[0]
+	if fd.Name != "run_sim" || fd.Parameters == nil {
+		t.Fatalf("unexpected declaration %+v", fd)
+	}
+	corner := fd.Parameters.Properties["corner"]
+	if corner == nil || corner.Type != "string" || strings.Join(corner.Enum, ",") != "tt,ss,ff" {
+		t.Errorf("$ref not inlined: %+v", corner)
+	}
+	if out.FunctionDeclarations[2].Parameters != nil {
+		t.Error("tools without parameters must omit them")
+	}
+	data, _ := json.Marshal(out)
+	for _, banned := range []string{"$ref", "$defs"} {
+		if strings.Contains(string(data), banned) {
+			t.Errorf("gemini output contains %s", banned)
+		}
+	}
+}
+
+func TestBuildGeminiSchema_RecursiveRef(t *testing.T) {
+	export := &ToolSchemaExport{Servers: map[string]ServerToolsExport{"x": {Tools: []tool.Declaration{{
+		Name: "tree",
+		InputSchema: &tool.Schema{
+			Type:       "object",
+			Properties: map[string]*tool.Schema{"root": {Ref: "#/$defs/Node"}},
+			Defs: map[string]*tool.Schema{"Node": {
+				Type:       "object",
+				Properties: map[string]*tool.Schema{"child": {Ref: "#/$defs/Node"}},
+			}},
+		},
+	}}}}}
+	if out := BuildGeminiSchema(export); out.FunctionDeclarations[0].Parameters == nil {
+		t.Fatal("expected parameters")
+	}
+}
+
+func TestBuildJSONSchemaBundle_DedupesSharedSchemas(t *testing.T) {
+	bundle := BuildJSONSchemaBundle(sampleExport())
+	if bundle.Schema != JSONSchemaBundleURI {
+		t.Errorf("$schema = %s", bundle.Schema)
+	}
+	for _, key := range []string{"eda.run_sim", "eda.synth", "fs.list", "eda.run_sim.Corner", "ClockConfig"} {
+		if bundle.Defs[key] == nil {
+			t.Errorf("missing $defs/%s", key)
+		}
+	}
+	run := bundle.Defs["eda.run_sim"]
+	if ref := run.Properties["clock_config"].Ref; ref != "#/$defs/ClockConfig" {
+		t.Errorf("clock_config ref = %q", ref)
+	}
+	if ref := bundle.Defs["eda.synth"].Properties["clock_config"].Ref; ref != "#/$defs/ClockConfig" {
+		t.Errorf("synth clock_config ref = %q", ref)
+	}
+	if ref := run.Properties["corner"].Ref; ref != "#/$defs/eda.run_sim.Corner" {
+		t.Errorf("local ref not rewritten: %q", ref)
+	}
+	if run.Defs != nil {
+		t.Error("local $defs must be hoisted")
+	}
+	if run.Description != "Run a simulation" {
+		t.Errorf("description = %q", run.Description)
+	}
+}
+
+func TestDiffToolSchema(t *testing.T) {
+	oldExport := sampleExport()
+	newExport := sampleExport()
+	eda := newExport.Servers["eda"]
+	eda.Tools = append([]tool.Declaration(nil), eda.Tools...)
+	run := eda.Tools[0]
+	run.InputSchema = cloneSchema(run.InputSchema)
+	run.InputSchema.Properties["top"].Type = "array"
+	delete(run.InputSchema.Properties, "corner")
+	run.InputSchema.Properties["seed"] = &tool.Schema{Type: "integer"}
+	run.InputSchema.Required = append(run.InputSchema.Required, "clock_config")
+	eda.Tools[0] = run
+	eda.Tools = append(eda.Tools, tool.Declaration{Name: "lint"})
+	newExport.Servers["eda"] = eda
+	delete(newExport.Servers, "fs")
+
+	d := DiffToolSchema(oldExport, newExport)
+	if strings.Join(d.Added, ",") != "eda/lint" || strings.Join(d.Removed, ",") != "fs/list" {
+		t.Errorf("added=%v removed=%v", d.Added, d.Removed)
+	}
+	if len(d.Changed) != 1 || d.Changed[0].Tool != "eda/run_sim" || !d.Breaking() {
+		t.Fatalf("unexpected changes %+v", d.Changed)
+	}
+	got := strings.Join(d.Changed[0].Changes, "\n")
+	for _, want := range []string{
+		"parameter clock_config now required",
+		"parameter corner removed",
+		"parameter seed added",
+		"parameter top type string → array",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+
+	if d := DiffToolSchema(sampleExport(), sampleExport()); !d.Empty() {
+		t.Errorf("expected empty diff, got %s", d)
+	}
+}
+
+func TestDiffToolSchema_EnumChanges(t *testing.T) {
+	param := func(enum ...any) *tool.Schema {
+		return &tool.Schema{Type: "object", Properties: map[string]*tool.Schema{
+			"corner": {Type: "string", Enum: enum},
+		}}
+	}
+	for _, tc := range []struct {
+		name     string
+		old, new *tool.Schema
+		breaking bool
+	}{
+		{"value added", param("tt", "ss"), param("tt", "ss", "ff"), false},
+		{"values reordered", param("tt", "ss"), param("ss", "tt"), false},
+		{"enum dropped", param("tt", "ss"), param(), false},
+		{"value removed", param("tt", "ss"), param("tt"), true},
+		{"enum introduced", param(), param("tt"), true},
+	} {
+		var c ToolChange
+		diffSchema(&c, "", tc.old, tc.new)
+		if !slices.Contains(c.Changes, "parameter corner enum changed") || c.Breaking != tc.breaking {
+			t.Errorf("%s: changes=%v breaking=%v, want breaking=%v", tc.name, c.Changes, c.Breaking, tc.breaking)
+		}
+	}
+}
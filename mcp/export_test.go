@@ -8,7 +8,6 @@ import (
 	"testing"
 
 	"trpc.group/trpc-go/trpc-agent-go/tool"
-	"trpc.group/trpc-go/trpc-agent-go/tool/mcp"
 )
 
 // mockMCPToolSets creates a MCPToolSets with no real connections for unit testing export functions.
@@ -135,7 +134,7 @@ func TestWriteJSON_InvalidPath(t *testing.T) {
 func TestExportWithMockData(t *testing.T) {
 	// Test export functions with in-memory mock data (no real MCP connection)
 	sets := &MCPToolSets{
-		toolSets: make(map[string]*mcp.ToolSet),
+		toolSets: make(map[string]tool.ToolSet),
 	}
 	config := &MCPConfig{
 		MCPServers: map[string]MCPServerConfig{},
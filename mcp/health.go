@@ -0,0 +1,416 @@
+// Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// CircuitState is the circuit-breaker state of a health-checked server.
+type CircuitState string
+
+const (
+	// CircuitClosed: the server is healthy and calls pass through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen: the server is unavailable; calls fail fast until a
+	// reconnection succeeds.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen: a reconnection attempt is in progress.
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// HealthConfig configures health probes, reconnection and the circuit breaker.
+// Zero values fall back to the defaults noted on each field.
+type HealthConfig struct {
+	Interval         time.Duration // probe period while healthy (default 30s)
+	ProbeTimeout     time.Duration // timeout of a single probe or reconnect (default 10s)
+	FailureThreshold int           // consecutive failures that open the circuit (default 3)
+	BackoffInitial   time.Duration // first reconnect delay (default 1s)
+	BackoffMax       time.Duration // reconnect delay cap (default 1m)
+}
+
+func (c HealthConfig) withDefaults() HealthConfig {
+	if c.Interval <= 0 {
+		c.Interval = 30 * time.Second
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = 10 * time.Second
+	}
+	if c.FailureThreshold <= 0 {
+		c.FailureThreshold = 3
+	}
+	if c.BackoffInitial <= 0 {
+		c.BackoffInitial = time.Second
+	}
+	if c.BackoffMax <= 0 {
+		c.BackoffMax = time.Minute
+	}
+	return c
+}
+
+// ToolSetFactory creates and initializes a fresh tool set for a server.
+type ToolSetFactory func(ctx context.Context) (tool.ToolSet, error)
+
+// HealthCheckedToolSet implements tool.ToolSet.
+// It wraps the tool set of one MCP server with periodic health probes
+// (ListTools via Init, or Tools), exponential-backoff reconnection and a
+// circuit breaker. Consecutive probe or connection failures open the circuit;
+// while open, tool calls fail fast with a pipeline.ToolError carrying
+// ErrCodeToolUnavailable, so fallback routing can react. A successful
+// reconnection replaces the inner tool set and closes the circuit.
+type HealthCheckedToolSet struct {
+	name    string
+	factory ToolSetFactory
+	cfg     HealthConfig
+	now     func() time.Time
+
+	mu          sync.RWMutex
+	inner       tool.ToolSet
+	tools       []tool.Tool
+	callables   map[string]tool.CallableTool
+	state       CircuitState
+	failures    int
+	backoff     time.Duration
+	nextAttempt time.Time
+	cancel      context.CancelFunc
+	closed      bool   // set by Close; a late reconnection is discarded
+	setName     string // Name of the inner tool set, kept after Close
+}
+
+// NewHealthCheckedToolSet creates the initial tool set with factory. Call
+// Start to begin background probing.
+func NewHealthCheckedToolSet(ctx context.Context, name string, factory ToolSetFactory, cfg HealthConfig) (*HealthCheckedToolSet, error) {
+	inner, err := factory(ctx)
+	if err != nil {
+		return nil, err
+	}
+	h := &HealthCheckedToolSet{
+		name:    name,
+		factory: factory,
+		cfg:     cfg.withDefaults(),
+		now:     time.Now,
+		state:   CircuitClosed,
+	}
+	tools, callables := h.wrapTools(ctx, inner)
+	h.install(inner, tools, callables)
+	return h, nil
+}
+
+// WithHealthCheck wraps every server of NewMCPToolSetsFromStruct in a
+// HealthCheckedToolSet with the given configuration, like
+// Manager.SetHealthCheck. MCPToolSets.Close stops the probes.
+func WithHealthCheck(cfg HealthConfig) ExportOption {
+	return func(o *exportOptions) { o.health = &cfg }
+}
+
+// startHealthChecked wraps an initialized server tool set in a
+// HealthCheckedToolSet that reconnects with start, and starts probing.
+func startHealthChecked(ctx context.Context, name string, initial tool.ToolSet, start ToolSetFactory, cfg HealthConfig) *HealthCheckedToolSet {
+	h, _ := NewHealthCheckedToolSet(ctx, name, func(context.Context) (tool.ToolSet, error) {
+		return initial, nil
+	}, cfg)
+	h.factory = start
+	// Probes outlive the caller's context; Close stops them.
+	h.Start(context.Background())
+	return h
+}
+
+// Start runs health probes and reconnection attempts in the background until
+// ctx is cancelled or Close is called.
+func (h *HealthCheckedToolSet) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	h.mu.Lock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+	h.cancel = cancel
+	h.mu.Unlock()
+
+	go func() {
+		timer := time.NewTimer(h.cfg.Interval)
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				_ = h.Check(ctx)
+				timer.Reset(h.untilNextCheck())
+			}
+		}
+	}()
+}
+
+// Check runs one probe, or one reconnection attempt when the circuit is open
+// and the backoff has elapsed. It returns the probe or reconnection error.
+func (h *HealthCheckedToolSet) Check(ctx context.Context) error {
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return errors.New("tool set closed")
+	}
+	state, inner := h.state, h.inner
+	if state != CircuitClosed {
+		if h.now().Before(h.nextAttempt) {
+			h.mu.Unlock()
+			return h.unavailable(nil)
+		}
+		h.state = CircuitHalfOpen
+	}
+	h.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.ProbeTimeout)
+	defer cancel()
+
+	if state == CircuitClosed {
+		if err := probe(ctx, inner); err != nil {
+			h.recordFailure(err)
+			return err
+		}
+		h.recordSuccess()
+		return nil
+	}
+	return h.reconnect(ctx)
+}
+
+// State returns the current circuit state.
+func (h *HealthCheckedToolSet) State() CircuitState {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.state
+}
+
+// Tools implements tool.ToolSet. It returns the last known tools, each
+// guarded by the circuit breaker, so declarations stay stable while the
+// server is unavailable.
+func (h *HealthCheckedToolSet) Tools(_ context.Context) []tool.Tool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]tool.Tool, len(h.tools))
+	copy(out, h.tools)
+	return out
+}
+
+// Name implements tool.ToolSet. It reports the inner tool set's name, so that
+// tool names seen by the model do not change when health checks are enabled.
+func (h *HealthCheckedToolSet) Name() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.setName
+}
+
+// Close implements tool.ToolSet. It stops probing and closes the inner tool set.
+func (h *HealthCheckedToolSet) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	if h.cancel != nil {
+		h.cancel()
+		h.cancel = nil
+	}
+	if h.inner == nil {
+		return nil
+	}
+	err := h.inner.Close()
+	h.inner = nil
+	return err
+}
+
+// call routes a tool call to the current inner tool set.
+func (h *HealthCheckedToolSet) call(ctx context.Context, toolName string, args []byte) (any, error) {
+	h.mu.RLock()
+	state, callable := h.state, h.callables[toolName]
+	h.mu.RUnlock()
+	if state != CircuitClosed {
+		return nil, h.unavailable(nil)
+	}
+	if callable == nil {
+		return nil, pipeline.ToolError{
+			Code: pipeline.ErrCodeToolUnavailable,
+			Err:  fmt.Errorf("mcp server %s: tool %s not found", h.name, toolName),
+		}
+	}
+
+	result, err := callable.Call(ctx, args)
+	if err != nil && isConnectionError(err) {
+		h.recordFailure(err)
+		return nil, h.unavailable(err)
+	}
+	return result, err
+}
+
+func (h *HealthCheckedToolSet) reconnect(ctx context.Context) error {
+	inner, err := h.factory(ctx)
+	if err != nil {
+		h.mu.Lock()
+		h.state = CircuitOpen
+		h.backoff = min(h.backoff*2, h.cfg.BackoffMax)
+		h.nextAttempt = h.now().Add(h.backoff)
+		h.mu.Unlock()
+		logger.L().Warn("MCP server reconnect failed", "name", h.name, "retry_in", h.backoff, "error", err)
+		return err
+	}
+
+	// The swap is checked against Close under the lock: a reconnection that
+	// finishes after Close must not install (and leak) the new server.
+	tools, callables := h.wrapTools(ctx, inner)
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		if err := inner.Close(); err != nil {
+			logger.L().Warn("MCP error closing", "name", h.name, "error", err)
+		}
+		return errors.New("tool set closed")
+	}
+	old := h.inner
+	h.install(inner, tools, callables)
+	h.failures = 0
+	h.backoff = 0
+	h.state = CircuitClosed
+	h.mu.Unlock()
+
+	if old != nil {
+		if err := old.Close(); err != nil {
+			logger.L().Warn("MCP error closing", "name", h.name, "error", err)
+		}
+	}
+	logger.L().Info("MCP server reconnected", "name", h.name)
+	return nil
+}
+
+// wrapTools builds the guarded tool list of an inner tool set.
+func (h *HealthCheckedToolSet) wrapTools(ctx context.Context, inner tool.ToolSet) ([]tool.Tool, map[string]tool.CallableTool) {
+	innerTools := inner.Tools(ctx)
+	tools := make([]tool.Tool, 0, len(innerTools))
+	callables := make(map[string]tool.CallableTool, len(innerTools))
+	for _, t := range innerTools {
+		decl := t.Declaration()
+		if c, ok := t.(tool.CallableTool); ok {
+			callables[decl.Name] = c
+		}
+		tools = append(tools, &guardedTool{decl: decl, owner: h})
+	}
+	return tools, callables
+}
+
+// install makes inner the current tool set. Callers hold h.mu, except during
+// construction.
+func (h *HealthCheckedToolSet) install(inner tool.ToolSet, tools []tool.Tool, callables map[string]tool.CallableTool) {
+	h.inner = inner
+	h.setName = inner.Name()
+	if len(tools) > 0 || h.tools == nil {
+		h.tools = tools
+	}
+	h.callables = callables
+}
+
+func (h *HealthCheckedToolSet) recordSuccess() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures = 0
+	h.backoff = 0
+	h.state = CircuitClosed
+}
+
+func (h *HealthCheckedToolSet) recordFailure(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.failures++
+	if h.state == CircuitClosed && h.failures < h.cfg.FailureThreshold {
+		logger.L().Warn("MCP server health check failed", "name", h.name, "failures", h.failures, "error", err)
+		return
+	}
+	if h.state == CircuitClosed {
+		logger.L().Error("MCP server unavailable, circuit opened", "name", h.name, "error", err)
+	}
+	h.state = CircuitOpen
+	h.backoff = h.cfg.BackoffInitial
+	h.nextAttempt = h.now().Add(h.backoff)
+}
+
+// untilNextCheck returns the delay before the next probe or reconnect attempt.
+func (h *HealthCheckedToolSet) untilNextCheck() time.Duration {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.state == CircuitClosed {
+		return h.cfg.Interval
+	}
+	if d := h.nextAttempt.Sub(h.now()); d > 0 {
+		return d
+	}
+	return time.Millisecond
+}
+
+func (h *HealthCheckedToolSet) unavailable(cause error) error {
+	err := fmt.Errorf("mcp server %s unavailable (circuit %s)", h.name, h.State())
+	if cause != nil {
+		err = fmt.Errorf("%w: %w", err, cause)
+	}
+	return pipeline.ToolError{Code: pipeline.ErrCodeToolUnavailable, Err: err}
+}
+
+// probe checks a tool set's server. *mcp.ToolSet exposes ListTools errors
+// through Init; other tool sets are probed by listing their tools.
+func probe(ctx context.Context, ts tool.ToolSet) error {
+	if ts == nil {
+		return errors.New("no active tool set")
+	}
+	if initer, ok := ts.(interface{ Init(context.Context) error }); ok {
+		return initer.Init(ctx)
+	}
+	ts.Tools(ctx)
+	return ctx.Err()
+}
+
+// connectionErrorPatterns identify errors caused by a lost server connection
+// rather than by the tool itself.
+// ClassifyToolError already maps refused/reset/broken connections.
+var connectionErrorPatterns = []string{
+	"not initialized",
+	"session not found",
+}
+
+func isConnectionError(err error) bool {
+	if pipeline.ClassifyToolError(err) == pipeline.ErrCodeToolUnavailable {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, p := range connectionErrorPatterns {
+		if strings.Contains(msg, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// guardedTool is a tool of a HealthCheckedToolSet; calls go through the
+// circuit breaker to the current inner tool set.
+type guardedTool struct {
+	decl  *tool.Declaration
+	owner *HealthCheckedToolSet
+}
+
+func (g *guardedTool) Declaration() *tool.Declaration { return g.decl }
+
+func (g *guardedTool) Call(ctx context.Context, jsonArgs []byte) (any, error) {
+	return g.owner.call(ctx, g.decl.Name, jsonArgs)
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ tool.ToolSet      = (*HealthCheckedToolSet)(nil)
+	_ tool.CallableTool = (*guardedTool)(nil)
+)
@@ -0,0 +1,171 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// flakyServer simulates an MCP server that can go down.
+type flakyServer struct {
+	down bool
+}
+
+type flakyToolSet struct {
+	server *flakyServer
+	closed bool
+}
+
+func (f *flakyToolSet) Init(context.Context) error {
+	if f.server.down {
+		return errors.New("transport is closed")
+	}
+	return nil
+}
+func (f *flakyToolSet) Tools(context.Context) []tool.Tool { return []tool.Tool{&flakyTool{owner: f}} }
+func (f *flakyToolSet) Close() error                      { f.closed = true; return nil }
+func (f *flakyToolSet) Name() string                      { return "flaky" }
+
+type flakyTool struct {
+	owner *flakyToolSet
+}
+
+func (t *flakyTool) Declaration() *tool.Declaration { return &tool.Declaration{Name: "run_sim"} }
+
+func (t *flakyTool) Call(context.Context, []byte) (any, error) {
+	if t.owner.server.down || t.owner.closed {
+		return nil, errors.New("write |1: broken pipe")
+	}
+	return "ok", nil
+}
+
+func TestHealthCheckedToolSet_CircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	server := &flakyServer{}
+	var created int
+	factory := func(ctx context.Context) (tool.ToolSet, error) {
+		ts := &flakyToolSet{server: server}
+		if err := ts.Init(ctx); err != nil {
+			return nil, err
+		}
+		created++
+		return ts, nil
+	}
+
+	h, err := NewHealthCheckedToolSet(ctx, "sim", factory, HealthConfig{
+		FailureThreshold: 2,
+		BackoffInitial:   time.Second,
+		BackoffMax:       4 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if h.Name() != "flaky" {
+		t.Fatalf("expected the inner tool set name, got %q", h.Name())
+	}
+	now := time.Unix(0, 0)
+	h.now = func() time.Time { return now }
+
+	simTool := h.Tools(ctx)[0].(tool.CallableTool)
+	if res, err := simTool.Call(ctx, nil); err != nil || res != "ok" {
+		t.Fatalf("expected healthy call, got %v %v", res, err)
+	}
+
+	// The server dies: a failed call and a failed probe open the circuit.
+	server.down = true
+	if _, err := simTool.Call(ctx, nil); pipeline.ClassifyToolError(err) != pipeline.ErrCodeToolUnavailable {
+		t.Fatalf("expected tool_unavailable, got %v", err)
+	}
+	if err := h.Check(ctx); err == nil {
+		t.Fatal("expected probe failure")
+	}
+	if h.State() != CircuitOpen {
+		t.Fatalf("expected open circuit, got %s", h.State())
+	}
+
+	// While open, calls fail fast with tool_unavailable.
+	_, err = simTool.Call(ctx, nil)
+	var toolErr pipeline.ToolError
+	if !errors.As(err, &toolErr) || toolErr.Code != pipeline.ErrCodeToolUnavailable {
+		t.Fatalf("expected fail-fast ToolError, got %v", err)
+	}
+
+	// Reconnect attempts wait for the backoff and double it on failure.
+	if err := h.Check(ctx); err == nil || created != 1 {
+		t.Fatal("reconnect must wait for backoff")
+	}
+	now = now.Add(time.Second)
+	if err := h.Check(ctx); err == nil {
+		t.Fatal("expected reconnect failure while server is down")
+	}
+	if h.backoff != 2*time.Second {
+		t.Fatalf("expected backoff 2s, got %s", h.backoff)
+	}
+
+	// The server comes back: the next attempt reconnects and closes the circuit.
+	server.down = false
+	now = now.Add(2 * time.Second)
+	if err := h.Check(ctx); err != nil {
+		t.Fatalf("expected reconnect, got %v", err)
+	}
+	if h.State() != CircuitClosed || created != 2 {
+		t.Fatalf("expected closed circuit with new tool set, got %s (%d created)", h.State(), created)
+	}
+	if res, err := simTool.Call(ctx, nil); err != nil || res != "ok" {
+		t.Fatalf("expected call through reconnected tool set, got %v %v", res, err)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+}
+
+func TestHealthCheckedToolSet_CloseDuringReconnect(t *testing.T) {
+	ctx := context.Background()
+	server := &flakyServer{}
+	initial := &flakyToolSet{server: server}
+	var h *HealthCheckedToolSet
+	var late *flakyToolSet
+	h = startHealthChecked(ctx, "sim", initial, func(context.Context) (tool.ToolSet, error) {
+		// Close wins the race against this reconnection.
+		if err := h.Close(); err != nil {
+			t.Errorf("close: %v", err)
+		}
+		late = &flakyToolSet{server: server}
+		return late, nil
+	}, HealthConfig{FailureThreshold: 1})
+	h.recordFailure(errors.New("broken pipe"))
+	h.nextAttempt = time.Time{}
+
+	if err := h.Check(ctx); err == nil {
+		t.Fatal("expected reconnect after close to fail")
+	}
+	if !initial.closed || late == nil || !late.closed {
+		t.Fatal("expected both tool sets closed")
+	}
+	if h.inner != nil {
+		t.Fatal("closed tool set must not install a new server")
+	}
+}
+
+func TestIsConnectionError(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{fmt.Errorf("read response: %w", io.EOF), true},
+		{fmt.Errorf("read response: %w", io.ErrUnexpectedEOF), true},
+		{errors.New("client not initialized"), true},
+		{errors.New("geofence radius out of range"), false},
+	} {
+		if got := isConnectionError(tc.err); got != tc.want {
+			t.Errorf("isConnectionError(%q) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
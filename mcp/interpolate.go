@@ -0,0 +1,206 @@
+// Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// LoadOption configures how mcp.json is loaded and interpolated.
+type LoadOption func(*loadOptions)
+
+type loadOptions struct {
+	workspace string
+	lookupEnv func(string) (string, bool)
+}
+
+// WithWorkspace sets the value of ${workspace}, which is also the base
+// directory for relative ${file:...} paths.
+func WithWorkspace(dir string) LoadOption {
+	return func(o *loadOptions) { o.workspace = dir }
+}
+
+// WithEnvLookup replaces os.LookupEnv as the source of ${env:...} values.
+func WithEnvLookup(fn func(string) (string, bool)) LoadOption {
+	return func(o *loadOptions) { o.lookupEnv = fn }
+}
+
+// Interpolate expands variable references anywhere inside s:
+//
+//   - ${env:NAME}          environment variable; an error if NAME is unset
+//   - ${env:NAME:-default} default when NAME is unset or empty
+//   - ${file:path}         file contents with trailing newlines trimmed (for
+//     secrets); relative paths are resolved against the workspace
+//   - ${workspace}         the workspace directory
+//   - $${                  a literal "${"
+func Interpolate(s string, opts ...LoadOption) (string, error) {
+	lo := loadOptions{lookupEnv: os.LookupEnv, workspace: "."}
+	for _, o := range opts {
+		o(&lo)
+	}
+	return lo.interpolate(s)
+}
+
+func (lo loadOptions) interpolate(s string) (string, error) {
+	if !strings.Contains(s, "${") {
+		return s, nil
+	}
+	var sb strings.Builder
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			sb.WriteString(s)
+			return sb.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			sb.WriteString(s[:i-1])
+			sb.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference in %q", s)
+		}
+		value, err := lo.resolve(s[i+2 : i+end])
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(s[:i])
+		sb.WriteString(value)
+		s = s[i+end+1:]
+	}
+}
+
+// resolve returns the value of a single reference (without "${" and "}").
+func (lo loadOptions) resolve(ref string) (string, error) {
+	if ref == "workspace" {
+		return lo.workspace, nil
+	}
+	kind, arg, ok := strings.Cut(ref, ":")
+	if !ok || arg == "" {
+		return "", fmt.Errorf("invalid reference ${%s}", ref)
+	}
+	switch kind {
+	case "env":
+		name, def, hasDefault := strings.Cut(arg, ":-")
+		value, set := lo.lookupEnv(name)
+		if hasDefault && value == "" {
+			return def, nil
+		}
+		if !set {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case "file":
+		p := arg
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(lo.workspace, p)
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return "", fmt.Errorf("read ${file:%s}: %w", arg, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return "", fmt.Errorf("unknown reference ${%s} (supported: env, file, workspace)", ref)
+	}
+}
+
+// interpolateConfig expands references in every string field of the enabled
+// servers. Disabled servers are left as written, so they may reference
+// variables that are not set. All unresolved references are reported together.
+func interpolateConfig(config *MCPConfig, lo loadOptions) error {
+	names := make([]string, 0, len(config.MCPServers))
+	for name := range config.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		serverCfg := config.MCPServers[name]
+		if serverCfg.Disabled {
+			continue
+		}
+		field := func(path string, v *string) {
+			out, err := lo.interpolate(*v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("mcpServers.%s.%s: %w", name, path, err))
+				return
+			}
+			*v = out
+		}
+
+		field("transport", &serverCfg.Transport)
+		field("command", &serverCfg.Command)
+		field("serverUrl", &serverCfg.ServerUrl)
+		serverCfg.Args = append([]string(nil), serverCfg.Args...)
+		for i := range serverCfg.Args {
+			field(fmt.Sprintf("args[%d]", i), &serverCfg.Args[i])
+		}
+		serverCfg.Tools = append([]string(nil), serverCfg.Tools...)
+		for i := range serverCfg.Tools {
+			field(fmt.Sprintf("tools[%d]", i), &serverCfg.Tools[i])
+		}
+		serverCfg.Deny = append([]string(nil), serverCfg.Deny...)
+		for i := range serverCfg.Deny {
+			field(fmt.Sprintf("deny[%d]", i), &serverCfg.Deny[i])
+		}
+		serverCfg.Headers = interpolateMap(serverCfg.Headers, "headers", field)
+		serverCfg.Env = interpolateMap(serverCfg.Env, "env", field)
+
+		// serverCfg is a copy: store it back.
+		config.MCPServers[name] = serverCfg
+	}
+	errs = append(errs, interpolatePolicy(&config.Policy, lo))
+	return errors.Join(errs...)
+}
+
+// interpolatePolicy expands references in argument rule directories and makes
+// relative ones absolute against the workspace.
+func interpolatePolicy(policy *PolicyConfig, lo loadOptions) error {
+	if len(policy.Args) == 0 {
+		return nil
+	}
+	var errs []error
+	args := make(map[string][]ArgRule, len(policy.Args))
+	for pattern, rules := range policy.Args {
+		rules = append([]ArgRule(nil), rules...)
+		for i := range rules {
+			if rules[i].Within == "" {
+				continue
+			}
+			dir, err := lo.interpolate(rules[i].Within)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("policy.args.%s[%d].within: %w", pattern, i, err))
+				continue
+			}
+			if !filepath.IsAbs(dir) {
+				if abs, err := filepath.Abs(filepath.Join(lo.workspace, dir)); err == nil {
+					dir = abs
+				}
+			}
+			rules[i].Within = dir
+		}
+		args[pattern] = rules
+	}
+	policy.Args = args
+	return errors.Join(errs...)
+}
+
+func interpolateMap(m map[string]string, path string, field func(string, *string)) map[string]string {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		field(path+"."+k, &v)
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package mcp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testEnv(vars map[string]string) LoadOption {
+	return WithEnvLookup(func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	})
+}
+
+func TestInterpolate(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token.txt"), []byte("s3cret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := []LoadOption{
+		WithWorkspace(dir),
+		testEnv(map[string]string{"HOST": "eda01", "EMPTY": ""}),
+	}
+
+	cases := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${env:HOST}", "eda01"},
+		{"http://${env:HOST}:8080/mcp", "http://eda01:8080/mcp"},
+		{"${env:PORT:-3000}", "3000"},
+		{"${env:EMPTY:-fallback}", "fallback"},
+		{"${env:EMPTY}", ""},
+		{"Bearer ${file:token.txt}", "Bearer s3cret"},
+		{"${workspace}/bin/sim", dir + "/bin/sim"},
+		{"$${env:HOST} ${env:HOST}", "${env:HOST} eda01"},
+	}
+	for _, c := range cases {
+		got, err := Interpolate(c.in, opts...)
+		if err != nil {
+			t.Errorf("Interpolate(%q): unexpected error %v", c.in, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("Interpolate(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+
+	for _, bad := range []string{"${env:MISSING}", "${file:nope.txt}", "${secret:x}", "${env:HOST", "${env:}"} {
+		if _, err := Interpolate(bad, opts...); err == nil {
+			t.Errorf("Interpolate(%q): expected error", bad)
+		}
+	}
+}
+
+func TestParseConfig_InterpolatesEveryField(t *testing.T) {
+	data := []byte(`{
+  "mcpServers": {
+    "sim": {
+      "transport": "${env:TRANSPORT}",
+      "command": "${workspace}/${env:BIN}",
+      "args": ["--host", "${env:HOST}"],
+      "serverUrl": "http://${env:HOST}:${env:PORT:-3000}",
+      "headers": {"Authorization": "Bearer ${env:TOKEN}"},
+      "env": {"LICENSE": "${env:LIC}@${env:HOST}"},
+      "tools": ["${env:TOOL}"],
+      "deny": ["${env:TOOL}_*"]
+    },
+    "off": {"command": "${env:NOT_SET}", "disabled": true}
+  }
+}`)
+	cfg, err := ParseConfig(data, WithWorkspace("/ws"), testEnv(map[string]string{
+		"TRANSPORT": "stdio", "BIN": "sim", "HOST": "eda01", "TOKEN": "t0k", "LIC": "27000", "TOOL": "run_sim",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	s := cfg.MCPServers["sim"]
+	checks := map[string][2]string{
+		"transport": {s.Transport, "stdio"},
+		"command":   {s.Command, "/ws/sim"},
+		"args":      {strings.Join(s.Args, " "), "--host eda01"},
+		"serverUrl": {s.ServerUrl, "http://eda01:3000"},
+		"headers":   {s.Headers["Authorization"], "Bearer t0k"},
+		"env":       {s.Env["LICENSE"], "27000@eda01"},
+		"tools":     {strings.Join(s.Tools, ","), "run_sim"},
+		"deny":      {strings.Join(s.Deny, ","), "run_sim_*"},
+	}
+	for field, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s = %q, want %q", field, c[0], c[1])
+		}
+	}
+	if cfg.MCPServers["off"].Command != "${env:NOT_SET}" {
+		t.Error("disabled servers should be left uninterpolated")
+	}
+}
+
+func TestParseConfig_UnresolvedVariables(t *testing.T) {
+	data := []byte(`{"mcpServers": {"sim": {"command": "${env:A}", "headers": {"X": "${env:B}"}}}}`)
+	_, err := ParseConfig(data, testEnv(nil))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"mcpServers.sim.command", "mcpServers.sim.headers.X", "A is not set", "B is not set"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+}
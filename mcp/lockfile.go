@@ -0,0 +1,181 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// LockfileVersion is the format version written by WriteLockfile.
+const LockfileVersion = 1
+
+// Lockfile pins the tool names and input schemas of each MCP server.
+// Descriptions are not pinned: rewording a tool is not drift.
+type Lockfile struct {
+	Version int                              `json:"version"`
+	Servers map[string]map[string]LockedTool `json:"servers"`
+}
+
+// LockedTool is the pinned signature of one tool.
+type LockedTool struct {
+	InputSchema *tool.Schema `json:"inputSchema,omitempty"`
+}
+
+// DriftMode selects what happens when live tools differ from the lockfile.
+type DriftMode string
+
+const (
+	// DriftWarn logs every change and continues.
+	DriftWarn DriftMode = "warn"
+	// DriftFail logs every change and fails startup on breaking changes.
+	DriftFail DriftMode = "fail"
+)
+
+// DriftError is returned by CheckLockfile in DriftFail mode when live tool
+// declarations break the lockfile.
+type DriftError struct {
+	Path string
+	Diff SchemaDiff
+}
+
+func (e *DriftError) Error() string {
+	return fmt.Sprintf("mcp tools drifted from %s:\n%s", e.Path, e.Diff)
+}
+
+// WithLockfile checks the live tool declarations against the lockfile at
+// path after init (see CheckLockfile). A missing lockfile is only logged.
+func WithLockfile(path string, mode DriftMode) ExportOption {
+	return func(o *exportOptions) {
+		o.lockfilePath = path
+		o.driftMode = mode
+	}
+}
+
+// NewLockfile pins the tools of a raw export.
+func NewLockfile(export *ToolSchemaExport) *Lockfile {
+	lock := &Lockfile{Version: LockfileVersion, Servers: make(map[string]map[string]LockedTool)}
+	if export == nil {
+		return lock
+	}
+	for server, srv := range export.Servers {
+		tools := make(map[string]LockedTool, len(srv.Tools))
+		for _, decl := range srv.Tools {
+			tools[decl.Name] = LockedTool{InputSchema: decl.InputSchema}
+		}
+		lock.Servers[server] = tools
+	}
+	return lock
+}
+
+// LoadLockfile reads a lockfile.
+func LoadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read lockfile: %w", err)
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("parse lockfile %s: %w", path, err)
+	}
+	if lock.Version != LockfileVersion {
+		return nil, fmt.Errorf("lockfile %s: unsupported version %d", path, lock.Version)
+	}
+	return &lock, nil
+}
+
+// WriteLockfile pins the current tools of sets into path.
+func WriteLockfile(ctx context.Context, sets *MCPToolSets, path string) error {
+	return writeJSON(path, NewLockfile(NewToolSchemaExport(ctx, sets.ToolSetMap(), nil)))
+}
+
+// GenerateLockfile pins the tools of an ExportToolSchema file.
+func GenerateLockfile(schemaPath, lockPath string) error {
+	export, err := LoadToolSchemaExport(schemaPath)
+	if err != nil {
+		return err
+	}
+	return writeJSON(lockPath, NewLockfile(export))
+}
+
+// Diff compares live declarations against the lock. Servers missing from
+// live (e.g. disabled or failed to start) are not compared.
+func (l *Lockfile) Diff(live *ToolSchemaExport) SchemaDiff {
+	locked := l.export()
+	pinned := &ToolSchemaExport{Servers: make(map[string]ServerToolsExport)}
+	if live != nil {
+		for server, srv := range live.Servers {
+			pinned.Servers[server] = pinnedTools(srv)
+		}
+	}
+	for server := range locked.Servers {
+		if _, ok := pinned.Servers[server]; !ok {
+			delete(locked.Servers, server)
+		}
+	}
+	return DiffToolSchema(locked, pinned)
+}
+
+// export converts the lock to a raw export for DiffToolSchema.
+func (l *Lockfile) export() *ToolSchemaExport {
+	export := &ToolSchemaExport{Servers: make(map[string]ServerToolsExport, len(l.Servers))}
+	for server, tools := range l.Servers {
+		names := make([]string, 0, len(tools))
+		for name := range tools {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		srv := ServerToolsExport{}
+		for _, name := range names {
+			srv.Tools = append(srv.Tools, tool.Declaration{Name: name, InputSchema: tools[name].InputSchema})
+		}
+		export.Servers[server] = srv
+	}
+	return export
+}
+
+// pinnedTools keeps only the fields a lockfile pins.
+func pinnedTools(srv ServerToolsExport) ServerToolsExport {
+	out := ServerToolsExport{Tools: make([]tool.Declaration, len(srv.Tools))}
+	for i, decl := range srv.Tools {
+		out.Tools[i] = tool.Declaration{Name: decl.Name, InputSchema: decl.InputSchema}
+	}
+	return out
+}
+
+// CheckLockfile compares the live tools of toolSets with the lockfile at
+// path. Every change is logged; in DriftFail mode breaking changes return a
+// *DriftError.
+func CheckLockfile(ctx context.Context, toolSets map[string]tool.ToolSet, path string, mode DriftMode) error {
+	lock, err := LoadLockfile(path)
+	if err != nil {
+		return err
+	}
+	diff := lock.Diff(NewToolSchemaExport(ctx, toolSets, nil))
+	if diff.Empty() {
+		logger.L().Info("MCP tools match lockfile", "path", path)
+		return nil
+	}
+
+	log := logger.L()
+	for _, name := range diff.Added {
+		log.Warn("MCP tool not in lockfile", "tool", name)
+	}
+	for _, name := range diff.Removed {
+		log.Warn("MCP locked tool removed", "tool", name)
+	}
+	for _, c := range diff.Changed {
+		for _, change := range c.Changes {
+			log.Warn("MCP tool signature changed", "tool", c.Tool, "change", change, "breaking", c.Breaking)
+		}
+	}
+	if mode == DriftFail && diff.Breaking() {
+		return &DriftError{Path: path, Diff: diff}
+	}
+	return nil
+}
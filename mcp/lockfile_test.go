@@ -0,0 +1,128 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+func declTools(decls ...tool.Declaration) []tool.Tool {
+	out := make([]tool.Tool, len(decls))
+	for i := range decls {
+		out[i] = &declTool{decl: decls[i]}
+	}
+	return out
+}
+
+type declTool struct{ decl tool.Declaration }
+
+func (d *declTool) Declaration() *tool.Declaration { return &d.decl }
+
+func liveToolSets() map[string]tool.ToolSet {
+	return map[string]tool.ToolSet{
+		"eda": &staticToolSet{name: "eda", tools: declTools(
+			tool.Declaration{Name: "run_sim", Description: "Run", InputSchema: &tool.Schema{
+				Type:       "object",
+				Properties: map[string]*tool.Schema{"top": {Type: "string"}},
+				Required:   []string{"top"},
+			}},
+			tool.Declaration{Name: "lint"},
+		)},
+	}
+}
+
+func TestLockfile_RoundTripMatches(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mcp.lock.json")
+	sets := liveToolSets()
+	if err := writeJSON(path, NewLockfile(NewToolSchemaExport(ctx, sets, nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rewording a tool is not drift.
+	sets["eda"].(*staticToolSet).tools[0].(*declTool).decl.Description = "Run a simulation"
+	if err := CheckLockfile(ctx, sets, path, DriftFail); err != nil {
+		t.Fatalf("expected no drift, got %v", err)
+	}
+
+	lock, err := LoadLockfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lock.Version != LockfileVersion || lock.Servers["eda"]["run_sim"].InputSchema == nil {
+		t.Errorf("unexpected lock %+v", lock)
+	}
+}
+
+func TestLockfile_DetectsBreakingDrift(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "mcp.lock.json")
+	if err := writeJSON(path, NewLockfile(NewToolSchemaExport(ctx, liveToolSets(), nil))); err != nil {
+		t.Fatal(err)
+	}
+
+	drifted := map[string]tool.ToolSet{
+		"eda": &staticToolSet{name: "eda", tools: declTools(
+			tool.Declaration{Name: "run_sim", InputSchema: &tool.Schema{
+				Type: "object",
+				Properties: map[string]*tool.Schema{
+					"top":  {Type: "string"},
+					"seed": {Type: "integer"},
+				},
+				Required: []string{"top", "seed"},
+			}},
+		)},
+	}
+
+	if err := CheckLockfile(ctx, drifted, path, DriftWarn); err != nil {
+		t.Fatalf("warn mode must not fail: %v", err)
+	}
+	err := CheckLockfile(ctx, drifted, path, DriftFail)
+	var drift *DriftError
+	if !errors.As(err, &drift) {
+		t.Fatalf("expected DriftError, got %v", err)
+	}
+	msg := drift.Error()
+	for _, want := range []string{"- eda/lint", "eda/run_sim: parameter seed added"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("missing %q in:\n%s", want, msg)
+		}
+	}
+}
+
+func TestLockfile_IgnoresServersNotRunning(t *testing.T) {
+	lock := NewLockfile(&ToolSchemaExport{Servers: map[string]ServerToolsExport{
+		"eda": {Tools: []tool.Declaration{{Name: "run_sim"}}},
+		"fs":  {Tools: []tool.Declaration{{Name: "read"}}},
+	}})
+	live := &ToolSchemaExport{Servers: map[string]ServerToolsExport{
+		"eda":  {Tools: []tool.Declaration{{Name: "run_sim", Description: "new text"}}},
+		"wave": {Tools: []tool.Declaration{{Name: "open"}}},
+	}}
+	d := lock.Diff(live)
+	if len(d.Removed) != 0 || strings.Join(d.Added, ",") != "wave/open" || d.Breaking() {
+		t.Errorf("unexpected diff %+v", d)
+	}
+}
+
+func TestGenerateLockfile(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath, lockPath := filepath.Join(dir, "tools.json"), filepath.Join(dir, "mcp.lock.json")
+	if err := writeJSON(schemaPath, NewToolSchemaExport(context.Background(), liveToolSets(), nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := GenerateLockfile(schemaPath, lockPath); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := lock.Servers["eda"]["lint"]; !ok {
+		t.Errorf("lint not pinned: %+v", lock.Servers)
+	}
+}
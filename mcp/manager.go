@@ -0,0 +1,317 @@
+// Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// ConfigDiff lists the servers affected by a configuration change.
+// Disabled servers are treated as absent.
+type ConfigDiff struct {
+	Added     []string
+	Removed   []string
+	Changed   []string
+	Unchanged []string
+}
+
+// Empty reports whether the diff requires no lifecycle action.
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffConfig compares two configurations server by server. A change to the
+// default timeout or retries marks every server present in both as changed,
+// since they apply to all of them.
+func DiffConfig(oldCfg, newCfg *MCPConfig) ConfigDiff {
+	oldServers, newServers := enabledServers(oldCfg), enabledServers(newCfg)
+	defaultsChanged := oldCfg != nil && newCfg != nil &&
+		(oldCfg.Defaults.Timeout != newCfg.Defaults.Timeout || oldCfg.Defaults.Retries != newCfg.Defaults.Retries)
+
+	var d ConfigDiff
+	for name, nc := range newServers {
+		oc, ok := oldServers[name]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, name)
+		case defaultsChanged || !reflect.DeepEqual(oc, nc):
+			d.Changed = append(d.Changed, name)
+		default:
+			d.Unchanged = append(d.Unchanged, name)
+		}
+	}
+	for name := range oldServers {
+		if _, ok := newServers[name]; !ok {
+			d.Removed = append(d.Removed, name)
+		}
+	}
+	sort.Strings(d.Added)
+	sort.Strings(d.Removed)
+	sort.Strings(d.Changed)
+	sort.Strings(d.Unchanged)
+	return d
+}
+
+func enabledServers(cfg *MCPConfig) map[string]MCPServerConfig {
+	out := make(map[string]MCPServerConfig)
+	if cfg == nil {
+		return out
+	}
+	for name, sc := range cfg.MCPServers {
+		if !sc.Disabled {
+			out[name] = sc
+		}
+	}
+	return out
+}
+
+// serverStarter creates and initializes the tool set for one server.
+type serverStarter func(ctx context.Context, name string, cfg MCPServerConfig, defaults MCPDefaults) (tool.ToolSet, error)
+
+// runningServer is a started server and the configuration it was started with.
+type runningServer struct {
+	cfg     MCPServerConfig
+	toolSet tool.ToolSet
+}
+
+// Manager owns the lifecycle of the MCP servers described by mcp.json.
+// Apply and Reload diff a new configuration against the running servers and
+// start, stop or restart only the servers that changed; unchanged servers
+// keep their connections. The current toolset map is published atomically,
+// so the flow layer can read ToolSets at any time (e.g. before each graph
+// rebuild) without locking.
+//
+// A restarted server is replaced only once its new instance has initialized;
+// if that fails, the previous instance keeps serving and the next reload
+// retries.
+type Manager struct {
+	configPath string
+	start      serverStarter
+
+	mu       sync.Mutex // serializes Apply
+	defaults MCPDefaults
+	running  map[string]*runningServer
+	current  atomic.Pointer[map[string]tool.ToolSet]
+	policy   atomic.Pointer[Policy]
+
+	hashMu   sync.Mutex
+	lastHash [sha256.Size]byte // content hash of the last loaded config file
+}
+
+// NewManager creates a manager for the given mcp.json path. No server is
+// started until Reload (or Apply) is called.
+func NewManager(configPath string) *Manager {
+	m := &Manager{
+		configPath: configPath,
+		running:    make(map[string]*runningServer),
+		start: func(ctx context.Context, name string, cfg MCPServerConfig, defaults MCPDefaults) (tool.ToolSet, error) {
+			return startServer(ctx, name, cfg, defaults)
+		},
+	}
+	empty := map[string]tool.ToolSet{}
+	m.current.Store(&empty)
+	return m
+}
+
+// SetHealthCheck wraps every server started from now on in a
+// HealthCheckedToolSet with the given configuration. Call it before the first
+// Reload or Apply.
+func (m *Manager) SetHealthCheck(cfg HealthConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	base := m.start
+	m.start = func(ctx context.Context, name string, sc MCPServerConfig, defaults MCPDefaults) (tool.ToolSet, error) {
+		ts, err := base(ctx, name, sc, defaults)
+		if err != nil {
+			return nil, err
+		}
+		return startHealthChecked(ctx, name, ts, func(ctx context.Context) (tool.ToolSet, error) {
+			return base(ctx, name, sc, defaults)
+		}, cfg), nil
+	}
+}
+
+// ToolSets returns the current toolset map, keyed by server name. The map is
+// a snapshot and must not be modified.
+func (m *Manager) ToolSets() map[string]tool.ToolSet {
+	return *m.current.Load()
+}
+
+// Policy returns the tool policy of the last applied configuration, or nil
+// when it declares none. Rebuild the flow graph after a reload to use it.
+func (m *Manager) Policy() *Policy {
+	return m.policy.Load()
+}
+
+// Reload reads the configuration file and applies it. The file counts as
+// loaded, so that Watch skips it until it changes, only once every server
+// has started.
+func (m *Manager) Reload(ctx context.Context) (ConfigDiff, error) {
+	data, err := os.ReadFile(m.configPath)
+	if err != nil {
+		return ConfigDiff{}, fmt.Errorf("failed to read mcp.json: %w", err)
+	}
+	config, err := ParseConfig(data, WithWorkspace(filepath.Dir(m.configPath)))
+	if err != nil {
+		return ConfigDiff{}, err
+	}
+	diff, err := m.Apply(ctx, config)
+	if err != nil {
+		return diff, err
+	}
+	m.hashMu.Lock()
+	m.lastHash = sha256.Sum256(data)
+	m.hashMu.Unlock()
+	return diff, nil
+}
+
+// Apply brings the running servers in line with config. Servers that fail to
+// start are reported in the returned error; all other changes still apply.
+// An invalid policy or stage mapping rejects the whole configuration.
+func (m *Manager) Apply(ctx context.Context, config *MCPConfig) (ConfigDiff, error) {
+	if err := validateStages(config); err != nil {
+		return ConfigDiff{}, err
+	}
+	var policy *Policy
+	if !config.Policy.empty() {
+		var err error
+		if policy, err = NewPolicy(config.Policy); err != nil {
+			return ConfigDiff{}, err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.policy.Store(policy)
+
+	oldCfg := &MCPConfig{Defaults: m.defaults, MCPServers: make(map[string]MCPServerConfig, len(m.running))}
+	for name, rs := range m.running {
+		oldCfg.MCPServers[name] = rs.cfg
+	}
+	diff := DiffConfig(oldCfg, config)
+	if diff.Empty() && m.defaults == config.Defaults {
+		return diff, nil
+	}
+	m.defaults = config.Defaults
+
+	for _, name := range diff.Removed {
+		m.stop(name, m.running[name])
+		delete(m.running, name)
+	}
+
+	var (
+		resultMu sync.Mutex
+		started  = make(map[string]tool.ToolSet)
+		errs     []error
+	)
+	toStart := append(append([]string(nil), diff.Added...), diff.Changed...)
+	runBounded(toStart, config.Defaults.maxConcurrentInit(), func(name string) {
+		ts, err := m.start(ctx, name, config.MCPServers[name], config.Defaults)
+		resultMu.Lock()
+		defer resultMu.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			logger.L().Error("MCP server start failed", "name", name, "error", err)
+			return
+		}
+		started[name] = ts
+	})
+	for _, name := range toStart {
+		ts, ok := started[name]
+		if !ok {
+			continue
+		}
+		if old, ok := m.running[name]; ok {
+			m.stop(name, old)
+		}
+		m.running[name] = &runningServer{cfg: config.MCPServers[name], toolSet: ts}
+		logger.L().Info("MCP server started", "name", name)
+	}
+
+	m.publish()
+	logger.L().Info("MCP config applied",
+		"added", len(diff.Added), "removed", len(diff.Removed),
+		"changed", len(diff.Changed), "active", len(m.running))
+	return diff, errors.Join(errs...)
+}
+
+// Watch polls the configuration file every interval (default 2s) and
+// reloads it when its content changes, until ctx is cancelled. Reload errors
+// are logged; the running servers are left as they were, and a configuration
+// whose servers did not all start is reloaded again on the next poll.
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			data, err := os.ReadFile(m.configPath)
+			if err != nil {
+				logger.L().Warn("MCP config watch read failed", "path", m.configPath, "error", err)
+				continue
+			}
+			m.hashMu.Lock()
+			unchanged := sha256.Sum256(data) == m.lastHash
+			m.hashMu.Unlock()
+			if unchanged {
+				continue
+			}
+			if _, err := m.Reload(ctx); err != nil {
+				logger.L().Warn("MCP config reload failed", "path", m.configPath, "error", err)
+			}
+		}
+	}
+}
+
+// Close stops all running servers.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, rs := range m.running {
+		m.stop(name, rs)
+	}
+	m.running = make(map[string]*runningServer)
+	m.publish()
+}
+
+// publish stores a fresh snapshot of the running toolsets. Callers hold m.mu.
+func (m *Manager) publish() {
+	snapshot := make(map[string]tool.ToolSet, len(m.running))
+	for name, rs := range m.running {
+		snapshot[name] = rs.toolSet
+	}
+	m.current.Store(&snapshot)
+}
+
+func (m *Manager) stop(name string, rs *runningServer) {
+	if rs == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			logger.L().Warn("MCP panic in close", "name", name, "recover", r)
+		}
+	}()
+	if err := rs.toolSet.Close(); err != nil {
+		logger.L().Warn("MCP error closing", "name", name, "error", err)
+	}
+	logger.L().Info("MCP server stopped", "name", name)
+}
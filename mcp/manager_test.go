@@ -0,0 +1,132 @@
+package mcp
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// fakeToolSet is a tool.ToolSet with no real connection.
+type fakeToolSet struct {
+	name   string
+	closed bool
+}
+
+func (f *fakeToolSet) Tools(context.Context) []tool.Tool { return nil }
+func (f *fakeToolSet) Close() error                      { f.closed = true; return nil }
+func (f *fakeToolSet) Name() string                      { return f.name }
+
+// newFakeManager returns a manager whose servers are fakeToolSets. Servers
+// whose command is "fail" fail to start.
+func newFakeManager(path string) (*Manager, map[string]int) {
+	var mu sync.Mutex
+	starts := make(map[string]int)
+	m := NewManager(path)
+	m.start = func(_ context.Context, name string, cfg MCPServerConfig, _ MCPDefaults) (tool.ToolSet, error) {
+		if cfg.Command == "fail" {
+			return nil, errors.New("boom")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		starts[name]++
+		return &fakeToolSet{name: name}, nil
+	}
+	return m, starts
+}
+
+func TestDiffConfig(t *testing.T) {
+	oldCfg := &MCPConfig{MCPServers: map[string]MCPServerConfig{
+		"fs":    {Command: "fs-server"},
+		"sim":   {Command: "sim", Tools: []string{"run"}},
+		"lint":  {Command: "lint"},
+		"spare": {Command: "spare", Disabled: true},
+	}}
+	newCfg := &MCPConfig{MCPServers: map[string]MCPServerConfig{
+		"fs":    {Command: "fs-server"},
+		"sim":   {Command: "sim", Tools: []string{"run", "wave"}},
+		"spare": {Command: "spare"},
+	}}
+
+	d := DiffConfig(oldCfg, newCfg)
+	if len(d.Added) != 1 || d.Added[0] != "spare" ||
+		len(d.Removed) != 1 || d.Removed[0] != "lint" ||
+		len(d.Changed) != 1 || d.Changed[0] != "sim" ||
+		len(d.Unchanged) != 1 || d.Unchanged[0] != "fs" {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+
+	newCfg.Defaults.Timeout = 60
+	if d := DiffConfig(oldCfg, newCfg); len(d.Changed) != 2 {
+		t.Fatalf("defaults change should restart all kept servers, got %+v", d)
+	}
+}
+
+func TestManager_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m, starts := newFakeManager(path)
+	ctx := context.Background()
+
+	write(`{"mcpServers": {"fs": {"command": "fs"}, "sim": {"command": "sim"}}}`)
+	if _, err := m.Reload(ctx); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	first := m.ToolSets()
+	if len(first) != 2 {
+		t.Fatalf("expected 2 toolsets, got %d", len(first))
+	}
+	simV1 := first["sim"].(*fakeToolSet)
+
+	// Change sim's tools filter and add lint: fs must keep its connection.
+	write(`{"mcpServers": {"fs": {"command": "fs"}, "sim": {"command": "sim", "tools": ["run"]}, "lint": {"command": "lint"}}}`)
+	d, err := m.Reload(ctx)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if len(d.Changed) != 1 || len(d.Added) != 1 {
+		t.Fatalf("unexpected diff: %+v", d)
+	}
+	if starts["fs"] != 1 || starts["sim"] != 2 || starts["lint"] != 1 {
+		t.Fatalf("unexpected start counts: %v", starts)
+	}
+	if !simV1.closed {
+		t.Fatal("old sim instance should be closed after restart")
+	}
+	if len(first) != 2 {
+		t.Fatal("published snapshot must not change after reload")
+	}
+
+	// A failed restart keeps the previous instance.
+	write(`{"mcpServers": {"fs": {"command": "fail"}, "sim": {"command": "sim", "tools": ["run"]}}}`)
+	if _, err := m.Reload(ctx); err == nil {
+		t.Fatal("expected start error")
+	}
+	current := m.ToolSets()
+	if _, ok := current["fs"]; !ok || len(current) != 2 {
+		t.Fatalf("expected fs kept and lint removed, got %v", current)
+	}
+
+	// The failed file is not marked as loaded, so Watch retries it.
+	m.hashMu.Lock()
+	loaded := m.lastHash
+	m.hashMu.Unlock()
+	data, _ := os.ReadFile(path)
+	if loaded == sha256.Sum256(data) {
+		t.Fatal("a config whose servers failed to start must be retried")
+	}
+
+	m.Close()
+	if len(m.ToolSets()) != 0 {
+		t.Fatal("expected no toolsets after close")
+	}
+}
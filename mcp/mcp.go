@@ -2,10 +2,19 @@
 package mcp
 
 import (
-	"trpc.group/trpc-go/trpc-agent-go/tool/mcp"
+	"trpc.group/trpc-go/trpc-agent-go/tool"
 )
 
 // MCPToolSets contains all initialized MCP tool sets
 type MCPToolSets struct {
-	toolSets map[string]*mcp.ToolSet
+	toolSets map[string]tool.ToolSet
+	stages   map[string][]string // stage mapping from mcp.json; nil means DefaultStages
+	policy   *Policy
+}
+
+// Policy returns the tool policy compiled from mcp.json, for use as
+// FlowOptions.ToolScope. It is nil (allowing everything) when the
+// configuration declares none.
+func (m *MCPToolSets) Policy() *Policy {
+	return m.policy
 }
@@ -0,0 +1,477 @@
+// Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// PolicyConfig is the "policy" section of mcp.json. Tool patterns are
+// path.Match globs over the tool name, or over "server/tool" when they
+// contain a slash.
+type PolicyConfig struct {
+	// Steps maps step IDs (or globs) to the tool patterns those steps may
+	// use. A "!" prefix denies. Steps matching no key may use every tool.
+	Steps map[string][]string `json:"steps,omitempty"`
+	// Args maps tool patterns to rules on their arguments.
+	Args map[string][]ArgRule `json:"args,omitempty"`
+	// RateLimits maps tool patterns to per-tool call limits.
+	RateLimits map[string]RateLimit `json:"rateLimits,omitempty"`
+}
+
+func (c PolicyConfig) empty() bool {
+	return len(c.Steps) == 0 && len(c.Args) == 0 && len(c.RateLimits) == 0
+}
+
+// ArgRule constrains one top-level argument of a tool call. For array
+// arguments, every element is checked.
+type ArgRule struct {
+	Name     string   `json:"name"`
+	Required bool     `json:"required,omitempty"`
+	Within   string   `json:"within,omitempty"`  // path must stay under this directory
+	Pattern  string   `json:"pattern,omitempty"` // regexp the value must match
+	Enum     []string `json:"enum,omitempty"`    // allowed values
+}
+
+// RateLimit allows Calls calls per Window (a Go duration, default "1m").
+type RateLimit struct {
+	Calls  int    `json:"calls"`
+	Window string `json:"window,omitempty"`
+}
+
+// Violation reasons reported in PolicyViolation.Reason.
+const (
+	ReasonToolDenied      = "tool_denied"
+	ReasonInvalidArgument = "invalid_argument"
+	ReasonRateLimited     = "rate_limited"
+)
+
+// PolicyViolation is returned to the model as the result of a rejected tool
+// call, so it can correct the call instead of the run failing.
+type PolicyViolation struct {
+	IsError bool               `json:"error"`
+	Code    pipeline.ErrorCode `json:"code"`
+	Reason  string             `json:"reason"`
+	Tool    string             `json:"tool"`
+	Step    string             `json:"step,omitempty"`
+	Message string             `json:"message"`
+}
+
+// ArgValidator checks the decoded arguments of a tool call. A non-nil error
+// rejects the call with ReasonInvalidArgument.
+type ArgValidator func(toolName string, args map[string]any) error
+
+// PolicyOption configures a Policy.
+type PolicyOption func(*Policy)
+
+// WithArgValidator registers a validator for tools matching pattern.
+func WithArgValidator(pattern string, v ArgValidator) PolicyOption {
+	return func(p *Policy) {
+		p.validators = append(p.validators, patternValidator{pattern: pattern, validate: v})
+	}
+}
+
+type patternValidator struct {
+	pattern  string
+	validate ArgValidator
+}
+
+type compiledRule struct {
+	ArgRule
+	re *regexp.Regexp
+}
+
+type compiledLimit struct {
+	calls  int
+	window time.Duration
+}
+
+// Policy enforces a PolicyConfig on tool calls. It implements
+// pipeline.ToolScoper: set it as FlowOptions.ToolScope to hide the tools a
+// step may not use and to check every call before it is executed. Rejected
+// calls are not forwarded to the server; they return a *PolicyViolation.
+// A nil *Policy allows everything.
+type Policy struct {
+	steps      map[string][]string
+	args       map[string][]compiledRule
+	limits     map[string]compiledLimit
+	validators []patternValidator
+	now        func() time.Time
+
+	mu    sync.Mutex
+	calls map[string][]time.Time // recent call times per "server/tool"
+}
+
+// NewPolicy compiles cfg. Invalid globs, regexps and windows are reported
+// together.
+func NewPolicy(cfg PolicyConfig, opts ...PolicyOption) (*Policy, error) {
+	p := &Policy{
+		steps:  cfg.Steps,
+		args:   make(map[string][]compiledRule, len(cfg.Args)),
+		limits: make(map[string]compiledLimit, len(cfg.RateLimits)),
+		now:    time.Now,
+		calls:  make(map[string][]time.Time),
+	}
+	for _, o := range opts {
+		o(p)
+	}
+
+	var errs []error
+	checkGlob := func(where, pattern string) {
+		if _, err := path.Match(strings.TrimPrefix(pattern, "!"), ""); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid pattern %q: %w", where, pattern, err))
+		}
+	}
+	for step, patterns := range cfg.Steps {
+		checkGlob("policy.steps", step)
+		for _, pattern := range patterns {
+			checkGlob("policy.steps."+step, pattern)
+		}
+	}
+	for pattern, rules := range cfg.Args {
+		checkGlob("policy.args", pattern)
+		compiled := make([]compiledRule, 0, len(rules))
+		for i, r := range rules {
+			cr := compiledRule{ArgRule: r}
+			if r.Name == "" {
+				errs = append(errs, fmt.Errorf("policy.args.%s[%d]: missing name", pattern, i))
+			}
+			if r.Pattern != "" {
+				re, err := regexp.Compile(r.Pattern)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("policy.args.%s[%d].pattern: %w", pattern, i, err))
+				}
+				cr.re = re
+			}
+			compiled = append(compiled, cr)
+		}
+		p.args[pattern] = compiled
+	}
+	for pattern, limit := range cfg.RateLimits {
+		checkGlob("policy.rateLimits", pattern)
+		window := time.Minute
+		if limit.Window != "" {
+			d, err := time.ParseDuration(limit.Window)
+			if err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("policy.rateLimits.%s.window: invalid duration %q", pattern, limit.Window))
+			}
+			window = d
+		}
+		if limit.Calls <= 0 {
+			errs = append(errs, fmt.Errorf("policy.rateLimits.%s.calls: must be positive", pattern))
+		}
+		p.limits[pattern] = compiledLimit{calls: limit.Calls, window: window}
+	}
+	for _, v := range p.validators {
+		checkGlob("validator", v.pattern)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// AllowsTool reports whether stepID may use the tool of the given server.
+func (p *Policy) AllowsTool(stepID, server, toolName string) bool {
+	if p == nil {
+		return true
+	}
+	var allow, deny []string
+	for key, patterns := range p.steps {
+		if ok, _ := path.Match(key, stepID); !ok {
+			continue
+		}
+		if len(patterns) == 0 {
+			// A step key with no patterns allows nothing.
+			allow = append(allow, "")
+		}
+		for _, pattern := range patterns {
+			if rest, ok := strings.CutPrefix(pattern, "!"); ok {
+				deny = append(deny, rest)
+			} else {
+				allow = append(allow, pattern)
+			}
+		}
+	}
+	for _, pattern := range deny {
+		if matchTool(pattern, server, toolName) {
+			return false
+		}
+	}
+	if allow == nil {
+		return true
+	}
+	for _, pattern := range allow {
+		if pattern != "" && matchTool(pattern, server, toolName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check validates a call of toolName with raw JSON args made by stepID and,
+// if it passes, counts it against the rate limits. It returns nil when the
+// call may proceed.
+func (p *Policy) Check(stepID, server, toolName string, args []byte) *PolicyViolation {
+	if p == nil {
+		return nil
+	}
+	violation := func(reason, format string, a ...any) *PolicyViolation {
+		return &PolicyViolation{
+			IsError: true,
+			Code:    pipeline.ErrCodePolicyViolation,
+			Reason:  reason,
+			Tool:    toolName,
+			Step:    stepID,
+			Message: fmt.Sprintf(format, a...),
+		}
+	}
+
+	if !p.AllowsTool(stepID, server, toolName) {
+		return violation(ReasonToolDenied, "tool %s is not allowed in step %s", toolName, stepID)
+	}
+	if err := p.checkArgs(server, toolName, args); err != nil {
+		return violation(ReasonInvalidArgument, "%v", err)
+	}
+	if wait := p.takeRate(server, toolName); wait > 0 {
+		return violation(ReasonRateLimited, "rate limit exceeded for tool %s, retry in %s", toolName, wait.Round(time.Second))
+	}
+	return nil
+}
+
+// ScopeToolSets implements pipeline.ToolScoper. names are the mcp.json
+// server keys matched by "server/tool" patterns; the tool sets a stage merges
+// are checked under their own server keys.
+func (p *Policy) ScopeToolSets(stepID string, names []string, toolSets []tool.ToolSet) []tool.ToolSet {
+	if p == nil {
+		return toolSets
+	}
+	out := make([]tool.ToolSet, len(toolSets))
+	for i, ts := range toolSets {
+		server := ts.Name()
+		if i < len(names) {
+			server = names[i]
+		}
+		out[i] = p.scope(stepID, server, ts)
+	}
+	return out
+}
+
+func (p *Policy) scope(stepID, server string, ts tool.ToolSet) tool.ToolSet {
+	merged, ok := ts.(*mergedToolSet)
+	if !ok {
+		return &policyToolSet{inner: ts, server: server, stepID: stepID, policy: p}
+	}
+	sets := make([]tool.ToolSet, len(merged.sets))
+	for i, inner := range merged.sets {
+		sets[i] = p.scope(stepID, merged.servers[i], inner)
+	}
+	return &mergedToolSet{name: merged.name, servers: merged.servers, sets: sets}
+}
+
+func (p *Policy) checkArgs(server, toolName string, raw []byte) error {
+	var rules []compiledRule
+	for _, pattern := range sortedRuleKeys(p.args) {
+		if matchTool(pattern, server, toolName) {
+			rules = append(rules, p.args[pattern]...)
+		}
+	}
+	var validators []ArgValidator
+	for _, v := range p.validators {
+		if matchTool(v.pattern, server, toolName) {
+			validators = append(validators, v.validate)
+		}
+	}
+	if len(rules) == 0 && len(validators) == 0 {
+		return nil
+	}
+
+	args := map[string]any{}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return fmt.Errorf("arguments are not a JSON object: %w", err)
+		}
+	}
+	for _, r := range rules {
+		if err := r.check(args); err != nil {
+			return err
+		}
+	}
+	for _, v := range validators {
+		if err := v(toolName, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r compiledRule) check(args map[string]any) error {
+	value, ok := args[r.Name]
+	if !ok || value == nil {
+		if r.Required {
+			return fmt.Errorf("argument %s is required", r.Name)
+		}
+		return nil
+	}
+	values := []any{value}
+	if list, ok := value.([]any); ok {
+		values = list
+	}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		if len(r.Enum) > 0 && !slices.Contains(r.Enum, s) {
+			return fmt.Errorf("argument %s: %q is not one of %s", r.Name, s, strings.Join(r.Enum, ", "))
+		}
+		if r.re != nil && !r.re.MatchString(s) {
+			return fmt.Errorf("argument %s: %q does not match %s", r.Name, s, r.Pattern)
+		}
+		if r.Within != "" && !within(r.Within, s) {
+			return fmt.Errorf("argument %s: path %q is outside %s", r.Name, s, r.Within)
+		}
+	}
+	return nil
+}
+
+// takeRate records a call and returns zero, or returns how long to wait when
+// a limit is exhausted (the call is then not recorded).
+func (p *Policy) takeRate(server, toolName string) time.Duration {
+	if len(p.limits) == 0 {
+		return 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key := server + "/" + toolName
+	now := p.now()
+	for pattern, limit := range p.limits {
+		if !matchTool(pattern, server, toolName) {
+			continue
+		}
+		recent := 0
+		var oldest time.Time
+		for _, t := range p.calls[key] {
+			if now.Sub(t) < limit.window {
+				if recent == 0 {
+					oldest = t
+				}
+				recent++
+			}
+		}
+		if recent >= limit.calls {
+			return oldest.Add(limit.window).Sub(now)
+		}
+	}
+
+	var maxWindow time.Duration
+	for _, limit := range p.limits {
+		maxWindow = max(maxWindow, limit.window)
+	}
+	kept := p.calls[key][:0]
+	for _, t := range p.calls[key] {
+		if now.Sub(t) < maxWindow {
+			kept = append(kept, t)
+		}
+	}
+	p.calls[key] = append(kept, now)
+	return 0
+}
+
+// within reports whether path p, resolved against dir when relative, stays
+// under dir. Symlinks are not resolved.
+func within(dir, p string) bool {
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(dir, p)
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// matchTool matches pattern against the tool name, or against "server/tool"
+// when pattern contains a slash.
+func matchTool(pattern, server, toolName string) bool {
+	name := toolName
+	if strings.Contains(pattern, "/") {
+		name = server + "/" + toolName
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+func sortedRuleKeys(m map[string][]compiledRule) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// policyToolSet exposes the tools of inner that a step may use, checking
+// every call against the policy.
+type policyToolSet struct {
+	inner  tool.ToolSet
+	server string // mcp.json server key
+	stepID string
+	policy *Policy
+}
+
+func (s *policyToolSet) Tools(ctx context.Context) []tool.Tool {
+	var out []tool.Tool
+	for _, t := range s.inner.Tools(ctx) {
+		if s.policy.AllowsTool(s.stepID, s.server, t.Declaration().Name) {
+			out = append(out, &policyTool{Tool: t, set: s})
+		}
+	}
+	return out
+}
+
+// Close is a no-op: the inner tool set is shared and closed by its owner.
+func (s *policyToolSet) Close() error { return nil }
+
+func (s *policyToolSet) Name() string { return s.inner.Name() }
+
+type policyTool struct {
+	tool.Tool
+	set *policyToolSet
+}
+
+func (t *policyTool) Call(ctx context.Context, jsonArgs []byte) (any, error) {
+	name := t.Declaration().Name
+	if v := t.set.policy.Check(t.set.stepID, t.set.server, name, jsonArgs); v != nil {
+		logger.L().Warn("MCP tool call rejected by policy", "step", v.Step, "tool", name, "reason", v.Reason, "message", v.Message)
+		return v, nil
+	}
+	callable, ok := t.Tool.(tool.CallableTool)
+	if !ok {
+		return nil, fmt.Errorf("tool %s is not callable", name)
+	}
+	return callable.Call(ctx, jsonArgs)
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ pipeline.ToolScoper = (*Policy)(nil)
+	_ tool.ToolSet        = (*policyToolSet)(nil)
+	_ tool.CallableTool   = (*policyTool)(nil)
+)
@@ -0,0 +1,226 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// countingTool records how often it was executed.
+type countingTool struct {
+	name  string
+	calls int
+}
+
+func (c *countingTool) Declaration() *tool.Declaration { return &tool.Declaration{Name: c.name} }
+
+func (c *countingTool) Call(context.Context, []byte) (any, error) {
+	c.calls++
+	return "ok", nil
+}
+
+type staticToolSet struct {
+	name  string
+	tools []tool.Tool
+}
+
+func (s *staticToolSet) Tools(context.Context) []tool.Tool { return s.tools }
+func (s *staticToolSet) Close() error                      { return nil }
+func (s *staticToolSet) Name() string                      { return s.name }
+
+func TestToolNameFilter(t *testing.T) {
+	filter := toolNameFilter([]string{"sim_*", "lint"}, []string{"sim_delete*"})
+	for name, want := range map[string]bool{
+		"sim_run":    true,
+		"lint":       true,
+		"sim_delete": false,
+		"shell":      false,
+	} {
+		if got := filter(context.Background(), &countingTool{name: name}); got != want {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestPolicy_StepScoping(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{Steps: map[string][]string{
+		"1.*": {"read_*", "eda/run"},
+		"2.1": {"*", "!write_*"},
+		"3":   {},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		step, server, tool string
+		want               bool
+	}{
+		{"1.1", "fs", "read_file", true},
+		{"1.1", "fs", "write_file", false},
+		{"1.2", "eda", "run", true},
+		{"1.2", "other", "run", false},
+		{"2.1", "fs", "write_file", false},
+		{"2.1", "fs", "shell", true},
+		{"3", "fs", "read_file", false},
+		{"4", "fs", "write_file", true},
+	}
+	for _, c := range cases {
+		if got := p.AllowsTool(c.step, c.server, c.tool); got != c.want {
+			t.Errorf("AllowsTool(%s, %s, %s) = %v, want %v", c.step, c.server, c.tool, got, c.want)
+		}
+	}
+}
+
+func TestPolicy_ScopeToolSetsRejectsWithoutExecuting(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPolicy(PolicyConfig{
+		Steps: map[string][]string{"1.1": {"!shell"}},
+		Args: map[string][]ArgRule{
+			"write_file": {{Name: "path", Required: true, Within: dir}},
+			"sim_*":      {{Name: "mode", Enum: []string{"rtl", "gate"}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write, shell, sim := &countingTool{name: "write_file"}, &countingTool{name: "shell"}, &countingTool{name: "sim_run"}
+	scoped := p.ScopeToolSets("1.1", []string{"fs"}, []tool.ToolSet{&staticToolSet{name: "fs", tools: []tool.Tool{write, shell, sim}}})
+
+	tools := scoped[0].Tools(context.Background())
+	if len(tools) != 2 {
+		t.Fatalf("expected shell to be hidden, got %d tools", len(tools))
+	}
+	call := func(i int, args string) any {
+		t.Helper()
+		res, err := tools[i].(tool.CallableTool).Call(context.Background(), []byte(args))
+		if err != nil {
+			t.Fatalf("Call: %v", err)
+		}
+		return res
+	}
+
+	for _, args := range []string{`{"path":"../etc/passwd"}`, `{"path":"/etc/passwd"}`, `{}`} {
+		v, ok := call(0, args).(*PolicyViolation)
+		if !ok || v.Reason != ReasonInvalidArgument || v.Code != pipeline.ErrCodePolicyViolation {
+			t.Errorf("%s: expected invalid argument violation, got %#v", args, v)
+		}
+	}
+	if res := call(0, `{"path":"out/a.v"}`); res != "ok" {
+		t.Errorf("expected call inside workspace to run, got %#v", res)
+	}
+	if v, ok := call(1, `{"mode":"spice"}`).(*PolicyViolation); !ok || !strings.Contains(v.Message, "not one of") {
+		t.Errorf("expected enum violation, got %#v", v)
+	}
+	if write.calls != 1 || sim.calls != 0 || shell.calls != 0 {
+		t.Errorf("executed calls: write=%d sim=%d shell=%d", write.calls, sim.calls, shell.calls)
+	}
+	if v := p.Check("1.1", "fs", "shell", nil); v == nil || v.Reason != ReasonToolDenied {
+		t.Errorf("expected denied violation, got %#v", v)
+	}
+}
+
+func TestPolicy_RateLimit(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{RateLimits: map[string]RateLimit{"sim_*": {Calls: 2, Window: "1m"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	p.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if v := p.Check("1", "eda", "sim_run", nil); v != nil {
+			t.Fatalf("call %d rejected: %s", i, v.Message)
+		}
+	}
+	if v := p.Check("1", "eda", "sim_run", nil); v == nil || v.Reason != ReasonRateLimited {
+		t.Fatalf("expected rate limit, got %#v", v)
+	}
+	if v := p.Check("1", "eda", "sim_wave", nil); v != nil {
+		t.Errorf("limits are per tool, got %s", v.Message)
+	}
+	now = now.Add(time.Minute)
+	if v := p.Check("1", "eda", "sim_run", nil); v != nil {
+		t.Errorf("expected window to reset, got %s", v.Message)
+	}
+}
+
+func TestPolicy_ArgValidatorAndConfigErrors(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{}, WithArgValidator("run", func(_ string, args map[string]any) error {
+		if args["cmd"] == "rm" {
+			return errors.New("cmd rm is forbidden")
+		}
+		return nil
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := p.Check("1", "sh", "run", []byte(`{"cmd":"rm"}`)); v == nil || v.Message != "cmd rm is forbidden" {
+		t.Errorf("expected validator violation, got %#v", v)
+	}
+
+	_, err = NewPolicy(PolicyConfig{
+		Args:       map[string][]ArgRule{"x": {{Name: "a", Pattern: "("}}},
+		RateLimits: map[string]RateLimit{"y": {Calls: 0, Window: "soon"}},
+	})
+	if err == nil {
+		t.Fatal("expected config errors")
+	}
+	for _, want := range []string{"policy.args.x[0].pattern", "policy.rateLimits.y.window", "policy.rateLimits.y.calls"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestParseConfig_PolicyWithinWorkspace(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`{"mcpServers":{},"policy":{"args":{"write_*":[{"name":"path","within":"${workspace}/out"}]}}}`),
+		WithWorkspace("/ws"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Policy.Args["write_*"][0].Within; got != "/ws/out" {
+		t.Errorf("within = %q", got)
+	}
+}
+
+func TestPolicy_MatchesConfiguredServerKey(t *testing.T) {
+	p, err := NewPolicy(PolicyConfig{
+		Steps: map[string][]string{"1.1": {"eda/*", "!eda/shell"}},
+		Args:  map[string][]ArgRule{"eda/run_sim": {{Name: "top", Required: true}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for name, env := range map[string]map[string]string{
+		"default": nil,
+		"env":     {"SIM_LICENSE": "1"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts, err := newServerToolSet(testServerConfig(env), MCPDefaults{Timeout: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ts.Close()
+			if ts.Name() == "eda" {
+				t.Fatal("test requires a tool set name that differs from the server key")
+			}
+
+			scoped := p.ScopeToolSets("1.1", []string{"eda"}, []tool.ToolSet{ts})
+			tools := scoped[0].Tools(ctx)
+			if len(tools) != 1 || tools[0].Declaration().Name != "run_sim" {
+				t.Fatalf("expected only run_sim, got %d tools", len(tools))
+			}
+			res, err := tools[0].(tool.CallableTool).Call(ctx, []byte(`{}`))
+			if v, ok := res.(*PolicyViolation); err != nil || !ok || v.Reason != ReasonInvalidArgument {
+				t.Fatalf("expected argument violation, got %#v %v", res, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package mcp
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/package-register/trpc-agent-go-extensions/telemetry"
+
+	tmcp "trpc.group/trpc-go/trpc-mcp-go"
+)
+
+// tracePropagation injects the W3C trace context (traceparent) of the
+// calling span into every request to an SSE or streamable server, so spans
+// emitted by the server join the pipeline trace.
+type tracePropagation struct {
+	next tmcp.HTTPReqHandler
+}
+
+func newTracePropagation() tmcp.HTTPReqHandler {
+	return &tracePropagation{next: tmcp.NewDefaultHTTPReqHandler()}
+}
+
+func (h *tracePropagation) Handle(ctx context.Context, client *http.Client, req *http.Request) (*http.Response, error) {
+	telemetry.InjectTraceContext(ctx, req.Header)
+	return h.next.Handle(ctx, client, req)
+}
+
+// Verify interface compliance at compile time.
+var _ tmcp.HTTPReqHandler = (*tracePropagation)(nil)
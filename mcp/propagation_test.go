@@ -0,0 +1,37 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/telemetry"
+)
+
+func TestTracePropagation_SetsTraceparent(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("traceparent")
+	}))
+	defer srv.Close()
+
+	ctx, span := telemetry.NewJSON(&bytes.Buffer{}, "test").StartSpan(context.Background(), "tool")
+	defer span.End()
+
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := newTracePropagation().Handle(ctx, srv.Client(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if !strings.HasPrefix(got, "00-") {
+		t.Fatalf("expected W3C traceparent, got %q", got)
+	}
+}
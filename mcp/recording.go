@@ -0,0 +1,328 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// Recording entry kinds.
+const (
+	RecordTools = "tools" // the declarations of one server
+	RecordCall  = "call"  // one tool call and its outcome
+)
+
+// RecordEntry is one line of a recording (JSONL).
+type RecordEntry struct {
+	Kind    string             `json:"kind"`
+	Server  string             `json:"server"`
+	ToolSet string             `json:"toolset,omitempty"` // Name() of the recorded tool set
+	Tools   []tool.Declaration `json:"tools,omitempty"`
+
+	Tool       string          `json:"tool,omitempty"`
+	Key        string          `json:"key,omitempty"` // tool name + canonical args
+	Args       json.RawMessage `json:"args,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	ErrorCode  string          `json:"error_code,omitempty"`
+	RecordedAt time.Time       `json:"recorded_at"`
+}
+
+// CallKey identifies a call by tool name and canonicalised JSON arguments
+// (object keys sorted, insignificant whitespace removed), so equivalent
+// calls share a key.
+func CallKey(toolName string, args []byte) string {
+	return toolName + " " + string(canonicalArgs(args))
+}
+
+func canonicalArgs(args []byte) json.RawMessage {
+	if len(args) == 0 {
+		return json.RawMessage("{}")
+	}
+	var v any
+	if err := json.Unmarshal(args, &v); err != nil {
+		return json.RawMessage(args)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return json.RawMessage(args)
+	}
+	return out
+}
+
+// ── Record ──
+
+// Recorder appends the calls and results of wrapped tool sets to a JSONL
+// file, for later use with a Replayer.
+type Recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	logged map[string]bool // servers whose declarations were written
+}
+
+// NewRecorder creates (or truncates) the recording at path.
+func NewRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %w", err)
+	}
+	return &Recorder{file: f, logged: make(map[string]bool)}, nil
+}
+
+// Wrap returns toolSets with every tool recording its calls. The map keys
+// are the server names stored in the recording.
+func (r *Recorder) Wrap(toolSets map[string]tool.ToolSet) map[string]tool.ToolSet {
+	out := make(map[string]tool.ToolSet, len(toolSets))
+	for name, ts := range toolSets {
+		out[name] = &recordingToolSet{inner: ts, server: name, rec: r}
+	}
+	return out
+}
+
+// Close closes the recording file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.file.Close()
+}
+
+func (r *Recorder) write(e RecordEntry) {
+	e.RecordedAt = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		logger.L().Warn("MCP recording marshal failed", "tool", e.Tool, "error", err)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.file.Write(append(data, '\n')); err != nil {
+		logger.L().Warn("MCP recording write failed", "tool", e.Tool, "error", err)
+	}
+}
+
+// recordTools writes the declarations and tool set name of a server once.
+func (r *Recorder) recordTools(server, toolSet string, tools []tool.Tool) {
+	r.mu.Lock()
+	done := r.logged[server]
+	r.logged[server] = true
+	r.mu.Unlock()
+	if done {
+		return
+	}
+	decls := make([]tool.Declaration, 0, len(tools))
+	for _, t := range tools {
+		if d := t.Declaration(); d != nil {
+			decls = append(decls, *d)
+		}
+	}
+	r.write(RecordEntry{Kind: RecordTools, Server: server, ToolSet: toolSet, Tools: decls})
+}
+
+type recordingToolSet struct {
+	inner  tool.ToolSet
+	server string
+	rec    *Recorder
+}
+
+func (s *recordingToolSet) Tools(ctx context.Context) []tool.Tool {
+	tools := s.inner.Tools(ctx)
+	s.rec.recordTools(s.server, s.inner.Name(), tools)
+	out := make([]tool.Tool, len(tools))
+	for i, t := range tools {
+		out[i] = &recordingTool{Tool: t, set: s}
+	}
+	return out
+}
+
+// Close is a no-op: the inner tool set is closed by its owner.
+func (s *recordingToolSet) Close() error { return nil }
+
+func (s *recordingToolSet) Name() string { return s.inner.Name() }
+
+type recordingTool struct {
+	tool.Tool
+	set *recordingToolSet
+}
+
+func (t *recordingTool) Call(ctx context.Context, jsonArgs []byte) (any, error) {
+	callable, ok := t.Tool.(tool.CallableTool)
+	if !ok {
+		return nil, fmt.Errorf("tool %s is not callable", t.Declaration().Name)
+	}
+	result, err := callable.Call(ctx, jsonArgs)
+
+	name := t.Declaration().Name
+	entry := RecordEntry{
+		Kind:   RecordCall,
+		Server: t.set.server,
+		Tool:   name,
+		Key:    CallKey(name, jsonArgs),
+		Args:   canonicalArgs(jsonArgs),
+	}
+	if err != nil {
+		entry.Error = err.Error()
+		entry.ErrorCode = string(pipeline.ClassifyToolError(err))
+	} else if data, mErr := json.Marshal(result); mErr == nil {
+		entry.Result = data
+	} else {
+		logger.L().Warn("MCP recording result not serializable", "tool", name, "error", mErr)
+	}
+	t.set.rec.write(entry)
+	return result, err
+}
+
+// ── Replay ──
+
+// Replayer serves recorded results without contacting any server. Calls are
+// matched by server and CallKey; repeated calls with the same key get the
+// recorded results in order, the last one repeating once they run out.
+type Replayer struct {
+	tools map[string][]tool.Declaration
+	names map[string]string // server → recorded tool set name
+	order []string          // servers in recording order
+
+	mu    sync.Mutex
+	calls map[string][]RecordEntry // "server\x00key" → recorded outcomes
+	next  map[string]int
+}
+
+// NewReplayer loads the recording at path.
+func NewReplayer(path string) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %w", err)
+	}
+	defer f.Close()
+
+	r := &Replayer{
+		tools: make(map[string][]tool.Declaration),
+		names: make(map[string]string),
+		calls: make(map[string][]RecordEntry),
+		next:  make(map[string]int),
+	}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e RecordEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("recording %s line %d: %w", path, line, err)
+		}
+		switch e.Kind {
+		case RecordTools:
+			if _, ok := r.tools[e.Server]; !ok {
+				r.order = append(r.order, e.Server)
+			}
+			r.tools[e.Server] = e.Tools
+			r.names[e.Server] = e.ToolSet
+		case RecordCall:
+			k := e.Server + "\x00" + e.Key
+			r.calls[k] = append(r.calls[k], e)
+		default:
+			return nil, fmt.Errorf("recording %s line %d: unknown kind %q", path, line, e.Kind)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read recording: %w", err)
+	}
+	return r, nil
+}
+
+// ToolSets returns one offline tool set per recorded server, for use as
+// FlowOptions.ToolSets in place of the live servers.
+func (r *Replayer) ToolSets() map[string]tool.ToolSet {
+	out := make(map[string]tool.ToolSet, len(r.tools))
+	for server := range r.tools {
+		out[server] = &replayToolSet{server: server, rep: r}
+	}
+	return out
+}
+
+// Servers returns the recorded server names, sorted.
+func (r *Replayer) Servers() []string {
+	out := append([]string(nil), r.order...)
+	sort.Strings(out)
+	return out
+}
+
+func (r *Replayer) replay(server, toolName string, args []byte) (any, error) {
+	key := CallKey(toolName, args)
+	k := server + "\x00" + key
+
+	r.mu.Lock()
+	entries := r.calls[k]
+	i := r.next[k]
+	if i < len(entries)-1 {
+		r.next[k] = i + 1
+	}
+	r.mu.Unlock()
+
+	if len(entries) == 0 {
+		return nil, pipeline.ToolError{
+			Code: pipeline.ErrCodeToolUnavailable,
+			Err:  fmt.Errorf("replay: no recorded call %s on server %s", key, server),
+		}
+	}
+	e := entries[min(i, len(entries)-1)]
+	if e.Error != "" {
+		return nil, pipeline.ToolError{Code: pipeline.ErrorCode(e.ErrorCode), Err: errors.New(e.Error)}
+	}
+	return e.Result, nil
+}
+
+type replayToolSet struct {
+	server string
+	rep    *Replayer
+}
+
+func (s *replayToolSet) Tools(context.Context) []tool.Tool {
+	decls := s.rep.tools[s.server]
+	out := make([]tool.Tool, len(decls))
+	for i := range decls {
+		out[i] = &replayTool{decl: decls[i], set: s}
+	}
+	return out
+}
+
+func (s *replayToolSet) Close() error { return nil }
+
+// Name returns the name the recorded tool set reported, so that replayed tools
+// keep the names the model saw. Recordings without it fall back to the server.
+func (s *replayToolSet) Name() string {
+	if name := s.rep.names[s.server]; name != "" {
+		return name
+	}
+	return s.server
+}
+
+type replayTool struct {
+	decl tool.Declaration
+	set  *replayToolSet
+}
+
+func (t *replayTool) Declaration() *tool.Declaration { return &t.decl }
+
+func (t *replayTool) Call(_ context.Context, jsonArgs []byte) (any, error) {
+	return t.set.rep.replay(t.set.server, t.decl.Name, jsonArgs)
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ tool.ToolSet      = (*recordingToolSet)(nil)
+	_ tool.CallableTool = (*recordingTool)(nil)
+	_ tool.ToolSet      = (*replayToolSet)(nil)
+	_ tool.CallableTool = (*replayTool)(nil)
+)
@@ -0,0 +1,108 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// simTool returns a result derived from its call count, so replays can be
+// told apart from live calls.
+type simTool struct {
+	calls int
+}
+
+func (s *simTool) Declaration() *tool.Declaration {
+	return &tool.Declaration{Name: "run_sim", InputSchema: &tool.Schema{Type: "object"}}
+}
+
+func (s *simTool) Call(_ context.Context, args []byte) (any, error) {
+	s.calls++
+	var in map[string]any
+	_ = json.Unmarshal(args, &in)
+	if in["top"] == "broken" {
+		return nil, errors.New("compile error in broken.v")
+	}
+	return map[string]any{"top": in["top"], "run": s.calls}, nil
+}
+
+func TestCallKey_Canonical(t *testing.T) {
+	a := CallKey("run_sim", []byte(`{"b": 1, "a": [1, 2]}`))
+	b := CallKey("run_sim", []byte(`{"a":[1,2],"b":1}`))
+	if a != b {
+		t.Errorf("keys differ: %q vs %q", a, b)
+	}
+	if CallKey("run_sim", nil) != "run_sim {}" {
+		t.Errorf("empty args key = %q", CallKey("run_sim", nil))
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "calls.jsonl")
+	live := &simTool{}
+
+	rec, err := NewRecorder(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped := rec.Wrap(map[string]tool.ToolSet{"eda": &staticToolSet{name: "mcp", tools: []tool.Tool{live}}})
+	simCall := func(sets map[string]tool.ToolSet, args string) (any, error) {
+		t.Helper()
+		tools := sets["eda"].Tools(ctx)
+		if len(tools) != 1 {
+			t.Fatalf("expected 1 tool, got %d", len(tools))
+		}
+		return tools[0].(tool.CallableTool).Call(ctx, []byte(args))
+	}
+	for _, args := range []string{`{"top":"alu"}`, `{"top": "alu"}`, `{"top":"broken"}`} {
+		_, _ = simCall(wrapped, args)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := NewReplayer(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rep.Servers(); len(got) != 1 || got[0] != "eda" {
+		t.Fatalf("servers = %v", got)
+	}
+	offline := rep.ToolSets()
+	if name := offline["eda"].Name(); name != wrapped["eda"].Name() {
+		t.Errorf("replayed tool set name = %q, recorded %q", name, wrapped["eda"].Name())
+	}
+	if decl := offline["eda"].Tools(ctx)[0].Declaration(); decl.Name != "run_sim" || decl.InputSchema == nil {
+		t.Errorf("declaration not replayed: %+v", decl)
+	}
+
+	want := []string{`{"run":1,"top":"alu"}`, `{"run":2,"top":"alu"}`, `{"run":2,"top":"alu"}`}
+	for i, w := range want {
+		res, err := simCall(offline, `{ "top" : "alu" }`)
+		if err != nil {
+			t.Fatalf("replay %d: %v", i, err)
+		}
+		if got := string(res.(json.RawMessage)); got != w {
+			t.Errorf("replay %d = %s, want %s", i, got, w)
+		}
+	}
+
+	_, err = simCall(offline, `{"top":"broken"}`)
+	if pipeline.ClassifyToolError(err) != pipeline.ErrCodeCompileError {
+		t.Errorf("recorded error not replayed with its code: %v", err)
+	}
+	_, err = simCall(offline, `{"top":"fpu"}`)
+	if pipeline.ClassifyToolError(err) != pipeline.ErrCodeToolUnavailable {
+		t.Errorf("expected unavailable for unrecorded call, got %v", err)
+	}
+	if live.calls != 3 {
+		t.Errorf("replay contacted the server: %d live calls", live.calls)
+	}
+}
@@ -1,29 +1,275 @@
 // Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
 package mcp
 
-import "trpc.group/trpc-go/trpc-agent-go/tool"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
 
-// GetToolSetsByStage returns tool sets for a specific IC design stage
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+// DefaultStages is the IC design flow stage mapping used when mcp.json
+// declares no "stages".
+var DefaultStages = map[string][]string{
+	"planning":   {},
+	"rtl":        {},
+	"simulation": {"eda"},
+	"waveform":   {"eda"},
+	"formal":     {},
+	"synthesis":  {"eda"},
+	"physical":   {"eda"},
+	"layout":     {"eda"},
+	"report":     {"eda"},
+}
+
+// GetToolSetsByStage returns tool sets for a specific IC design stage,
+// as mapped by the "stages" section of mcp.json (or DefaultStages)
 func (m *MCPToolSets) GetToolSetsByStage(stage string) []tool.ToolSet {
-	stageTools := map[string][]string{
-		"planning":   {},
-		"rtl":        {},
-		"simulation": {"eda"},
-		"waveform":   {"eda"},
-		"formal":     {},
-		"synthesis":  {"eda"},
-		"physical":   {"eda"},
-		"layout":     {"eda"},
-		"report":     {"eda"},
-	}
-
-	var result []tool.ToolSet
-	if names, ok := stageTools[stage]; ok {
-		for _, name := range names {
-			if ts := m.toolSets[name]; ts != nil {
-				result = append(result, ts)
+	return m.Registry().ToolSetsForStage(stage)
+}
+
+// ToolSetMap returns the active tool sets keyed by server name
+func (m *MCPToolSets) ToolSetMap() map[string]tool.ToolSet {
+	out := make(map[string]tool.ToolSet, len(m.toolSets))
+	for name, ts := range m.toolSets {
+		out[name] = ts
+	}
+	return out
+}
+
+// Registry returns a StageRegistry over the active tool sets
+func (m *MCPToolSets) Registry() *StageRegistry {
+	stages := m.stages
+	if stages == nil {
+		stages = DefaultStages
+	}
+	return NewStageRegistry(stages, m.ToolSetMap())
+}
+
+// StageRegistry resolves stage names and server globs to tool sets.
+// Stage keys and server references may both be path.Match globs: a stage
+// such as "simulation" collects the servers of every key matching it
+// ("simulation", "sim*", "*"), and a reference such as "eda-*" expands to
+// every loaded server matching it.
+type StageRegistry struct {
+	stages  map[string][]string
+	servers map[string]tool.ToolSet
+}
+
+// NewStageRegistry creates a registry from a stage mapping and the loaded
+// servers (e.g. MCPToolSets.ToolSetMap or Manager.ToolSets).
+func NewStageRegistry(stages map[string][]string, servers map[string]tool.ToolSet) *StageRegistry {
+	return &StageRegistry{stages: stages, servers: servers}
+}
+
+// Validate checks that every pattern is well-formed, that every server
+// reference matches at least one loaded server, and that no concrete stage
+// name shadows a server name.
+func (r *StageRegistry) Validate() error {
+	var errs []error
+	for _, stage := range sortedKeys(r.stages) {
+		if _, err := path.Match(stage, ""); err != nil {
+			errs = append(errs, fmt.Errorf("stage %q: invalid pattern: %w", stage, err))
+		}
+		if _, ok := r.servers[stage]; ok && !isGlob(stage) {
+			errs = append(errs, fmt.Errorf("stage %q: name shadows a server", stage))
+		}
+		for _, ref := range r.stages[stage] {
+			matches, err := r.matchServers(ref)
+			switch {
+			case err != nil:
+				errs = append(errs, fmt.Errorf("stage %q: %w", stage, err))
+			case len(matches) == 0:
+				errs = append(errs, fmt.Errorf("stage %q: %q matches no loaded server", stage, ref))
 			}
 		}
 	}
+	return errors.Join(errs...)
+}
+
+// ToolSetsForStage returns the tool sets mapped to stage, sorted by server
+// name. Unknown stages and unmatched references yield no tool sets.
+func (r *StageRegistry) ToolSetsForStage(stage string) []tool.ToolSet {
+	return r.toolSets(r.stageServers(stage))
+}
+
+// stageServers returns the names of the servers mapped to stage, sorted.
+func (r *StageRegistry) stageServers(stage string) []string {
+	names := make(map[string]bool)
+	for key, refs := range r.stages {
+		if ok, _ := path.Match(key, stage); !ok {
+			continue
+		}
+		for _, ref := range refs {
+			matches, _ := r.matchServers(ref)
+			for _, name := range matches {
+				names[name] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Resolve returns the tool sets a frontmatter tools entry refers to: a
+// server name, a server glob, or a stage.
+func (r *StageRegistry) Resolve(ref string) ([]tool.ToolSet, error) {
+	names, err := r.resolveServers(ref)
+	if err != nil {
+		return nil, err
+	}
+	return r.toolSets(names), nil
+}
+
+// resolveServers returns the names of the servers ref refers to, sorted.
+func (r *StageRegistry) resolveServers(ref string) ([]string, error) {
+	if _, ok := r.servers[ref]; ok {
+		return []string{ref}, nil
+	}
+	if isGlob(ref) {
+		return r.matchServers(ref)
+	}
+	if r.isStage(ref) {
+		return r.stageServers(ref), nil
+	}
+	return nil, fmt.Errorf("%q is neither a loaded server nor a stage", ref)
+}
+
+// FlowToolSets builds the map expected by pipeline.FlowOptions.ToolSets.
+// It contains every loaded server by name plus one merged tool set for each
+// extra name in refs (stage names and globs, typically collected from step
+// frontmatter with StepToolRefs). Unresolvable refs are reported as errors.
+func (r *StageRegistry) FlowToolSets(refs ...string) (map[string]tool.ToolSet, error) {
+	out := make(map[string]tool.ToolSet, len(r.servers)+len(refs))
+	for name, ts := range r.servers {
+		out[name] = ts
+	}
+	var errs []error
+	for _, ref := range refs {
+		if _, ok := out[ref]; ok {
+			continue
+		}
+		names, err := r.resolveServers(ref)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		out[ref] = &mergedToolSet{name: ref, servers: names, sets: r.toolSets(names)}
+	}
+	return out, errors.Join(errs...)
+}
+
+// StepToolRefs returns the distinct tool names referenced by the steps'
+// frontmatter (tools, or mcp as fallback), sorted.
+func StepToolRefs(steps []*pipeline.StepDefinition) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, step := range steps {
+		if step == nil {
+			continue
+		}
+		for _, name := range step.Frontmatter.EffectiveTools() {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				out = append(out, name)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// validateStages validates the "stages" section of config against its
+// enabled servers, before any of them is started. DefaultStages is not
+// validated: it may name servers the configuration does not declare.
+func validateStages(config *MCPConfig) error {
+	if config.Stages == nil {
+		return nil
+	}
+	servers := make(map[string]tool.ToolSet)
+	for name := range enabledServers(config) {
+		servers[name] = nil
+	}
+	if err := NewStageRegistry(config.Stages, servers).Validate(); err != nil {
+		return fmt.Errorf("invalid stages: %w", err)
+	}
+	return nil
+}
+
+func (r *StageRegistry) isStage(name string) bool {
+	for key := range r.stages {
+		if ok, _ := path.Match(key, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchServers returns the loaded server names matching ref, sorted.
+func (r *StageRegistry) matchServers(ref string) ([]string, error) {
+	if _, err := path.Match(ref, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", ref, err)
+	}
+	var out []string
+	for name := range r.servers {
+		if ok, _ := path.Match(ref, name); ok {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (r *StageRegistry) toolSets(names []string) []tool.ToolSet {
+	result := make([]tool.ToolSet, 0, len(names))
+	for _, name := range names {
+		result = append(result, r.servers[name])
+	}
 	return result
 }
+
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergedToolSet exposes several server tool sets under one name. It does not
+// own them: Close is a no-op, servers are closed by their owner.
+type mergedToolSet struct {
+	name    string
+	servers []string // server name of each tool set
+	sets    []tool.ToolSet
+}
+
+func (m *mergedToolSet) Tools(ctx context.Context) []tool.Tool {
+	var out []tool.Tool
+	for _, ts := range m.sets {
+		out = append(out, ts.Tools(ctx)...)
+	}
+	return out
+}
+
+func (m *mergedToolSet) Close() error { return nil }
+
+func (m *mergedToolSet) Name() string { return m.name }
+
+// Verify interface compliance at compile time.
+var _ tool.ToolSet = (*mergedToolSet)(nil)
@@ -0,0 +1,135 @@
+package mcp
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+)
+
+func fakeServers(names ...string) map[string]tool.ToolSet {
+	out := make(map[string]tool.ToolSet, len(names))
+	for _, n := range names {
+		out[n] = &fakeToolSet{name: n}
+	}
+	return out
+}
+
+func toolSetNames(sets []tool.ToolSet) []string {
+	out := make([]string, len(sets))
+	for i, ts := range sets {
+		out[i] = ts.Name()
+	}
+	return out
+}
+
+func TestStageRegistry_ToolSetsForStage(t *testing.T) {
+	r := NewStageRegistry(map[string][]string{
+		"simulation": {"eda", "wave-*"},
+		"sim*":       {"eda"},
+		"*":          {"fs"},
+		"planning":   {},
+	}, fakeServers("eda", "wave-vcd", "wave-fsdb", "fs", "lint"))
+
+	got := strings.Join(toolSetNames(r.ToolSetsForStage("simulation")), ",")
+	if got != "eda,fs,wave-fsdb,wave-vcd" {
+		t.Errorf("simulation = %s", got)
+	}
+	got = strings.Join(toolSetNames(r.ToolSetsForStage("planning")), ",")
+	if got != "fs" {
+		t.Errorf("planning = %s", got)
+	}
+	if err := r.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+}
+
+func TestStageRegistry_Validate(t *testing.T) {
+	r := NewStageRegistry(map[string][]string{
+		"simulation": {"eda", "missing"},
+		"lint":       {"eda"},
+		"bad":        {"[x"},
+	}, fakeServers("eda", "lint"))
+
+	err := r.Validate()
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, want := range []string{`"missing" matches no loaded server`, `stage "lint": name shadows a server`, `invalid pattern "[x"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q missing %q", err, want)
+		}
+	}
+}
+
+func TestStageRegistry_FlowToolSets(t *testing.T) {
+	r := NewStageRegistry(map[string][]string{"simulation": {"eda", "wave"}}, fakeServers("eda", "wave", "fs"))
+	steps := []*pipeline.StepDefinition{
+		{Path: "1.md", Frontmatter: pipeline.Frontmatter{Tools: []string{"fs", "simulation"}}},
+		{Path: "2.md", Frontmatter: pipeline.Frontmatter{Tools: []string{"wa*"}}},
+	}
+
+	got, err := r.FlowToolSets(StepToolRefs(steps)...)
+	if err != nil {
+		t.Fatalf("FlowToolSets: %v", err)
+	}
+	for _, name := range []string{"eda", "wave", "fs", "simulation", "wa*"} {
+		if got[name] == nil {
+			t.Errorf("missing %q", name)
+		}
+	}
+	sim := got["simulation"]
+	if sim.Name() != "simulation" || sim.Tools(context.Background()) != nil {
+		t.Errorf("unexpected merged tool set %q", sim.Name())
+	}
+	if err := sim.Close(); err != nil || got["eda"].(*fakeToolSet).closed {
+		t.Error("merged tool set must not close servers")
+	}
+
+	if _, err := r.FlowToolSets("nope"); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("expected unresolved error, got %v", err)
+	}
+}
+
+func TestMCPToolSets_DefaultStages(t *testing.T) {
+	m := &MCPToolSets{}
+	if sets := m.GetToolSetsByStage("simulation"); len(sets) != 0 {
+		t.Errorf("expected no tool sets without servers, got %d", len(sets))
+	}
+	if _, ok := DefaultStages["simulation"]; !ok {
+		t.Error("legacy simulation stage missing")
+	}
+}
+
+func TestValidateStages_RejectsConfig(t *testing.T) {
+	config := &MCPConfig{
+		MCPServers: map[string]MCPServerConfig{
+			"eda":   {Command: "eda"},
+			"spare": {Command: "spare", Disabled: true},
+		},
+		Stages: map[string][]string{"simulation": {"eda", "spare"}},
+	}
+	ctx := context.Background()
+
+	if _, err := NewMCPToolSetsFromStruct(ctx, config); err == nil || !strings.Contains(err.Error(), `"spare" matches no loaded server`) {
+		t.Fatalf("expected stage error, got %v", err)
+	}
+	m, starts := newFakeManager("")
+	if _, err := m.Apply(ctx, config); err == nil {
+		t.Fatal("expected stage error from Apply")
+	}
+	if len(starts) != 0 || len(m.ToolSets()) != 0 {
+		t.Fatalf("no server should start on invalid stages: %v", starts)
+	}
+
+	config.Stages["simulation"] = []string{"eda"}
+	if _, err := m.Apply(ctx, config); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if err := validateStages(&MCPConfig{}); err != nil {
+		t.Fatalf("default stages must not be validated: %v", err)
+	}
+}
@@ -0,0 +1,254 @@
+// Package mcp provides MCP (Model Context Protocol) tool integration for EDA workflows.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+	tmcp "trpc.group/trpc-go/trpc-mcp-go"
+)
+
+// stdioClientInfo identifies this client to stdio servers launched with env.
+var stdioClientInfo = tmcp.Implementation{Name: "trpc-agent-go", Version: "1.0.0"}
+
+// Backoff between retries, matching tmcp.WithSimpleRetry.
+const (
+	stdioRetryInitial = 500 * time.Millisecond
+	stdioRetryMax     = 8 * time.Second
+)
+
+// stdioToolSet implements tool.ToolSet for a stdio server with its own
+// environment. The variables reach the child through the transport
+// (StdioServerParameters.Env): the parent environment is never modified, they
+// do not appear in the child's argv, and every relaunch gets them.
+//
+// tmcp.StdioClient takes no retry option, so requests failing with a
+// connection error are retried here, relaunching the server, like
+// tmcp.WithSimpleRetry does for the other transports.
+type stdioToolSet struct {
+	params  tmcp.StdioServerParameters
+	timeout time.Duration
+	retries int
+	filter  tool.FilterFunc // optional
+
+	mu     sync.Mutex
+	client *tmcp.StdioClient
+	tools  []tool.Tool
+}
+
+func newStdioToolSet(params tmcp.StdioServerParameters, timeout time.Duration, retries int, filter tool.FilterFunc) *stdioToolSet {
+	return &stdioToolSet{params: params, timeout: timeout, retries: retries, filter: filter}
+}
+
+// Init launches the server if needed and loads its tools.
+func (s *stdioToolSet) Init(ctx context.Context) error {
+	if err := s.refresh(ctx); err != nil {
+		return fmt.Errorf("failed to initialize MCP tool set %q: %w", s.Name(), err)
+	}
+	return nil
+}
+
+// Tools implements tool.ToolSet. It refreshes the tool list and returns the
+// cached one if the server cannot be reached.
+func (s *stdioToolSet) Tools(ctx context.Context) []tool.Tool {
+	if err := s.refresh(ctx); err != nil {
+		logger.L().Warn("MCP tools refresh failed", "command", s.params.Command, "error", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]tool.Tool, len(s.tools))
+	copy(out, s.tools)
+	return out
+}
+
+// Name implements tool.ToolSet.
+func (s *stdioToolSet) Name() string {
+	return "mcp"
+}
+
+// Close implements tool.ToolSet. It stops the server process.
+func (s *stdioToolSet) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.disconnect()
+}
+
+// connect returns the client of the running server, launching it first if
+// needed. Callers hold s.mu.
+func (s *stdioToolSet) connect(ctx context.Context) (*tmcp.StdioClient, error) {
+	if s.client != nil {
+		return s.client, nil
+	}
+	client, err := tmcp.NewStdioClient(tmcp.StdioTransportConfig{ServerParams: s.params, Timeout: s.timeout}, stdioClientInfo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MCP client: %w", err)
+	}
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	if _, err := client.Initialize(ctx, &tmcp.InitializeRequest{}); err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("failed to initialize MCP session: %w", err)
+	}
+	s.client = client
+	return client, nil
+}
+
+// disconnect stops the server so the next call relaunches it. Callers hold
+// s.mu.
+func (s *stdioToolSet) disconnect() error {
+	if s.client == nil {
+		return nil
+	}
+	err := s.client.Close()
+	s.client = nil
+	return err
+}
+
+func (s *stdioToolSet) refresh(ctx context.Context) error {
+	return s.retry(ctx, func() error { return s.listTools(ctx) })
+}
+
+func (s *stdioToolSet) listTools(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	client, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	listCtx, cancel := s.withTimeout(ctx)
+	defer cancel()
+	rsp, err := client.ListTools(listCtx, &tmcp.ListToolsRequest{})
+	if err != nil {
+		_ = s.disconnect()
+		return fmt.Errorf("failed to list tools: %w", err)
+	}
+
+	tools := make([]tool.Tool, 0, len(rsp.Tools))
+	for _, t := range rsp.Tools {
+		tools = append(tools, &stdioTool{decl: stdioDeclaration(t), owner: s})
+	}
+	if s.filter != nil {
+		tools = tool.FilterTools(ctx, tools, s.filter)
+	}
+	s.tools = tools
+	return nil
+}
+
+func (s *stdioToolSet) call(ctx context.Context, name string, args map[string]any) ([]tmcp.Content, error) {
+	var rsp *tmcp.CallToolResult
+	err := s.retry(ctx, func() error {
+		s.mu.Lock()
+		client, err := s.connect(ctx)
+		s.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		callCtx, cancel := s.withTimeout(ctx)
+		defer cancel()
+		req := &tmcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		rsp, err = client.CallTool(callCtx, req)
+		if err != nil {
+			if isConnectionError(err) {
+				s.mu.Lock()
+				if s.client == client {
+					_ = s.disconnect()
+				}
+				s.mu.Unlock()
+			}
+			return fmt.Errorf("failed to call tool %s: %w", name, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Content) == 0 && rsp.StructuredContent != nil {
+		b, err := json.Marshal(rsp.StructuredContent)
+		if err != nil {
+			return nil, fmt.Errorf("marshal structured content: %w", err)
+		}
+		return []tmcp.Content{tmcp.NewTextContent(string(b))}, nil
+	}
+	return rsp.Content, nil
+}
+
+// retry runs fn, retrying it up to s.retries times with exponential backoff
+// while it fails with a connection error.
+func (s *stdioToolSet) retry(ctx context.Context, fn func() error) error {
+	backoff := stdioRetryInitial
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= s.retries || !isConnectionError(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, stdioRetryMax)
+	}
+}
+
+func (s *stdioToolSet) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || s.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
+
+// stdioDeclaration converts the declaration of an MCP tool.
+func stdioDeclaration(t tmcp.Tool) *tool.Declaration {
+	return &tool.Declaration{
+		Name:         t.Name,
+		Description:  t.Description,
+		InputSchema:  convertSchema(t.InputSchema),
+		OutputSchema: convertSchema(t.OutputSchema),
+	}
+}
+
+// convertSchema converts an MCP JSON schema through its JSON form.
+func convertSchema(schema any) *tool.Schema {
+	b, err := json.Marshal(schema)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+	out := &tool.Schema{}
+	if err := json.Unmarshal(b, out); err != nil {
+		return &tool.Schema{Type: "object"}
+	}
+	return out
+}
+
+// stdioTool is a tool of a stdioToolSet.
+type stdioTool struct {
+	decl  *tool.Declaration
+	owner *stdioToolSet
+}
+
+func (t *stdioTool) Declaration() *tool.Declaration { return t.decl }
+
+func (t *stdioTool) Call(ctx context.Context, jsonArgs []byte) (any, error) {
+	args := map[string]any{}
+	if len(jsonArgs) > 0 {
+		if err := json.Unmarshal(jsonArgs, &args); err != nil {
+			return nil, fmt.Errorf("failed to parse tool arguments: %w", err)
+		}
+	}
+	return t.owner.call(ctx, t.decl.Name, args)
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ tool.ToolSet      = (*stdioToolSet)(nil)
+	_ tool.CallableTool = (*stdioTool)(nil)
+)
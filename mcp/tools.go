@@ -3,8 +3,11 @@ package mcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/package-register/trpc-agent-go-extensions/logger"
@@ -32,125 +35,216 @@ func NewMCPToolSetsFromStruct(ctx context.Context, config *MCPConfig, exportOpts
 	for _, o := range exportOpts {
 		o(&eopts)
 	}
-	sets := &MCPToolSets{
-		toolSets: make(map[string]*mcp.ToolSet),
+	if err := validateStages(config); err != nil {
+		return nil, err
 	}
-
-	defaultTimeout := time.Duration(config.Defaults.Timeout) * time.Second
-	if defaultTimeout == 0 {
-		defaultTimeout = 30 * time.Second
+	sets := &MCPToolSets{
+		toolSets: make(map[string]tool.ToolSet),
+		stages:   config.Stages,
 	}
-	defaultRetries := config.Defaults.Retries
-	if defaultRetries == 0 {
-		defaultRetries = 2
+	if !config.Policy.empty() {
+		policy, err := NewPolicy(config.Policy)
+		if err != nil {
+			return nil, err
+		}
+		sets.policy = policy
 	}
 
-	var initErrors []error
-
+	// Build all tool sets first so configuration errors fail fast, then
+	// initialize them in parallel.
+	pending := make(map[string]serverToolSet)
 	for name, serverCfg := range config.MCPServers {
 		if serverCfg.Disabled {
 			logger.L().Info("MCP server disabled", "name", name)
 			continue
 		}
-
-		timeout := defaultTimeout
-		if serverCfg.Timeout > 0 {
-			timeout = time.Duration(serverCfg.Timeout) * time.Second
+		toolSet, err := newServerToolSet(serverCfg, config.Defaults)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
 		}
+		pending[name] = toolSet
+	}
 
-		// Determine transport type
-		var transport string
-		var command string
-		var args []string
-		var serverURL string
-		var headers map[string]string
-
-		// Determine transport based on configuration
-		if serverCfg.Transport != "" {
-			// Use explicitly configured transport
-			transport = serverCfg.Transport
-		} else if serverCfg.ServerUrl != "" {
-			// Default to streamable for HTTP URLs
-			transport = "streamable"
-		} else {
-			// Default to stdio
-			transport = "stdio"
+	var mu sync.Mutex
+	var initErrors []error
+	names := make([]string, 0, len(pending))
+	for name := range pending {
+		names = append(names, name)
+	}
+	runBounded(names, config.Defaults.maxConcurrentInit(), func(name string) {
+		toolSet := pending[name]
+		if err := toolSet.Init(ctx); err != nil {
+			logger.L().Error("MCP server init failed", "name", name, "error", err)
+			mu.Lock()
+			initErrors = append(initErrors, fmt.Errorf("%s: %w", name, err))
+			mu.Unlock()
+			return
 		}
+		var active tool.ToolSet = toolSet
+		if eopts.health != nil {
+			active = startHealthChecked(ctx, name, toolSet, func(ctx context.Context) (tool.ToolSet, error) {
+				return startServer(ctx, name, config.MCPServers[name], config.Defaults)
+			}, *eopts.health)
+		}
+		logger.L().Info("MCP server initialized", "name", name, "tools", len(active.Tools(ctx)))
+		mu.Lock()
+		sets.toolSets[name] = active
+		mu.Unlock()
+	})
 
-		// Set transport-specific configuration
-		switch transport {
-		case "stdio":
-			command = serverCfg.Command
-			args = serverCfg.Args
-		case "sse", "streamable":
-			serverURL = serverCfg.ServerUrl
-			headers = serverCfg.Headers
-		default:
-			return nil, fmt.Errorf("unsupported transport: %s, supported: stdio, sse, streamable", transport)
+	if len(initErrors) > 0 {
+		logger.L().Warn("MCP init errors", "failed", len(initErrors))
+		for _, err := range initErrors {
+			logger.L().Warn("MCP init error detail", "error", err)
 		}
+	}
 
-		// Create tool set
-		var opts []mcp.ToolSetOption
-		opts = append(opts, mcp.WithMCPOptions(tmcp.WithSimpleRetry(defaultRetries)))
+	logger.L().Info("MCP servers ready", "active", len(sets.toolSets), "total", len(config.MCPServers))
 
-		// Add tool filter only if tools are configured
-		if len(serverCfg.Tools) > 0 {
-			opts = append(opts, mcp.WithToolFilterFunc(tool.NewIncludeToolNamesFilter(serverCfg.Tools...)))
+	if eopts.lockfilePath != "" {
+		err := CheckLockfile(ctx, sets.ToolSetMap(), eopts.lockfilePath, eopts.driftMode)
+		var drift *DriftError
+		switch {
+		case errors.As(err, &drift):
+			sets.Close()
+			return nil, err
+		case err != nil:
+			logger.L().Warn("MCP lockfile not checked", "path", eopts.lockfilePath, "error", err)
 		}
+	}
 
-		toolSet := mcp.NewMCPToolSet(
-			mcp.ConnectionConfig{
-				Transport: transport,
-				Command:   command,
-				Args:      args,
-				ServerURL: serverURL,
-				Headers:   headers,
-				Timeout:   timeout,
-			},
-			opts...,
-		)
-
-		// Set environment variables before init, restore after
-		savedEnv := make(map[string]string, len(serverCfg.Env))
-		for k, v := range serverCfg.Env {
-			savedEnv[k] = os.Getenv(k)
-			if err := os.Setenv(k, v); err != nil {
-				logger.L().Warn("MCP failed to set env", "key", k, "error", err)
-			}
-		}
+	// Run exports if any enabled
+	runExports(ctx, sets, config, eopts)
 
-		if err := toolSet.Init(ctx); err != nil {
-			initErrors = append(initErrors, fmt.Errorf("%s: %w", name, err))
-			logger.L().Error("MCP server init failed", "name", name, "error", err)
+	return sets, nil
+}
+
+// serverToolSet is the tool set of one server; Init connects to the server
+// and loads its tools.
+type serverToolSet interface {
+	tool.ToolSet
+	Init(ctx context.Context) error
+}
+
+// startServer creates and initializes the tool set for one server.
+func startServer(ctx context.Context, _ string, serverCfg MCPServerConfig, defaults MCPDefaults) (serverToolSet, error) {
+	toolSet, err := newServerToolSet(serverCfg, defaults)
+	if err != nil {
+		return nil, err
+	}
+	if err := toolSet.Init(ctx); err != nil {
+		return nil, err
+	}
+	return toolSet, nil
+}
+
+// runBounded calls fn for every name with at most limit calls in flight and
+// waits for all of them to finish.
+func runBounded(names []string, limit int, fn func(name string)) {
+	if limit <= 0 {
+		limit = 1
+	}
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(name string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(name)
+		}(name)
+	}
+	wg.Wait()
+}
+
+// newServerToolSet builds an uninitialized tool set from a server
+// configuration. Stdio servers with env get a stdioToolSet, which passes the
+// variables through the transport.
+func newServerToolSet(serverCfg MCPServerConfig, defaults MCPDefaults) (serverToolSet, error) {
+	timeout := time.Duration(defaults.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+	if serverCfg.Timeout > 0 {
+		timeout = time.Duration(serverCfg.Timeout) * time.Second
+	}
+	retries := defaults.Retries
+	if retries == 0 {
+		retries = 2
+	}
+
+	// Determine transport based on configuration
+	transport := serverCfg.Transport
+	if transport == "" {
+		if serverCfg.ServerUrl != "" {
+			// Default to streamable for HTTP URLs
+			transport = "streamable"
 		} else {
-			sets.toolSets[name] = toolSet
-			tools := toolSet.Tools(ctx)
-			logger.L().Info("MCP server initialized", "name", name, "tools", len(tools))
+			transport = "stdio"
 		}
+	}
 
-		// Restore environment variables
-		for k, v := range savedEnv {
-			if v == "" {
-				_ = os.Unsetenv(k)
-			} else {
-				_ = os.Setenv(k, v)
+	// Set transport-specific configuration
+	conn := mcp.ConnectionConfig{Transport: transport, Timeout: timeout}
+	switch transport {
+	case "stdio":
+		for k := range serverCfg.Env {
+			if k == "" || strings.ContainsAny(k, "=\x00") {
+				return nil, fmt.Errorf("invalid env name %q", k)
 			}
 		}
+		conn.Command = serverCfg.Command
+		conn.Args = serverCfg.Args
+	case "sse", "streamable":
+		conn.ServerURL = serverCfg.ServerUrl
+		conn.Headers = serverCfg.Headers
+	default:
+		return nil, fmt.Errorf("unsupported transport: %s, supported: stdio, sse, streamable", transport)
 	}
 
-	if len(initErrors) > 0 {
-		logger.L().Warn("MCP init errors", "failed", len(initErrors))
-		for _, err := range initErrors {
-			logger.L().Warn("MCP init error detail", "error", err)
+	opts := []mcp.ToolSetOption{mcp.WithMCPOptions(tmcp.WithSimpleRetry(retries))}
+	if conn.ServerURL != "" {
+		opts = append(opts, mcp.WithMCPOptions(tmcp.WithHTTPReqHandler(newTracePropagation())))
+	}
+
+	// Add tool filter only if tools are configured
+	var filter tool.FilterFunc
+	if len(serverCfg.Tools) > 0 || len(serverCfg.Deny) > 0 {
+		for _, p := range append(append([]string(nil), serverCfg.Tools...), serverCfg.Deny...) {
+			if _, err := path.Match(p, ""); err != nil {
+				return nil, fmt.Errorf("invalid tool pattern %q: %w", p, err)
+			}
 		}
+		filter = toolNameFilter(serverCfg.Tools, serverCfg.Deny)
+		opts = append(opts, mcp.WithToolFilterFunc(filter))
 	}
 
-	logger.L().Info("MCP servers ready", "active", len(sets.toolSets), "total", len(config.MCPServers))
+	if transport == "stdio" && len(serverCfg.Env) > 0 {
+		params := tmcp.StdioServerParameters{Command: conn.Command, Args: conn.Args, Env: serverCfg.Env}
+		return newStdioToolSet(params, timeout, retries, filter), nil
+	}
+	return mcp.NewMCPToolSet(conn, opts...), nil
+}
 
-	// Run exports if any enabled
-	runExports(ctx, sets, config, eopts)
+// toolNameFilter keeps tools whose name matches an include glob (any, when
+// include is empty) and no deny glob.
+func toolNameFilter(include, deny []string) tool.FilterFunc {
+	return func(_ context.Context, t tool.Tool) bool {
+		name := t.Declaration().Name
+		return (len(include) == 0 || matchAny(include, name)) && !matchAny(deny, name)
+	}
+}
 
-	return sets, nil
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
 }
 
 // GetActiveToolSets returns all successfully initialized tool sets
@@ -162,8 +256,16 @@ func (m *MCPToolSets) GetActiveToolSets() []tool.ToolSet {
 	return result
 }
 
-// GetToolSet returns a specific tool set by name
+// GetToolSet returns a specific tool set by name. It returns nil for servers
+// not backed by an *mcp.ToolSet (stdio servers with env, or servers wrapped by
+// WithHealthCheck); use ToolSet for those.
 func (m *MCPToolSets) GetToolSet(name string) *mcp.ToolSet {
+	ts, _ := m.toolSets[name].(*mcp.ToolSet)
+	return ts
+}
+
+// ToolSet returns a specific tool set by name, whatever its implementation.
+func (m *MCPToolSets) ToolSet(name string) tool.ToolSet {
 	return m.toolSets[name]
 }
 
@@ -0,0 +1,145 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"trpc.group/trpc-go/trpc-agent-go/tool"
+	tmcp "trpc.group/trpc-go/trpc-mcp-go"
+)
+
+// testServerArg makes the test binary serve testStdioServer instead of
+// running the tests, so stdio tool sets can launch a real MCP server.
+const testServerArg = "mcp-test-server"
+
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == testServerArg {
+		testStdioServer()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// testStdioServer serves the tools "run_sim" and "shell" over stdio.
+func testStdioServer() {
+	srv := tmcp.NewStdioServer("test", "1.0.0")
+	for _, name := range []string{"run_sim", "shell"} {
+		srv.RegisterTool(tmcp.NewTool(name, tmcp.WithString("top")), func(context.Context, *tmcp.CallToolRequest) (*tmcp.CallToolResult, error) {
+			return tmcp.NewTextResult(name + " ok"), nil
+		})
+	}
+	_ = srv.Start()
+}
+
+// testServerConfig returns the config of a stdio server running testStdioServer.
+func testServerConfig(env map[string]string) MCPServerConfig {
+	return MCPServerConfig{Command: os.Args[0], Args: []string{testServerArg}, Env: env}
+}
+
+func TestNewServerToolSet_PassesEnvThroughTransport(t *testing.T) {
+	const key = "MCP_TEST_EMPTY_VAR"
+	t.Setenv(key, "")
+
+	cfg := MCPServerConfig{
+		Command: "sim-server",
+		Args:    []string{"--port", "1"},
+		Env:     map[string]string{"TOKEN": "secret", "HOME": "/tmp/x"},
+	}
+	ts, err := newServerToolSet(cfg, MCPDefaults{Retries: 4})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	stdio, ok := ts.(*stdioToolSet)
+	if !ok {
+		t.Fatalf("expected *stdioToolSet, got %T", ts)
+	}
+	if stdio.retries != 4 {
+		t.Fatalf("expected retries from defaults, got %d", stdio.retries)
+	}
+	if stdio.params.Command != "sim-server" || strings.Join(stdio.params.Args, "|") != "--port|1" {
+		t.Fatalf("unexpected command: %s %q", stdio.params.Command, stdio.params.Args)
+	}
+	if stdio.params.Env["TOKEN"] != "secret" || stdio.params.Env["HOME"] != "/tmp/x" {
+		t.Fatalf("env not passed to transport: %v", stdio.params.Env)
+	}
+
+	// The parent environment is untouched, including variables set to "".
+	if v, ok := os.LookupEnv(key); !ok || v != "" {
+		t.Fatalf("parent env modified: %q %v", v, ok)
+	}
+	if _, ok := os.LookupEnv("TOKEN"); ok {
+		t.Fatal("server env leaked into parent process")
+	}
+
+	if ts, _ := newServerToolSet(MCPServerConfig{Command: "sim-server"}, MCPDefaults{}); ts == nil {
+		t.Fatal("expected tool set without env")
+	} else if _, ok := ts.(*stdioToolSet); ok {
+		t.Fatal("expected the default tool set without env")
+	}
+	if _, err := newServerToolSet(MCPServerConfig{Command: "sim-server", Env: map[string]string{"A=B": "x"}}, MCPDefaults{}); err == nil {
+		t.Fatal("expected error for invalid env name")
+	}
+}
+
+func TestStdioToolSet_RetriesConnectionErrors(t *testing.T) {
+	s := newStdioToolSet(tmcp.StdioServerParameters{}, 0, 1, nil)
+	var attempts int
+	err := s.retry(context.Background(), func() error {
+		attempts++
+		return errors.New("write |1: broken pipe")
+	})
+	if err == nil || attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d (%v)", attempts, err)
+	}
+
+	attempts = 0
+	_ = s.retry(context.Background(), func() error {
+		attempts++
+		return errors.New("invalid arguments")
+	})
+	if attempts != 1 {
+		t.Fatalf("expected no retry for a tool error, got %d attempts", attempts)
+	}
+}
+
+func TestMCPToolSets_GetToolSet(t *testing.T) {
+	stdio := newStdioToolSet(tmcp.StdioServerParameters{Command: "sim-server"}, 0, 0, nil)
+	sets := &MCPToolSets{toolSets: map[string]tool.ToolSet{"sim": stdio}}
+	if sets.GetToolSet("sim") != nil {
+		t.Fatal("GetToolSet must only return *mcp.ToolSet servers")
+	}
+	if sets.ToolSet("sim") != stdio {
+		t.Fatal("ToolSet must return any server tool set")
+	}
+}
+
+func TestRunBounded(t *testing.T) {
+	var inFlight, peak, calls int32
+	var mu sync.Mutex
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+
+	runBounded(names, 3, func(string) {
+		n := atomic.AddInt32(&inFlight, 1)
+		mu.Lock()
+		if n > peak {
+			peak = n
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		atomic.AddInt32(&calls, 1)
+	})
+
+	if calls != int32(len(names)) {
+		t.Fatalf("expected %d calls, got %d", len(names), calls)
+	}
+	if peak > 3 || peak < 2 {
+		t.Fatalf("expected bounded parallelism (2..3), got peak %d", peak)
+	}
+}
@@ -0,0 +1,497 @@
+// Package mcpserver exposes a pipeline to other agents as an MCP server.
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/flow"
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+	"github.com/package-register/trpc-agent-go-extensions/step"
+	"github.com/package-register/trpc-agent-go-extensions/telemetry"
+
+	tmcp "trpc.group/trpc-go/trpc-mcp-go"
+)
+
+// ArtifactURIScheme prefixes the URIs of artifact resources, e.g.
+// "artifact://docs/spec.md".
+const ArtifactURIScheme = "artifact://"
+
+const defaultMaxRuns = 100
+
+// RunRequest describes one pipeline run started through the MCP server.
+type RunRequest struct {
+	RunID     string
+	Input     string // user message that starts the run
+	StartAt   string // see pipeline.FlowOptions.StartAt
+	StopAfter string // see pipeline.FlowOptions.StopAfter
+	// OnStep should be called when a step starts, to report progress.
+	OnStep func(stepID string)
+}
+
+// PipelineRunner executes a pipeline run and returns when it finishes,
+// typically by building a graph with StartAt/StopAfter and running it.
+type PipelineRunner func(ctx context.Context, req RunRequest) error
+
+// PipelineServerConfig configures a PipelineServer.
+type PipelineServerConfig struct {
+	Name      string // server name (default "pipeline")
+	Version   string // server version (default "1.0.0")
+	Steps     []*pipeline.StepDefinition
+	Runner    PipelineRunner
+	Artifacts memory.ArtifactTracker // optional; source of list_artifacts
+	Workspace pipeline.FileSystem    // optional; serves artifact resources
+	// Sequential selects run windows by step order instead of next/fallback
+	// edges; set it when the Runner builds chain or agent flows.
+	Sequential bool
+	// MaxRuns is the number of finished runs kept for get_progress
+	// (default 100). Older ones are evicted.
+	MaxRuns int
+}
+
+// RunStatus is the state of a pipeline run.
+type RunStatus string
+
+const (
+	RunRunning   RunStatus = "running"
+	RunSucceeded RunStatus = "succeeded"
+	RunFailed    RunStatus = "failed"
+)
+
+// RunProgress is the get_progress result.
+type RunProgress struct {
+	RunID       string    `json:"run_id"`
+	Status      RunStatus `json:"status"`
+	CurrentStep string    `json:"current_step,omitempty"`
+	Completed   []string  `json:"completed"`
+	Total       int       `json:"total"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitzero"`
+}
+
+// ArtifactEntry is one element of the list_artifacts result.
+type ArtifactEntry struct {
+	Step   string `json:"step"`
+	Title  string `json:"title,omitempty"`
+	Path   string `json:"path"`
+	URI    string `json:"uri"`
+	Lines  int    `json:"lines"`
+	Status string `json:"status"`
+}
+
+type pipelineRun struct {
+	progress RunProgress
+	steps    map[string]bool // step IDs in the run window
+}
+
+type serverTool struct {
+	tool    *tmcp.Tool
+	handler func(context.Context, *tmcp.CallToolRequest) (*tmcp.CallToolResult, error)
+}
+
+type serverResource struct {
+	resource *tmcp.Resource
+	handler  func(context.Context, *tmcp.ReadResourceRequest) (tmcp.ResourceContents, error)
+}
+
+// PipelineServer exposes a pipeline to other agents over MCP. Each step is
+// published as a tool "step_<id>" that runs that step alone; run_pipeline
+// runs a window of steps; get_progress and list_artifacts report on runs;
+// the declared outputs of every step are published as artifact resources.
+// Runs execute in the background, one at a time.
+type PipelineServer struct {
+	cfg       PipelineServerConfig
+	tools     []serverTool
+	resources []serverResource
+
+	mu     sync.Mutex
+	runs   map[string]*pipelineRun
+	done   []string // IDs of finished runs, oldest first
+	last   string   // ID of the most recent run
+	seq    int
+	active bool
+	cancel context.CancelFunc
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewPipelineServer creates a server for cfg.Steps. A Runner is required.
+func NewPipelineServer(cfg PipelineServerConfig) (*PipelineServer, error) {
+	if cfg.Runner == nil {
+		return nil, errors.New("pipeline server requires a runner")
+	}
+	if cfg.Name == "" {
+		cfg.Name = "pipeline"
+	}
+	if cfg.Version == "" {
+		cfg.Version = "1.0.0"
+	}
+	if cfg.MaxRuns <= 0 {
+		cfg.MaxRuns = defaultMaxRuns
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &PipelineServer{
+		cfg:    cfg,
+		runs:   make(map[string]*pipelineRun),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if err := s.buildTools(); err != nil {
+		cancel()
+		return nil, err
+	}
+	s.buildResources()
+	return s, nil
+}
+
+// ServeStdio serves MCP over stdin/stdout until ctx is cancelled or stdin
+// is closed. Stdout carries the protocol, so the global logger writes to
+// stderr while serving; the Runner must not write to stdout either.
+func (s *PipelineServer) ServeStdio(ctx context.Context) error {
+	prev := logger.SetOutput(os.Stderr)
+	defer logger.SetOutput(prev)
+
+	srv := tmcp.NewStdioServer(s.cfg.Name, s.cfg.Version)
+	for _, t := range s.tools {
+		srv.RegisterTool(t.tool, t.handler)
+	}
+	for _, r := range s.resources {
+		srv.RegisterResource(r.resource, r.handler)
+	}
+	return srv.StartWithContext(ctx)
+}
+
+// HTTPHandler returns a streamable HTTP handler serving MCP at path
+// (default "/mcp"), for mounting in an existing server.
+func (s *PipelineServer) HTTPHandler(path string) http.Handler {
+	return s.httpServer("", path).HTTPHandler()
+}
+
+// ListenAndServe serves streamable HTTP MCP on addr at "/mcp".
+func (s *PipelineServer) ListenAndServe(addr string) error {
+	return s.httpServer(addr, "").Start()
+}
+
+func (s *PipelineServer) httpServer(addr, path string) *tmcp.Server {
+	if path == "" {
+		path = "/mcp"
+	}
+	opts := []tmcp.ServerOption{tmcp.WithServerPath(path)}
+	if addr != "" {
+		opts = append(opts, tmcp.WithServerAddress(addr))
+	}
+	srv := tmcp.NewServer(s.cfg.Name, s.cfg.Version, opts...)
+	for _, t := range s.tools {
+		srv.RegisterTool(t.tool, t.handler)
+	}
+	for _, r := range s.resources {
+		srv.RegisterResource(r.resource, r.handler)
+	}
+	return srv
+}
+
+// Close cancels the active run and waits for it to return.
+func (s *PipelineServer) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// StartRun starts a run in the background and returns its ID. It fails if
+// another run is still active or the window is invalid.
+func (s *PipelineServer) StartRun(input, startAt, stopAfter string) (string, error) {
+	window, err := s.window(startAt, stopAfter)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	if s.active {
+		s.mu.Unlock()
+		return "", fmt.Errorf("run %s is still running", s.last)
+	}
+	s.seq++
+	id := fmt.Sprintf("run-%d", s.seq)
+	run := &pipelineRun{
+		progress: RunProgress{RunID: id, Status: RunRunning, Completed: []string{}, Total: len(window), StartedAt: time.Now()},
+		steps:    make(map[string]bool, len(window)),
+	}
+	for _, stepID := range window {
+		run.steps[stepID] = true
+	}
+	s.runs[id], s.last, s.active = run, id, true
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	req := RunRequest{
+		RunID:     id,
+		Input:     input,
+		StartAt:   startAt,
+		StopAfter: stopAfter,
+		OnStep:    func(stepID string) { s.onStep(run, stepID) },
+	}
+	go func() {
+		defer s.wg.Done()
+		ctx := telemetry.WithRun(s.ctx, telemetry.RunInfo{RunID: id, Tags: []string{"mcp"}})
+		err := s.cfg.Runner(ctx, req)
+		s.finish(run, err)
+	}()
+	logger.L().Info("Pipeline run started", "run", id, "start_at", startAt, "stop_after", stopAfter)
+	return id, nil
+}
+
+// Progress returns the progress of runID, or of the latest run when runID
+// is empty.
+func (s *PipelineServer) Progress(runID string) (RunProgress, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if runID == "" {
+		runID = s.last
+	}
+	run, ok := s.runs[runID]
+	if !ok {
+		if runID == "" {
+			return RunProgress{}, errors.New("no run started")
+		}
+		return RunProgress{}, fmt.Errorf("unknown run %s", runID)
+	}
+	p := run.progress
+	p.Completed = s.completed(run)
+	return p, nil
+}
+
+// Artifacts lists the recorded artifacts, ordered by step.
+func (s *PipelineServer) Artifacts() []ArtifactEntry {
+	entries := []ArtifactEntry{}
+	if s.cfg.Artifacts == nil {
+		return entries
+	}
+	for _, a := range s.cfg.Artifacts.GetAll() {
+		entries = append(entries, ArtifactEntry{
+			Step:   a.StepID,
+			Title:  a.Title,
+			Path:   a.FilePath,
+			URI:    ArtifactURIScheme + a.FilePath,
+			Lines:  a.LineCount,
+			Status: a.Status,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return step.CompareStepIDs(entries[i].Step, entries[j].Step) < 0 })
+	return entries
+}
+
+func (s *PipelineServer) onStep(run *pipelineRun, stepID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.progress.CurrentStep = stepID
+}
+
+func (s *PipelineServer) finish(run *pipelineRun, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.progress.FinishedAt = time.Now()
+	run.progress.CurrentStep = ""
+	run.progress.Status = RunSucceeded
+	if err != nil {
+		run.progress.Status = RunFailed
+		run.progress.Error = err.Error()
+		logger.L().Warn("Pipeline run failed", "run", run.progress.RunID, "error", err)
+	} else {
+		logger.L().Info("Pipeline run finished", "run", run.progress.RunID)
+	}
+	s.active = false
+
+	s.done = append(s.done, run.progress.RunID)
+	for len(s.done) > s.cfg.MaxRuns {
+		delete(s.runs, s.done[0])
+		s.done = s.done[1:]
+	}
+}
+
+// completed returns the steps of run with a recorded artifact. Callers hold s.mu.
+func (s *PipelineServer) completed(run *pipelineRun) []string {
+	out := []string{}
+	if s.cfg.Artifacts == nil {
+		return out
+	}
+	for stepID, a := range s.cfg.Artifacts.GetAll() {
+		if run.steps[stepID] && !a.CreatedAt.Before(run.progress.StartedAt.Truncate(time.Second)) {
+			out = append(out, stepID)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return step.CompareStepIDs(out[i], out[j]) < 0 })
+	return out
+}
+
+// window returns the IDs of the steps run by a startAt..stopAfter window.
+func (s *PipelineServer) window(startAt, stopAfter string) ([]string, error) {
+	window, _, err := flow.RunWindow(s.cfg.Steps, startAt, stopAfter, s.cfg.Sequential)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(window))
+	for _, def := range window {
+		ids = append(ids, def.Frontmatter.Step)
+	}
+	return ids, nil
+}
+
+// ── Tools ──
+
+// buildTools registers the step tools and the run tools. Step IDs that map to
+// the same tool name (e.g. "3.1" and "3-1") are rejected.
+func (s *PipelineServer) buildTools() error {
+	names := make(map[string]string, len(s.cfg.Steps))
+	for _, def := range s.cfg.Steps {
+		stepID := def.Frontmatter.Step
+		name := StepToolName(stepID)
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("steps %s and %s map to the same tool name %s", other, stepID, name)
+		}
+		names[name] = stepID
+		s.tools = append(s.tools, serverTool{
+			tool: tmcp.NewTool(name,
+				tmcp.WithDescription(stepDescription(def)),
+				tmcp.WithString("input", tmcp.Description("Instructions or context for this step"))),
+			handler: func(_ context.Context, req *tmcp.CallToolRequest) (*tmcp.CallToolResult, error) {
+				return s.startRunResult(stringArg(req, "input"), stepID, stepID)
+			},
+		})
+	}
+
+	s.tools = append(s.tools,
+		serverTool{
+			tool: tmcp.NewTool("run_pipeline",
+				tmcp.WithDescription("Run the pipeline in the background and return a run ID. Optionally restrict it to the steps from start_at to stop_after."),
+				tmcp.WithString("input", tmcp.Description("Instructions or context for the run")),
+				tmcp.WithString("start_at", tmcp.Description("First step ID to run; outputs of the steps leading to it must already exist")),
+				tmcp.WithString("stop_after", tmcp.Description("Last step ID to run"))),
+			handler: func(_ context.Context, req *tmcp.CallToolRequest) (*tmcp.CallToolResult, error) {
+				return s.startRunResult(stringArg(req, "input"), stringArg(req, "start_at"), stringArg(req, "stop_after"))
+			},
+		},
+		serverTool{
+			tool: tmcp.NewTool("get_progress",
+				tmcp.WithDescription("Report the status, current step and completed steps of a run."),
+				tmcp.WithString("run_id", tmcp.Description("Run ID; defaults to the latest run"))),
+			handler: func(_ context.Context, req *tmcp.CallToolRequest) (*tmcp.CallToolResult, error) {
+				p, err := s.Progress(stringArg(req, "run_id"))
+				if err != nil {
+					return tmcp.NewErrorResult(err.Error()), nil
+				}
+				return jsonResult(p)
+			},
+		},
+		serverTool{
+			tool: tmcp.NewTool("list_artifacts",
+				tmcp.WithDescription("List the documents produced by pipeline steps, with their resource URIs.")),
+			handler: func(context.Context, *tmcp.CallToolRequest) (*tmcp.CallToolResult, error) {
+				return jsonResult(s.Artifacts())
+			},
+		},
+	)
+	return nil
+}
+
+func (s *PipelineServer) startRunResult(input, startAt, stopAfter string) (*tmcp.CallToolResult, error) {
+	id, err := s.StartRun(input, startAt, stopAfter)
+	if err != nil {
+		return tmcp.NewErrorResult(err.Error()), nil
+	}
+	return jsonResult(map[string]string{"run_id": id, "status": string(RunRunning)})
+}
+
+// StepToolName returns the MCP tool name of a step, e.g. "step_3_1".
+func StepToolName(stepID string) string {
+	return "step_" + strings.NewReplacer(".", "_", "-", "_", " ", "_").Replace(stepID)
+}
+
+func stepDescription(def *pipeline.StepDefinition) string {
+	desc := fmt.Sprintf("Run pipeline step %s", def.Frontmatter.Step)
+	if def.Frontmatter.Title != "" {
+		desc += ": " + def.Frontmatter.Title
+	}
+	if len(def.Frontmatter.Output) > 0 {
+		desc += ". Produces " + strings.Join(def.Frontmatter.Output, ", ")
+	}
+	return desc + ". Earlier step outputs must already exist."
+}
+
+func stringArg(req *tmcp.CallToolRequest, name string) string {
+	s, _ := req.Params.Arguments[name].(string)
+	return strings.TrimSpace(s)
+}
+
+func jsonResult(v any) (*tmcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return tmcp.NewTextResult(string(data)), nil
+}
+
+// ── Resources ──
+
+func (s *PipelineServer) buildResources() {
+	if s.cfg.Workspace == nil {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, def := range s.cfg.Steps {
+		for _, out := range def.Frontmatter.Output {
+			if out == "" || seen[out] {
+				continue
+			}
+			seen[out] = true
+			uri := ArtifactURIScheme + out
+			s.resources = append(s.resources, serverResource{
+				resource: &tmcp.Resource{
+					Name:        out,
+					URI:         uri,
+					Description: fmt.Sprintf("Output of step %s %s", def.Frontmatter.Step, def.Frontmatter.Title),
+					MimeType:    mimeType(out),
+				},
+				handler: func(context.Context, *tmcp.ReadResourceRequest) (tmcp.ResourceContents, error) {
+					return s.readArtifact(uri)
+				},
+			})
+		}
+	}
+}
+
+// readArtifact returns the content of an artifact URI from the workspace.
+func (s *PipelineServer) readArtifact(uri string) (tmcp.ResourceContents, error) {
+	p, ok := strings.CutPrefix(uri, ArtifactURIScheme)
+	if !ok || s.cfg.Workspace == nil {
+		return nil, fmt.Errorf("unknown resource %s", uri)
+	}
+	data, err := s.cfg.Workspace.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("artifact %s not available: %w", p, err)
+	}
+	return tmcp.TextResourceContents{URI: uri, MIMEType: mimeType(p), Text: string(data)}, nil
+}
+
+func mimeType(name string) string {
+	switch path.Ext(name) {
+	case ".md":
+		return "text/markdown"
+	case ".json":
+		return "application/json"
+	case ".yaml", ".yml":
+		return "application/yaml"
+	default:
+		return "text/plain"
+	}
+}
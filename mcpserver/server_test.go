@@ -0,0 +1,379 @@
+package mcpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/memory"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	tmcp "trpc.group/trpc-go/trpc-mcp-go"
+)
+
+func serverSteps() []*pipeline.StepDefinition {
+	return []*pipeline.StepDefinition{
+		{Frontmatter: pipeline.Frontmatter{Step: "1.1", Title: "需求分析", Output: pipeline.OutputField{"docs/spec.md"}}},
+		{Frontmatter: pipeline.Frontmatter{Step: "2.1", Title: "RTL开发", Output: pipeline.OutputField{"docs/rtl.md"}}},
+		{Frontmatter: pipeline.Frontmatter{Step: "3.1", Title: "功能仿真", Output: pipeline.OutputField{"docs/sim.md"}}},
+	}
+}
+
+// newTestPipelineServer returns a server whose runner writes the output of
+// every step in the window and records it. Runs block until release is closed.
+func newTestPipelineServer(t *testing.T, release chan struct{}, maxRuns int) (*PipelineServer, *[]RunRequest) {
+	t.Helper()
+	dir := t.TempDir()
+	ws := pipeline.NewOSFS(dir)
+	tracker := memory.NewFileTracker(ws)
+	steps := serverSteps()
+	var requests []RunRequest
+
+	s, err := NewPipelineServer(PipelineServerConfig{
+		Steps:      steps,
+		Artifacts:  tracker,
+		Workspace:  ws,
+		Sequential: true,
+		MaxRuns:    maxRuns,
+		Runner: func(ctx context.Context, req RunRequest) error {
+			requests = append(requests, req)
+			<-release
+			if req.Input == "fail" {
+				return errors.New("model unavailable")
+			}
+			inWindow := req.StartAt == ""
+			for _, def := range steps {
+				id := def.Frontmatter.Step
+				if id == req.StartAt {
+					inWindow = true
+				}
+				if !inWindow {
+					continue
+				}
+				req.OnStep(id)
+				out := def.Frontmatter.PrimaryOutput()
+				if err := os.MkdirAll(filepath.Join(dir, filepath.Dir(out)), 0o755); err != nil {
+					return err
+				}
+				if err := os.WriteFile(filepath.Join(dir, out), []byte("# "+def.Frontmatter.Title+"\n"), 0o644); err != nil {
+					return err
+				}
+				tracker.RecordCompleted(id, def.Frontmatter.Title, out)
+				if id == req.StopAfter {
+					break
+				}
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s, &requests
+}
+
+func waitForStatus(t *testing.T, s *PipelineServer, runID string) RunProgress {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		p, err := s.Progress(runID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Status != RunRunning {
+			return p
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("run %s did not finish", runID)
+	return RunProgress{}
+}
+
+func TestPipelineServer_Runs(t *testing.T) {
+	release := make(chan struct{})
+	s, requests := newTestPipelineServer(t, release, 0)
+
+	id, err := s.StartRun("go", "", "2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StartRun("again", "", ""); err == nil {
+		t.Error("expected concurrent run to be rejected")
+	}
+	close(release)
+
+	p := waitForStatus(t, s, id)
+	if p.Status != RunSucceeded || p.Total != 2 || strings.Join(p.Completed, ",") != "1.1,2.1" {
+		t.Errorf("unexpected progress %+v", p)
+	}
+	if (*requests)[0].StopAfter != "2.1" {
+		t.Errorf("runner got %+v", (*requests)[0])
+	}
+
+	arts := s.Artifacts()
+	if len(arts) != 2 || arts[0].URI != "artifact://docs/spec.md" || arts[1].Step != "2.1" {
+		t.Errorf("unexpected artifacts %+v", arts)
+	}
+
+	id, err = s.StartRun("fail", "3.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := waitForStatus(t, s, id); p.Status != RunFailed || p.Error != "model unavailable" {
+		t.Errorf("unexpected failed progress %+v", p)
+	}
+
+	if _, err := s.StartRun("", "9.9", ""); err == nil {
+		t.Error("expected unknown step error")
+	}
+	if _, err := s.StartRun("", "3.1", "1.1"); err == nil {
+		t.Error("expected inverted window error")
+	}
+	if _, err := s.Progress("run-42"); err == nil {
+		t.Error("expected unknown run error")
+	}
+}
+
+func TestPipelineServer_EvictsFinishedRuns(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	s, _ := newTestPipelineServer(t, release, 1)
+
+	first, err := s.StartRun("", "1.1", "1.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, s, first)
+	second, err := s.StartRun("", "2.1", "2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, s, second)
+
+	if _, err := s.Progress(first); err == nil {
+		t.Error("expected the oldest finished run to be evicted")
+	}
+	if p, err := s.Progress(""); err != nil || p.RunID != second {
+		t.Errorf("latest run should be kept: %+v, %v", p, err)
+	}
+}
+
+func TestPipelineServer_StreamableHTTP(t *testing.T) {
+	release := make(chan struct{})
+	close(release)
+	s, requests := newTestPipelineServer(t, release, 0)
+
+	httpSrv := httptest.NewServer(s.HTTPHandler("/mcp"))
+	defer httpSrv.Close()
+
+	ctx := context.Background()
+	// The client's background GET SSE stream races on its session ID.
+	client, err := tmcp.NewClient(httpSrv.URL+"/mcp", tmcp.Implementation{Name: "test", Version: "1.0.0"},
+		tmcp.WithClientGetSSEEnabled(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, err := client.Initialize(ctx, &tmcp.InitializeRequest{}); err != nil {
+		t.Fatalf("Initialize: %v", err)
+	}
+
+	list, err := client.ListTools(ctx, &tmcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	for _, tl := range list.Tools {
+		names[tl.Name] = true
+	}
+	for _, want := range []string{"step_1_1", "step_2_1", "step_3_1", "run_pipeline", "get_progress", "list_artifacts"} {
+		if !names[want] {
+			t.Errorf("missing tool %s", want)
+		}
+	}
+
+	call := func(name string, args map[string]any) string {
+		t.Helper()
+		req := &tmcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = args
+		res, err := client.CallTool(ctx, req)
+		if err != nil {
+			t.Fatalf("CallTool %s: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("CallTool %s returned error result: %+v", name, res.Content)
+		}
+		return res.Content[0].(tmcp.TextContent).Text
+	}
+
+	var started map[string]string
+	if err := json.Unmarshal([]byte(call("step_1_1", map[string]any{"input": "write the spec"})), &started); err != nil {
+		t.Fatal(err)
+	}
+	waitForStatus(t, s, started["run_id"])
+	if r := (*requests)[0]; r.StartAt != "1.1" || r.StopAfter != "1.1" || r.Input != "write the spec" {
+		t.Errorf("step tool started %+v", r)
+	}
+
+	var progress RunProgress
+	if err := json.Unmarshal([]byte(call("get_progress", nil)), &progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.RunID != started["run_id"] || progress.Status != RunSucceeded {
+		t.Errorf("unexpected progress %+v", progress)
+	}
+	if !strings.Contains(call("list_artifacts", nil), "artifact://docs/spec.md") {
+		t.Error("list_artifacts missing spec")
+	}
+
+	readReq := &tmcp.ReadResourceRequest{}
+	readReq.Params.URI = "artifact://docs/spec.md"
+	read, err := client.ReadResource(ctx, readReq)
+	if err != nil {
+		t.Fatalf("ReadResource: %v", err)
+	}
+	if len(read.Contents) != 1 {
+		t.Fatalf("unexpected contents %+v", read.Contents)
+	}
+	if text, ok := read.Contents[0].(tmcp.TextResourceContents); !ok || text.Text != "# 需求分析\n" {
+		t.Errorf("unexpected resource %#v", read.Contents[0])
+	}
+}
+
+func TestStepToolName(t *testing.T) {
+	if got := StepToolName("3.1-b"); got != "step_3_1_b" {
+		t.Errorf("StepToolName = %s", got)
+	}
+}
+
+func TestNewPipelineServer_RejectsCollidingToolNames(t *testing.T) {
+	_, err := NewPipelineServer(PipelineServerConfig{
+		Steps: []*pipeline.StepDefinition{
+			{Frontmatter: pipeline.Frontmatter{Step: "3.1"}},
+			{Frontmatter: pipeline.Frontmatter{Step: "3-1"}},
+		},
+		Runner: func(context.Context, RunRequest) error { return nil },
+	})
+	if err == nil || !strings.Contains(err.Error(), "step_3_1") {
+		t.Errorf("expected tool name collision error, got %v", err)
+	}
+}
+
+const stdioServerArg = "pipeline-stdio-server"
+
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == stdioServerArg {
+		testStdioServer()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// testStdioServer serves serverSteps over stdio with a runner that logs
+// through the global logger, like the flow middlewares do.
+func testStdioServer() {
+	s, err := NewPipelineServer(PipelineServerConfig{
+		Steps: serverSteps(),
+		Runner: func(ctx context.Context, req RunRequest) error {
+			for _, def := range serverSteps() {
+				req.OnStep(def.Frontmatter.Step)
+				logger.L().Warn("Token budget exceeded", "step", def.Frontmatter.Step)
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		os.Exit(1)
+	}
+	defer s.Close()
+	_ = s.ServeStdio(context.Background())
+}
+
+func TestPipelineServer_StdioStdoutCarriesOnlyJSONRPC(t *testing.T) {
+	cmd := exec.Command(os.Args[0], stdioServerArg)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = cmd.Process.Kill(); _ = cmd.Wait() })
+
+	lines := bufio.NewScanner(stdout)
+	send := func(msg string) {
+		t.Helper()
+		if _, err := io.WriteString(stdin, msg+"\n"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// receive reads stdout up to the response to id, failing on any line
+	// that is not a JSON-RPC frame.
+	receive := func(id int) string {
+		t.Helper()
+		for lines.Scan() {
+			var frame struct {
+				JSONRPC string          `json:"jsonrpc"`
+				ID      *int            `json:"id"`
+				Result  json.RawMessage `json:"result"`
+			}
+			if err := json.Unmarshal(lines.Bytes(), &frame); err != nil || frame.JSONRPC != "2.0" {
+				t.Fatalf("stdout line is not a JSON-RPC frame: %q", lines.Text())
+			}
+			if frame.ID != nil && *frame.ID == id {
+				return string(frame.Result)
+			}
+		}
+		t.Fatalf("stdout closed before response %d: %v\nstderr: %s", id, lines.Err(), stderr.String())
+		return ""
+	}
+
+	send(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0.0"}}}`)
+	receive(1)
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	send(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"run_pipeline","arguments":{"input":"go"}}}`)
+	if res := receive(2); !strings.Contains(res, "run-1") {
+		t.Fatalf("unexpected run_pipeline result %s", res)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for id := 3; ; id++ {
+		send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"get_progress","arguments":{}}}`, id))
+		if strings.Contains(receive(id), string(RunSucceeded)) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_ = stdin.Close()
+	for lines.Scan() {
+		if !strings.Contains(lines.Text(), `"jsonrpc":"2.0"`) {
+			t.Errorf("stdout line is not a JSON-RPC frame: %q", lines.Text())
+		}
+	}
+	if !strings.Contains(stderr.String(), "Pipeline run finished") {
+		t.Errorf("expected run logs on stderr, got %q", stderr.String())
+	}
+}
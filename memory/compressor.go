@@ -84,6 +84,12 @@ func (c *LLMCompressor) CompressIfNeeded(
 	return compressed, didCompress, nil
 }
 
+// Compress implements ForceCompressor. It compresses msgs regardless of the
+// threshold; histories too short to compress are returned unchanged.
+func (c *LLMCompressor) Compress(ctx context.Context, msgs []model.Message) ([]model.Message, error) {
+	return c.compress(ctx, msgs)
+}
+
 // compress performs the actual message compression.
 // Layer-aware: preserves all system messages (Layer 1+2 and previous summaries),
 // only compresses Layer 3 conversation messages (user/assistant).
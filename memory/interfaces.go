@@ -12,6 +12,12 @@ type Compressor interface {
 	CompressIfNeeded(ctx context.Context, msgs []model.Message, currentTokens int) (compressed []model.Message, didCompress bool, err error)
 }
 
+// ForceCompressor is implemented by compressors that can compress regardless
+// of their threshold, e.g. when a token budget is nearly spent.
+type ForceCompressor interface {
+	Compress(ctx context.Context, msgs []model.Message) ([]model.Message, error)
+}
+
 // ArtifactTracker tracks produced documents across pipeline steps.
 type ArtifactTracker interface {
 	RecordCompleted(stepID, title, outputPath string) bool
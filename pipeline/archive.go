@@ -0,0 +1,188 @@
+package pipeline
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenArchive opens a .zip, .tar.gz/.tgz or .tar archive held in memory as a
+// read-only FileSystem. The format is chosen from the name's extension.
+func OpenArchive(name string, data []byte) (FileSystem, error) {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("open zip %s: %w", name, err)
+		}
+		return NewIOFS(zr), nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("open gzip %s: %w", name, err)
+		}
+		defer gz.Close()
+		mfs, err := readTar(gz)
+		if err != nil {
+			return nil, fmt.Errorf("open tar %s: %w", name, err)
+		}
+		return NewIOFS(mfs), nil
+	case strings.HasSuffix(lower, ".tar"):
+		mfs, err := readTar(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("open tar %s: %w", name, err)
+		}
+		return NewIOFS(mfs), nil
+	default:
+		return nil, fmt.Errorf("unsupported archive format: %s (supported: .zip, .tar.gz, .tgz, .tar)", name)
+	}
+}
+
+// readTar loads all regular files of a tar stream into memory.
+func readTar(r io.Reader) (*memFS, error) {
+	mfs := &memFS{files: make(map[string]*memFile)}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return mfs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if name == "" {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", hdr.Name, err)
+		}
+		mfs.files[name] = &memFile{
+			name:    path.Base(name),
+			data:    data,
+			mode:    fs.FileMode(hdr.Mode).Perm(),
+			modTime: hdr.ModTime,
+		}
+	}
+}
+
+// memFS is a minimal read-only in-memory fs.FS. Directories are implied by
+// the paths of the files they contain.
+type memFS struct {
+	files map[string]*memFile
+}
+
+// memFile is a regular file in a memFS. It doubles as its own fs.FileInfo.
+type memFile struct {
+	name    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (f *memFile) Name() string       { return f.name }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() fs.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() any           { return nil }
+
+// Open implements fs.FS.
+func (m *memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := m.files[name]; ok {
+		return &memOpenFile{info: f, Reader: bytes.NewReader(f.data)}, nil
+	}
+
+	entries := m.dirEntries(name)
+	if entries == nil && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memDir{
+		info:    &memFile{name: path.Base(name), mode: fs.ModeDir | 0o555},
+		entries: entries,
+	}, nil
+}
+
+// dirEntries lists the direct children of dir, or nil if dir does not exist.
+func (m *memFS) dirEntries(dir string) []fs.DirEntry {
+	prefix := dir + "/"
+	if dir == "." {
+		prefix = ""
+	}
+	seen := make(map[string]fs.DirEntry)
+	for p, f := range m.files {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok {
+			continue
+		}
+		if child, _, isDir := strings.Cut(rest, "/"); isDir {
+			seen[child] = fs.FileInfoToDirEntry(&memFile{name: child, mode: fs.ModeDir | 0o555})
+		} else {
+			seen[child] = fs.FileInfoToDirEntry(f)
+		}
+	}
+	if len(seen) == 0 {
+		return nil
+	}
+	entries := make([]fs.DirEntry, 0, len(seen))
+	for _, e := range seen {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries
+}
+
+type memOpenFile struct {
+	*bytes.Reader
+	info *memFile
+}
+
+func (f *memOpenFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *memOpenFile) Close() error               { return nil }
+
+type memDir struct {
+	info    *memFile
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	d.offset += n
+	return remaining[:n], nil
+}
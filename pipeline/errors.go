@@ -17,6 +17,7 @@ const (
 	ErrCodeToolUnavailable ErrorCode = "tool_unavailable"
 	ErrCodeInputMissing    ErrorCode = "input_missing"
 	ErrCodeRuntimeError    ErrorCode = "runtime_error"
+	ErrCodePolicyViolation ErrorCode = "policy_violation"
 	ErrCodeUnknown         ErrorCode = "unknown"
 )
 
@@ -64,7 +65,9 @@ func ClassifyToolError(err error) ErrorCode {
 		return ErrCodeTimeout
 	case strings.Contains(msg, "tool") && strings.Contains(msg, "not found"):
 		return ErrCodeToolUnavailable
-	case strings.Contains(msg, "unavailable") || strings.Contains(msg, "connection refused"):
+	case strings.Contains(msg, "unavailable") || strings.Contains(msg, "connection refused"),
+		strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe"),
+		strings.Contains(msg, "transport is closed"):
 		return ErrCodeToolUnavailable
 	case strings.Contains(msg, "not found") || strings.Contains(msg, "missing"):
 		return ErrCodeInputMissing
@@ -50,6 +50,8 @@ type Frontmatter struct {
 	Advance         AdvanceMode       `yaml:"advance"`
 	Model           string            `yaml:"model"`
 	MaxOutputTokens int               `yaml:"max_output_tokens"`
+	Extends         string            `yaml:"extends"`
+	Tags            []string          `yaml:"tags"`
 }
 
 // EffectiveTools returns Tools if set, otherwise falls back to MCP.
@@ -73,6 +75,13 @@ type StepDefinition struct {
 	Path        string
 	Frontmatter Frontmatter
 	Body        string
+	// Keys lists the frontmatter keys the source declared (including inherited
+	// ones), sorted. Nil when unknown, e.g. for steps built in code.
+	Keys []string
+	// Unset lists the frontmatter keys the source declared null, as dotted
+	// paths (e.g. "fallback.compile_error"), sorted. Patch overlays remove
+	// them from the step they patch.
+	Unset []string
 }
 
 // LoadStep reads and parses a step definition file from disk.
@@ -96,19 +105,39 @@ func LoadStep(path string) (*StepDefinition, error) {
 
 // ParsePrompt splits YAML frontmatter and returns the body content.
 func ParsePrompt(content string) (Frontmatter, string, error) {
-	var frontmatter Frontmatter
+	raw, body, err := SplitPrompt(content)
+	if err != nil {
+		return Frontmatter{}, "", err
+	}
 
+	frontmatter, err := DecodeFrontmatter([]byte(raw))
+	if err != nil {
+		return frontmatter, "", err
+	}
+	return frontmatter, body, nil
+}
+
+// SplitPrompt separates the raw YAML frontmatter from the body without
+// decoding it, so callers can merge inherited keys before typing them.
+func SplitPrompt(content string) (string, string, error) {
 	if !strings.HasPrefix(content, "---") {
-		return frontmatter, "", fmt.Errorf("frontmatter delimiter not found")
+		return "", "", fmt.Errorf("frontmatter delimiter not found")
 	}
 
 	parts := strings.SplitN(content[len("---"):], "---", 2)
 	if len(parts) < 2 {
-		return frontmatter, "", fmt.Errorf("frontmatter end delimiter not found")
+		return "", "", fmt.Errorf("frontmatter end delimiter not found")
 	}
 
-	if err := yaml.Unmarshal([]byte(parts[0]), &frontmatter); err != nil {
-		return frontmatter, "", fmt.Errorf("parse frontmatter: %w", err)
+	return parts[0], trimLeadingNewline(parts[1]), nil
+}
+
+// DecodeFrontmatter decodes raw YAML into a Frontmatter and applies defaults.
+func DecodeFrontmatter(data []byte) (Frontmatter, error) {
+	var frontmatter Frontmatter
+
+	if err := yaml.Unmarshal(data, &frontmatter); err != nil {
+		return frontmatter, fmt.Errorf("parse frontmatter: %w", err)
 	}
 
 	if frontmatter.Advance == "" {
@@ -120,8 +149,7 @@ func ParsePrompt(content string) (Frontmatter, string, error) {
 		frontmatter.Tools = frontmatter.MCP
 	}
 
-	body := trimLeadingNewline(parts[1])
-	return frontmatter, body, nil
+	return frontmatter, nil
 }
 
 func trimLeadingNewline(value string) string {
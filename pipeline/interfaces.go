@@ -26,6 +26,36 @@ type FlowOptions struct {
 	Middlewares     []Middleware
 	Assembler       PromptAssembler   // optional; builds LLM system instructions
 	BaseVars        map[string]string // template variables passed to Assembler
+
+	// StrictTemplates makes undefined template variables and missing
+	// artifacts in the instructions built by Assembler fail the build. The
+	// Assembler must implement StrictAssembler.
+	StrictTemplates bool
+
+	// StartAt and StopAfter restrict the run to a window of steps. With
+	// StartAt, the outputs of the steps leading to it must already exist in
+	// Workspace; they are recorded into Artifacts (if set) before the run.
+	StartAt   string
+	StopAfter string
+	Workspace FileSystem       // required with StartAt
+	Artifacts ArtifactRecorder // optional; e.g. memory.ArtifactTracker
+
+	// ToolScope, if set, restricts the tool sets each step can use
+	// (e.g. mcp.Policy).
+	ToolScope ToolScoper
+}
+
+// ToolScoper narrows or wraps the tool sets resolved for a step, e.g. to
+// enforce per-step tool policies. Agent mode scopes its single node as "agent".
+// names[i] is the FlowOptions.ToolSets key toolSets[i] was resolved from.
+type ToolScoper interface {
+	ScopeToolSets(stepID string, names []string, toolSets []tool.ToolSet) []tool.ToolSet
+}
+
+// ArtifactRecorder records a completed step output. It is the subset of
+// memory.ArtifactTracker the flow builders need to seed resumed runs.
+type ArtifactRecorder interface {
+	RecordCompleted(stepID, title, outputPath string) bool
 }
 
 // Middleware wraps LLM node callbacks for cross-cutting concerns
@@ -35,6 +65,42 @@ type Middleware interface {
 	WrapPostNode(stepID string, step *StepDefinition) graph.AfterNodeCallback
 }
 
+// CallbackMiddleware is an optional extension of Middleware for middlewares
+// that observe model and tool calls (e.g. tracing). Builders attach the
+// callbacks to the step's LLM node and tools node; either may be nil.
+type CallbackMiddleware interface {
+	Middleware
+	ModelCallbacks(stepID string, step *StepDefinition) *model.Callbacks
+	ToolCallbacks(stepID string, step *StepDefinition) *tool.Callbacks
+}
+
+// FlowMode is the topology a FlowBuilder builds.
+type FlowMode string
+
+const (
+	FlowChain FlowMode = "chain"
+	FlowGraph FlowMode = "graph"
+	FlowAgent FlowMode = "agent" // a single node scoped as "agent"
+)
+
+// FlowInfo describes a built flow to middlewares.
+type FlowInfo struct {
+	Mode FlowMode
+	// Exits holds the steps after which the run reaches the end of the
+	// graph (unless a node routes elsewhere with a graph.Command).
+	Exits map[string]bool
+}
+
+// FlowMiddleware is an optional extension of Middleware for middlewares
+// that depend on the built flow (e.g. to end a trace when the run ends).
+// Builders call BindFlow before wrapping any node, and attach the error
+// callback (if non-nil) to every node of the step.
+type FlowMiddleware interface {
+	Middleware
+	BindFlow(info FlowInfo)
+	NodeErrorCallback(stepID string, step *StepDefinition) graph.OnNodeErrorCallback
+}
+
 // ──────────────────── 文件系统抽象 ────────────────────
 
 // FileSystem abstracts file access so that implementations can be swapped
@@ -53,3 +119,12 @@ type PromptAssembler interface {
 	BuildDynamic(ctx context.Context, step *StepDefinition, vars map[string]string) (string, error)
 	HasDynamicContent() bool
 }
+
+// StrictAssembler is an optional extension of PromptAssembler for assemblers
+// that render step bodies as templates (see FlowOptions.StrictTemplates).
+type StrictAssembler interface {
+	PromptAssembler
+	// StrictTemplates returns a copy of the assembler whose template
+	// rendering fails on undefined variables and missing artifacts.
+	StrictTemplates() PromptAssembler
+}
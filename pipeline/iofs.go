@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// IOFS adapts any fs.FS (embed.FS, zip.Reader, fs.Sub, ...) to FileSystem.
+// Names are cleaned and made unrooted before they reach the underlying FS,
+// so "./prompts/" and "/prompts" both resolve to "prompts".
+type IOFS struct {
+	fsys fs.FS
+}
+
+// NewIOFS wraps fsys as a FileSystem.
+func NewIOFS(fsys fs.FS) *IOFS {
+	return &IOFS{fsys: fsys}
+}
+
+// Open implements fs.FS.
+func (f *IOFS) Open(name string) (fs.File, error) {
+	return f.fsys.Open(f.resolve(name))
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *IOFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(f.fsys, f.resolve(name))
+}
+
+// Stat implements FileSystem.
+func (f *IOFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(f.fsys, f.resolve(name))
+}
+
+// ReadDir implements FileSystem.
+func (f *IOFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(f.fsys, f.resolve(name))
+}
+
+func (f *IOFS) resolve(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// Verify interface compliance at compile time.
+var _ FileSystem = (*IOFS)(nil)
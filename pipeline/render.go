@@ -2,12 +2,23 @@ package pipeline
 
 import "strings"
 
-// RenderTemplate replaces {{key}} placeholders with values from vars.
+// RenderTemplate renders content with a non-strict TemplateEngine, so that
+// {{#if}}/{{#each}} blocks work while unknown placeholders are left as-is.
+// Templates that fail to parse fall back to plain {{key}} replacement. Without
+// vars, content is returned unchanged.
 func RenderTemplate(content string, vars map[string]string) string {
 	if content == "" || len(vars) == 0 {
 		return content
 	}
 
+	data := make(map[string]any, len(vars))
+	for k, v := range vars {
+		data[k] = v
+	}
+	if rendered, err := NewTemplateEngine().Render(content, data); err == nil {
+		return rendered
+	}
+
 	rendered := content
 	for key, value := range vars {
 		placeholder := "{{" + key + "}}"
@@ -23,3 +23,15 @@ func TestRenderTemplateEmptyVars(t *testing.T) {
 		t.Fatalf("expected input unchanged, got %q", got)
 	}
 }
+
+func TestRenderTemplateEmptyVarsLeavesBlocksVerbatim(t *testing.T) {
+	for _, input := range []string{
+		"{{#if name}}Hello {{name}}{{/if}}",
+		"{{#each items}}- {{this}}\n{{/each}}",
+		`See {{artifact "docs/a.md"}}`,
+	} {
+		if got := RenderTemplate(input, map[string]string{}); got != input {
+			t.Errorf("expected %q unchanged, got %q", input, got)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+package pipeline
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth bounds nested {{> snippet}} includes to catch include cycles.
+const maxIncludeDepth = 16
+
+// TemplateEngine renders step bodies and output templates.
+//
+// The syntax is a Handlebars-compatible subset that keeps plain {{key}}
+// placeholders working unchanged:
+//
+//	{{key}}  {{a.b}}                  variable (dotted paths walk nested maps)
+//	{{#if key}}…{{else}}…{{/if}}      conditional; {{#unless key}} negates
+//	{{#each input}}{{this}}{{/each}}  iteration; {{@index}} is the 0-based index
+//	{{> snippet}}                     include system/snippet.md (rendered with the same data)
+//	{{artifact "docs/a.md"}}          content of a workspace file
+//	{{artifact_head "docs/a.md" 20}}  first N lines of a workspace file
+//	{{artifact_lines "docs/a.md"}}    line count of a workspace file
+//
+// Helper arguments may be quoted literals or variable names. Tags that are not
+// valid expressions are emitted verbatim. In non-strict mode undefined
+// variables and unreadable artifacts are also emitted verbatim; in strict mode
+// they are an error.
+type TemplateEngine struct {
+	includeFS  FileSystem
+	includeDir string
+	artifactFS FileSystem
+	strict     bool
+}
+
+// TemplateOption configures a TemplateEngine.
+type TemplateOption func(*TemplateEngine)
+
+// WithIncludeFS sets the filesystem and directory that {{> name}} resolves
+// against. dir defaults to "system".
+func WithIncludeFS(fs FileSystem, dir string) TemplateOption {
+	return func(e *TemplateEngine) {
+		e.includeFS = fs
+		if dir != "" {
+			e.includeDir = dir
+		}
+	}
+}
+
+// WithArtifactFS sets the workspace filesystem used by the artifact helpers.
+func WithArtifactFS(fs FileSystem) TemplateOption {
+	return func(e *TemplateEngine) { e.artifactFS = fs }
+}
+
+// WithStrict makes undefined variables and missing artifacts render errors.
+func WithStrict(strict bool) TemplateOption {
+	return func(e *TemplateEngine) { e.strict = strict }
+}
+
+// NewTemplateEngine creates a template engine.
+func NewTemplateEngine(opts ...TemplateOption) *TemplateEngine {
+	e := &TemplateEngine{includeDir: "system"}
+	for _, o := range opts {
+		o(e)
+	}
+	return e
+}
+
+// With returns a copy of the engine with opts applied.
+func (e *TemplateEngine) With(opts ...TemplateOption) *TemplateEngine {
+	c := *e
+	for _, o := range opts {
+		o(&c)
+	}
+	return &c
+}
+
+// Strict reports whether the engine fails on undefined variables.
+func (e *TemplateEngine) Strict() bool {
+	return e.strict
+}
+
+// Render parses and renders content with the given data.
+func (e *TemplateEngine) Render(content string, data map[string]any) (string, error) {
+	if !strings.Contains(content, "{{") {
+		return content, nil
+	}
+	nodes, err := parseTemplate(content)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	r := &templateRun{engine: e, sb: &sb}
+	if err := r.exec(nodes, []templateScope{{item: data}}); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+// StepTemplateData builds the template data for a step: vars plus the step's
+// list-valued frontmatter (input, output, tools) for use with {{#each}}.
+func StepTemplateData(step *StepDefinition, vars map[string]string) map[string]any {
+	data := make(map[string]any, len(vars)+6)
+	data["step"] = step.Frontmatter.Step
+	data["title"] = step.Frontmatter.Title
+	data["input"] = step.Frontmatter.Input
+	data["output"] = []string(step.Frontmatter.Output)
+	data["tools"] = step.Frontmatter.EffectiveTools()
+	data["next"] = step.Frontmatter.Next
+	for k, v := range vars {
+		data[k] = v
+	}
+	return data
+}
+
+// ──────────────────── parse ────────────────────
+
+type templateNodeKind int
+
+const (
+	nodeText templateNodeKind = iota
+	nodeVar
+	nodeHelper
+	nodeInclude
+	nodeIf
+	nodeEach
+)
+
+type templateNode struct {
+	kind     templateNodeKind
+	text     string // nodeText: literal; nodeVar: path; nodeInclude: name; nodeHelper: name
+	raw      string // original tag, emitted verbatim for unresolved tags in non-strict mode
+	args     []string
+	negate   bool // nodeIf: {{#unless}}
+	body     []templateNode
+	elseBody []templateNode
+}
+
+type templateBlock struct {
+	node   *templateNode
+	name   string
+	inElse bool
+	parent *[]templateNode
+}
+
+var templateHelpers = map[string]bool{
+	"artifact":       true,
+	"artifact_head":  true,
+	"artifact_lines": true,
+}
+
+func parseTemplate(content string) ([]templateNode, error) {
+	var root []templateNode
+	cur := &root
+	var stack []*templateBlock
+
+	appendText := func(s string) {
+		if s == "" {
+			return
+		}
+		if n := len(*cur); n > 0 && (*cur)[n-1].kind == nodeText {
+			(*cur)[n-1].text += s
+			return
+		}
+		*cur = append(*cur, templateNode{kind: nodeText, text: s})
+	}
+
+	rest := content
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			appendText(rest)
+			break
+		}
+		end := strings.Index(rest[start+2:], "}}")
+		if end < 0 {
+			appendText(rest)
+			break
+		}
+		appendText(rest[:start])
+		raw := rest[start : start+2+end+2]
+		inner := strings.TrimSpace(rest[start+2 : start+2+end])
+		rest = rest[start+2+end+2:]
+
+		switch {
+		case strings.HasPrefix(inner, "#"):
+			fields := splitArgs(inner[1:])
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("template: %s: expected one argument", raw)
+			}
+			node := templateNode{raw: raw, args: fields[1:]}
+			switch fields[0] {
+			case "if":
+				node.kind = nodeIf
+			case "unless":
+				node.kind, node.negate = nodeIf, true
+			case "each":
+				node.kind = nodeEach
+			default:
+				return nil, fmt.Errorf("template: unknown block %q", fields[0])
+			}
+			*cur = append(*cur, node)
+			blk := &templateBlock{node: &(*cur)[len(*cur)-1], name: fields[0], parent: cur}
+			stack = append(stack, blk)
+			cur = &blk.node.body
+		case inner == "else":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("template: {{else}} outside of a block")
+			}
+			blk := stack[len(stack)-1]
+			if blk.inElse {
+				return nil, fmt.Errorf("template: duplicate {{else}} in {{#%s}}", blk.name)
+			}
+			blk.inElse = true
+			cur = &blk.node.elseBody
+		case strings.HasPrefix(inner, "/"):
+			name := strings.TrimSpace(inner[1:])
+			if len(stack) == 0 || stack[len(stack)-1].name != name {
+				return nil, fmt.Errorf("template: unexpected {{/%s}}", name)
+			}
+			blk := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			cur = blk.parent
+		case strings.HasPrefix(inner, ">"):
+			args := splitArgs(inner[1:])
+			if len(args) != 1 {
+				return nil, fmt.Errorf("template: %s: expected a snippet name", raw)
+			}
+			*cur = append(*cur, templateNode{kind: nodeInclude, text: args[0], raw: raw})
+		default:
+			args := splitArgs(inner)
+			switch {
+			case len(args) > 0 && templateHelpers[args[0]]:
+				*cur = append(*cur, templateNode{kind: nodeHelper, text: args[0], args: args[1:], raw: raw})
+			case len(args) == 1 && isTemplatePath(args[0]):
+				*cur = append(*cur, templateNode{kind: nodeVar, text: args[0], raw: raw})
+			default:
+				appendText(raw)
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("template: unclosed {{#%s}}", stack[len(stack)-1].name)
+	}
+	return root, nil
+}
+
+// splitArgs splits a tag on whitespace, keeping double-quoted strings intact.
+// Quoted arguments keep their quotes so literals can be told apart from paths.
+func splitArgs(s string) []string {
+	var args []string
+	s = strings.TrimSpace(s)
+	for s != "" {
+		if s[0] == '"' {
+			end := strings.Index(s[1:], `"`)
+			if end < 0 {
+				args = append(args, s)
+				break
+			}
+			args = append(args, s[:end+2])
+			s = strings.TrimSpace(s[end+2:])
+			continue
+		}
+		i := strings.IndexAny(s, " \t\n")
+		if i < 0 {
+			args = append(args, s)
+			break
+		}
+		args = append(args, s[:i])
+		s = strings.TrimSpace(s[i:])
+	}
+	return args
+}
+
+// isTemplatePath reports whether s looks like a variable reference.
+func isTemplatePath(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r == '_' || r == '-' || r == '.' || r == '@':
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r > 127: // allow non-ASCII identifiers
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ──────────────────── execute ────────────────────
+
+type templateScope struct {
+	item  any
+	index int
+}
+
+type templateRun struct {
+	engine *TemplateEngine
+	sb     *strings.Builder
+	depth  int
+}
+
+func (r *templateRun) exec(nodes []templateNode, scopes []templateScope) error {
+	for i := range nodes {
+		n := &nodes[i]
+		switch n.kind {
+		case nodeText:
+			r.sb.WriteString(n.text)
+		case nodeVar:
+			v, ok := lookupTemplateValue(scopes, n.text)
+			if !ok {
+				if r.engine.strict {
+					return fmt.Errorf("template: undefined variable %q", n.text)
+				}
+				r.sb.WriteString(n.raw)
+				continue
+			}
+			r.sb.WriteString(templateString(v))
+		case nodeIf:
+			v, _ := lookupTemplateValue(scopes, n.args[0])
+			body := n.body
+			if templateTruthy(v) == n.negate {
+				body = n.elseBody
+			}
+			if err := r.exec(body, scopes); err != nil {
+				return err
+			}
+		case nodeEach:
+			if err := r.execEach(n, scopes); err != nil {
+				return err
+			}
+		case nodeInclude:
+			if err := r.execInclude(n, scopes); err != nil {
+				return err
+			}
+		case nodeHelper:
+			out, err := r.execHelper(n, scopes)
+			if err != nil {
+				return err
+			}
+			r.sb.WriteString(out)
+		}
+	}
+	return nil
+}
+
+func (r *templateRun) execEach(n *templateNode, scopes []templateScope) error {
+	v, ok := lookupTemplateValue(scopes, n.args[0])
+	if !ok && r.engine.strict {
+		return fmt.Errorf("template: undefined variable %q", n.args[0])
+	}
+	rv := reflect.ValueOf(v)
+	if !ok || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) || rv.Len() == 0 {
+		return r.exec(n.elseBody, scopes)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		inner := append(scopes[:len(scopes):len(scopes)], templateScope{item: rv.Index(i).Interface(), index: i})
+		if err := r.exec(n.body, inner); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *templateRun) execInclude(n *templateNode, scopes []templateScope) error {
+	fs := r.engine.includeFS
+	if fs == nil {
+		return fmt.Errorf("template: %s: no include filesystem configured", n.raw)
+	}
+	if r.depth >= maxIncludeDepth {
+		return fmt.Errorf("template: %s: include depth exceeds %d", n.raw, maxIncludeDepth)
+	}
+	name := r.argValue(n.text, scopes)
+	if path.Ext(name) == "" {
+		name += ".md"
+	}
+	content, err := fs.ReadFile(path.Join(r.engine.includeDir, name))
+	if err != nil {
+		return fmt.Errorf("template: include %s: %w", name, err)
+	}
+	nodes, err := parseTemplate(string(content))
+	if err != nil {
+		return fmt.Errorf("template: include %s: %w", name, err)
+	}
+	sub := &templateRun{engine: r.engine, sb: r.sb, depth: r.depth + 1}
+	return sub.exec(nodes, scopes)
+}
+
+func (r *templateRun) execHelper(n *templateNode, scopes []templateScope) (string, error) {
+	if len(n.args) == 0 {
+		return "", fmt.Errorf("template: %s: missing path argument", n.raw)
+	}
+	p := r.argValue(n.args[0], scopes)
+	content, err := r.readArtifact(p)
+	if err != nil {
+		if r.engine.strict {
+			return "", fmt.Errorf("template: %s: %w", n.raw, err)
+		}
+		return n.raw, nil
+	}
+
+	switch n.text {
+	case "artifact_head":
+		if len(n.args) != 2 {
+			return "", fmt.Errorf("template: %s: expected path and line count", n.raw)
+		}
+		count, err := strconv.Atoi(r.argValue(n.args[1], scopes))
+		if err != nil || count < 0 {
+			return "", fmt.Errorf("template: %s: invalid line count", n.raw)
+		}
+		lines := strings.SplitAfter(content, "\n")
+		if len(lines) > count {
+			lines = lines[:count]
+		}
+		return strings.TrimSuffix(strings.Join(lines, ""), "\n"), nil
+	case "artifact_lines":
+		return strconv.Itoa(countTemplateLines(content)), nil
+	default:
+		return content, nil
+	}
+}
+
+func (r *templateRun) readArtifact(p string) (string, error) {
+	if r.engine.artifactFS == nil {
+		return "", fmt.Errorf("no artifact filesystem configured")
+	}
+	data, err := r.engine.artifactFS.ReadFile(p)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// argValue resolves a helper argument: quoted literals are unquoted, known
+// variables are looked up, and anything else is used as a literal.
+func (r *templateRun) argValue(arg string, scopes []templateScope) string {
+	if strings.HasPrefix(arg, `"`) {
+		if s, err := strconv.Unquote(arg); err == nil {
+			return s
+		}
+		return strings.Trim(arg, `"`)
+	}
+	if v, ok := lookupTemplateValue(scopes, arg); ok {
+		return templateString(v)
+	}
+	return arg
+}
+
+// lookupTemplateValue resolves a path against the scope stack, innermost first.
+func lookupTemplateValue(scopes []templateScope, p string) (any, bool) {
+	top := scopes[len(scopes)-1]
+	switch p {
+	case "this", ".":
+		return top.item, true
+	case "@index":
+		return top.index, true
+	}
+	p = strings.TrimPrefix(p, "this.")
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if v, ok := walkTemplatePath(scopes[i].item, strings.Split(p, ".")); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func walkTemplatePath(v any, parts []string) (any, bool) {
+	for _, part := range parts {
+		switch m := v.(type) {
+		case map[string]any:
+			next, ok := m[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		case map[string]string:
+			next, ok := m[part]
+			if !ok {
+				return nil, false
+			}
+			v = next
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func templateTruthy(v any) bool {
+	if v == nil {
+		return false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+		return rv.Len() > 0
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() != 0
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() != 0
+	case reflect.Pointer, reflect.Interface:
+		return !rv.IsNil()
+	default:
+		return true
+	}
+}
+
+func templateString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []string:
+		return strings.Join(val, ", ")
+	default:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() == reflect.Slice {
+			parts := make([]string, rv.Len())
+			for i := range parts {
+				parts[i] = templateString(rv.Index(i).Interface())
+			}
+			return strings.Join(parts, ", ")
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+func countTemplateLines(content string) int {
+	if content == "" {
+		return 0
+	}
+	n := strings.Count(content, "\n")
+	if !strings.HasSuffix(content, "\n") {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// mapFS wraps fstest.MapFS to implement FileSystem.
+type mapFS struct {
+	fstest.MapFS
+}
+
+func (m mapFS) Stat(name string) (fs.FileInfo, error) { return fs.Stat(m.MapFS, name) }
+
+func (m mapFS) ReadDir(name string) ([]fs.DirEntry, error) { return fs.ReadDir(m.MapFS, name) }
+
+func TestTemplateEngine_Blocks(t *testing.T) {
+	e := NewTemplateEngine()
+	tpl := "{{#if rtl}}RTL: {{rtl}}{{else}}no rtl{{/if}}\n" +
+		"{{#each input}}- {{@index}} {{this}}\n{{else}}no inputs\n{{/each}}" +
+		"{{#unless done}}todo{{/unless}}"
+
+	got, err := e.Render(tpl, map[string]any{
+		"rtl":   "top.v",
+		"input": []string{"a.v", "b.v"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "RTL: top.v\n- 0 a.v\n- 1 b.v\ntodo"
+	if got != want {
+		t.Fatalf("got %q want %q", got, want)
+	}
+
+	got, err = e.Render(tpl, map[string]any{"done": true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "no rtl\nno inputs\n" {
+		t.Fatalf("unexpected else branches: %q", got)
+	}
+}
+
+func TestTemplateEngine_UndefinedVariable(t *testing.T) {
+	got, err := NewTemplateEngine().Render("Hello {{name}} {{ not a var }}", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Hello {{name}} {{ not a var }}" {
+		t.Fatalf("expected placeholders verbatim, got %q", got)
+	}
+
+	_, err = NewTemplateEngine(WithStrict(true)).Render("Hello {{name}}", nil)
+	if err == nil || !strings.Contains(err.Error(), `"name"`) {
+		t.Fatalf("expected undefined variable error, got %v", err)
+	}
+}
+
+func TestTemplateEngine_IncludeAndArtifacts(t *testing.T) {
+	files := mapFS{fstest.MapFS{
+		"system/rules.md": &fstest.MapFile{Data: []byte("Rules for {{stage}}.")},
+		"docs/spec.md":    &fstest.MapFile{Data: []byte("line1\nline2\nline3\n")},
+	}}
+	e := NewTemplateEngine(WithIncludeFS(files, ""), WithArtifactFS(files), WithStrict(true))
+
+	got, err := e.Render(`{{> rules}} {{artifact_lines "docs/spec.md"}} [{{artifact_head spec 2}}]`, map[string]any{
+		"stage": "3.1",
+		"spec":  "docs/spec.md",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "Rules for 3.1. 3 [line1\nline2]" {
+		t.Fatalf("unexpected render: %q", got)
+	}
+
+	if _, err := e.Render(`{{artifact "docs/missing.md"}}`, nil); err == nil {
+		t.Fatal("expected missing artifact error in strict mode")
+	}
+	got, err = e.With(WithStrict(false)).Render(`[{{artifact "docs/missing.md"}}]`, nil)
+	if err != nil || got != `[{{artifact "docs/missing.md"}}]` {
+		t.Fatalf("expected missing artifact left verbatim, got %q %v", got, err)
+	}
+}
+
+func TestTemplateEngine_ParseErrors(t *testing.T) {
+	for _, tpl := range []string{
+		"{{#if a}}open",
+		"{{/if}}",
+		"{{#each a}}{{/if}}",
+		"{{#with a}}{{/with}}",
+		"{{else}}",
+	} {
+		if _, err := NewTemplateEngine().Render(tpl, nil); err == nil {
+			t.Fatalf("expected parse error for %q", tpl)
+		}
+	}
+}
+
+func TestStepTemplateData(t *testing.T) {
+	step := &StepDefinition{Frontmatter: Frontmatter{
+		Step:   "3.1",
+		Input:  []string{"rtl/top.v"},
+		Output: OutputField{"docs/sim.md"},
+	}}
+	got, err := NewTemplateEngine().Render("{{#each input}}{{this}}{{/each}} → {{output}} ({{stage}})",
+		StepTemplateData(step, map[string]string{"stage": "sim"}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "rtl/top.v → docs/sim.md (sim)" {
+		t.Fatalf("unexpected render: %q", got)
+	}
+}
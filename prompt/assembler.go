@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/package-register/trpc-agent-go-extensions/pipeline"
@@ -16,7 +17,9 @@ import (
 type DefaultAssembler struct {
 	corePrompt     string
 	toolsReference string
-	snapshot       ContextSnapshot // nil = no dynamic content
+	snapshot       ContextSnapshot          // nil = no dynamic content
+	fs             pipeline.FileSystem      // used to read output templates
+	engine         *pipeline.TemplateEngine // nil = legacy RenderTemplate
 }
 
 // NewAssembler creates a builder with Layer 1 content loaded from the filesystem.
@@ -28,6 +31,7 @@ func NewAssembler(
 ) *DefaultAssembler {
 	a := &DefaultAssembler{
 		snapshot: snapshot,
+		fs:       fs,
 	}
 	if data, err := fs.ReadFile(corePromptPath); err == nil {
 		a.corePrompt = string(data)
@@ -38,11 +42,32 @@ func NewAssembler(
 	return a
 }
 
+// SetTemplateEngine switches body rendering to the given engine. With an engine
+// set, the step's output_template is rendered and exposed as {{output_template}},
+// and render errors (e.g. undefined variables in strict mode) fail the build.
+func (a *DefaultAssembler) SetTemplateEngine(engine *pipeline.TemplateEngine) {
+	a.engine = engine
+}
+
+// StrictTemplates implements pipeline.StrictAssembler. It returns a copy of the
+// assembler whose template engine (a default one if none is set) is strict.
+func (a *DefaultAssembler) StrictTemplates() pipeline.PromptAssembler {
+	c := *a
+	if c.engine == nil {
+		c.engine = pipeline.NewTemplateEngine(pipeline.WithStrict(true))
+	} else {
+		c.engine = c.engine.With(pipeline.WithStrict(true))
+	}
+	return &c
+}
+
 // BuildStatic constructs the initial system instruction (Layer 1 + static Layer 2 body).
 // Used at graph build time as the LLM node's instruction.
 func (a *DefaultAssembler) BuildStatic(step *pipeline.StepDefinition, vars map[string]string) (string, error) {
-	mergedVars := a.mergeVars(step, vars)
-	body := pipeline.RenderTemplate(step.Body, mergedVars)
+	body, err := a.renderBody(step, vars)
+	if err != nil {
+		return "", err
+	}
 
 	var sb strings.Builder
 	a.writeLayer1(&sb)
@@ -53,8 +78,10 @@ func (a *DefaultAssembler) BuildStatic(step *pipeline.StepDefinition, vars map[s
 // BuildDynamic constructs the complete system message with both static and dynamic content.
 // Used at runtime via PreNodeCallback to inject progress, input summaries, etc.
 func (a *DefaultAssembler) BuildDynamic(ctx context.Context, step *pipeline.StepDefinition, vars map[string]string) (string, error) {
-	mergedVars := a.mergeVars(step, vars)
-	body := pipeline.RenderTemplate(step.Body, mergedVars)
+	body, err := a.renderBody(step, vars)
+	if err != nil {
+		return "", err
+	}
 
 	var sb strings.Builder
 	a.writeLayer1(&sb)
@@ -90,6 +117,33 @@ func (a *DefaultAssembler) mergeVars(step *pipeline.StepDefinition, vars map[str
 	return merged
 }
 
+// renderBody renders the step body with the configured template engine.
+func (a *DefaultAssembler) renderBody(step *pipeline.StepDefinition, vars map[string]string) (string, error) {
+	mergedVars := a.mergeVars(step, vars)
+	if a.engine == nil {
+		return pipeline.RenderTemplate(step.Body, mergedVars), nil
+	}
+
+	data := pipeline.StepTemplateData(step, mergedVars)
+	if tpl := step.Frontmatter.OutputTemplate; tpl != "" {
+		content, err := a.fs.ReadFile(tpl)
+		if err != nil {
+			return "", fmt.Errorf("read template %s: %w", tpl, err)
+		}
+		rendered, err := a.engine.Render(string(content), data)
+		if err != nil {
+			return "", fmt.Errorf("render template %s: %w", tpl, err)
+		}
+		data["output_template"] = rendered
+	}
+
+	body, err := a.engine.Render(step.Body, data)
+	if err != nil {
+		return "", fmt.Errorf("render step %s: %w", step.Frontmatter.Step, err)
+	}
+	return body, nil
+}
+
 // writeLayer1 writes the <system_core_prompt> section.
 func (a *DefaultAssembler) writeLayer1(sb *strings.Builder) {
 	sb.WriteString("<system_core_prompt>\n")
@@ -143,3 +143,30 @@ func TestAssembler_ImplementsInterface(t *testing.T) {
 	fs := newTestFS(nil)
 	var _ Assembler = NewAssembler("", "", fs, nil)
 }
+
+func TestAssembler_TemplateEngineStrict(t *testing.T) {
+	fs := newTestFS(map[string]string{
+		"core.md":          "",
+		"templates/sim.md": "## Report for {{stage}}",
+		"system/shared.md": "Shared rules.",
+	})
+	a := NewAssembler("core.md", "", fs, nil)
+	a.SetTemplateEngine(pipeline.NewTemplateEngine(pipeline.WithIncludeFS(fs, "system"), pipeline.WithStrict(true)))
+
+	step := &pipeline.StepDefinition{
+		Frontmatter: pipeline.Frontmatter{Step: "3.1", OutputTemplate: "templates/sim.md"},
+		Body:        "{{> shared}}\n{{output_template}}",
+	}
+	result, err := a.BuildStatic(step, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(result, "Shared rules.\n## Report for 3.1") {
+		t.Fatalf("expected include and output template rendered: %s", result)
+	}
+
+	step.Body = "Uses {{undefined_var}}"
+	if _, err := a.BuildStatic(step, nil); err == nil {
+		t.Fatal("expected strict mode to fail on undefined variable")
+	}
+}
@@ -0,0 +1,178 @@
+package step
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BundleManifestFile is the manifest file name expected at the bundle root.
+const BundleManifestFile = "manifest.yaml"
+
+// BundleManifest describes a versioned step bundle.
+type BundleManifest struct {
+	Name        string   `yaml:"name"`
+	Version     string   `yaml:"version"`
+	Description string   `yaml:"description"`
+	Prompts     string   `yaml:"prompts"` // step directory inside the bundle (default ".")
+	Steps       []string `yaml:"steps"`   // optional: expected step IDs, checked on load
+}
+
+// BundleStepLoader implements Loader.
+// It loads step definitions from a .zip, .tar.gz or .tar bundle containing a
+// manifest.yaml, either at the archive root or inside a single top-level
+// directory. The archive itself is read through a FileSystem, so bundles can
+// live on disk (pipeline.OSFS) or be embedded in the binary (pipeline.IOFS over
+// embed.FS). Steps inside the bundle are loaded with FileStepLoader, so
+// _defaults files and extends work as usual.
+type BundleStepLoader struct {
+	fs   pipeline.FileSystem
+	path string
+
+	mu       sync.RWMutex
+	manifest *BundleManifest
+}
+
+// NewBundleStepLoader creates a loader for the archive at archivePath.
+func NewBundleStepLoader(fs pipeline.FileSystem, archivePath string) *BundleStepLoader {
+	return &BundleStepLoader{fs: fs, path: archivePath}
+}
+
+// Load opens the archive, validates its manifest and returns its steps sorted by step ID.
+func (l *BundleStepLoader) Load() ([]*pipeline.StepDefinition, error) {
+	data, err := l.fs.ReadFile(l.path)
+	if err != nil {
+		return nil, fmt.Errorf("read bundle: %w", err)
+	}
+	archive, err := pipeline.OpenArchive(l.path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := findBundleRoot(archive)
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", l.path, err)
+	}
+	manifest, err := readBundleManifest(archive, root)
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", l.path, err)
+	}
+
+	steps, err := NewFileStepLoader(archive, path.Join(root, manifest.Prompts)).Load()
+	if err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", l.path, err)
+	}
+	if err := checkBundleSteps(manifest, steps); err != nil {
+		return nil, fmt.Errorf("bundle %s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.manifest = manifest
+	l.mu.Unlock()
+	return steps, nil
+}
+
+// Manifest returns the manifest read by the last successful Load, or nil.
+func (l *BundleStepLoader) Manifest() *BundleManifest {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.manifest == nil {
+		return nil
+	}
+	cp := *l.manifest
+	return &cp
+}
+
+// Fingerprint implements Fingerprinter from the archive's size and modification time.
+func (l *BundleStepLoader) Fingerprint() (string, error) {
+	info, err := l.fs.Stat(l.path)
+	if err != nil {
+		return "", fmt.Errorf("stat bundle: %w", err)
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().UnixNano()), nil
+}
+
+// findBundleRoot returns the directory holding manifest.yaml: the archive root
+// or its single top-level directory.
+func findBundleRoot(archive pipeline.FileSystem) (string, error) {
+	if _, err := archive.Stat(BundleManifestFile); err == nil {
+		return ".", nil
+	}
+	entries, err := archive.ReadDir(".")
+	if err != nil {
+		return "", fmt.Errorf("read archive root: %w", err)
+	}
+	var dirs []fs.DirEntry
+	for _, e := range entries {
+		if e.IsDir() {
+			dirs = append(dirs, e)
+		}
+	}
+	if len(dirs) == 1 {
+		if _, err := archive.Stat(path.Join(dirs[0].Name(), BundleManifestFile)); err == nil {
+			return dirs[0].Name(), nil
+		}
+	}
+	return "", fmt.Errorf("%s not found", BundleManifestFile)
+}
+
+func readBundleManifest(archive pipeline.FileSystem, root string) (*BundleManifest, error) {
+	data, err := archive.ReadFile(path.Join(root, BundleManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var manifest BundleManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	if manifest.Name == "" || manifest.Version == "" {
+		return nil, fmt.Errorf("manifest requires name and version")
+	}
+	if manifest.Prompts == "" {
+		manifest.Prompts = "."
+	}
+	return &manifest, nil
+}
+
+// checkBundleSteps verifies the loaded step IDs against manifest.steps, if declared.
+func checkBundleSteps(manifest *BundleManifest, steps []*pipeline.StepDefinition) error {
+	if len(manifest.Steps) == 0 {
+		return nil
+	}
+	loaded := make(map[string]bool, len(steps))
+	for _, s := range steps {
+		loaded[s.Frontmatter.Step] = true
+	}
+	declared := make(map[string]bool, len(manifest.Steps))
+	var missing, extra []string
+	for _, id := range manifest.Steps {
+		declared[id] = true
+		if !loaded[id] {
+			missing = append(missing, id)
+		}
+	}
+	for id := range loaded {
+		if !declared[id] {
+			extra = append(extra, id)
+		}
+	}
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+	sort.Strings(extra)
+	return fmt.Errorf("steps do not match manifest (missing: [%s], undeclared: [%s])",
+		strings.Join(missing, ", "), strings.Join(extra, ", "))
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ Loader        = (*BundleStepLoader)(nil)
+	_ Fingerprinter = (*BundleStepLoader)(nil)
+)
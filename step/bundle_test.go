@@ -0,0 +1,134 @@
+package step
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+var bundleFiles = map[string]string{
+	"ic-flow/manifest.yaml":          "name: ic-flow\nversion: 1.2.0\nprompts: prompts\nsteps: [\"1.1\", \"2.1\"]\n",
+	"ic-flow/prompts/1.1_design.md":  step11,
+	"ic-flow/prompts/sub/2.1_rtl.md": step21,
+	"ic-flow/prompts/system/core.md": "system file",
+}
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func buildTarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		hdr := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestBundleStepLoader_Formats(t *testing.T) {
+	tfs := testFS{fstest.MapFS{
+		"bundles/ic-flow.zip":    &fstest.MapFile{Data: buildZip(t, bundleFiles)},
+		"bundles/ic-flow.tar.gz": &fstest.MapFile{Data: buildTarGz(t, bundleFiles)},
+	}}
+
+	for _, name := range []string{"bundles/ic-flow.zip", "bundles/ic-flow.tar.gz"} {
+		t.Run(name, func(t *testing.T) {
+			loader := NewBundleStepLoader(tfs, name)
+			steps, err := loader.Load()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(steps) != 2 || steps[0].Frontmatter.Step != "1.1" || steps[1].Frontmatter.Step != "2.1" {
+				t.Fatalf("expected steps 1.1 and 2.1, got %d", len(steps))
+			}
+			m := loader.Manifest()
+			if m == nil || m.Name != "ic-flow" || m.Version != "1.2.0" {
+				t.Fatalf("unexpected manifest: %+v", m)
+			}
+		})
+	}
+}
+
+func TestBundleStepLoader_ManifestErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"no manifest": {
+			"prompts/1.1.md": step11,
+		},
+		"no version": {
+			"manifest.yaml":  "name: x\n",
+			"prompts/1.1.md": step11,
+		},
+		"step mismatch": {
+			"manifest.yaml": "name: x\nversion: \"1\"\nsteps: [\"1.1\", \"9.9\"]\n",
+			"1.1.md":        step11,
+		},
+	}
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			tfs := testFS{fstest.MapFS{"b.zip": &fstest.MapFile{Data: buildZip(t, files)}}}
+			if _, err := NewBundleStepLoader(tfs, "b.zip").Load(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestBundleStepLoader_UnsupportedFormat(t *testing.T) {
+	tfs := testFS{fstest.MapFS{"b.rar": &fstest.MapFile{Data: []byte("x")}}}
+	_, err := NewBundleStepLoader(tfs, "b.rar").Load()
+	if err == nil || !strings.Contains(err.Error(), "unsupported archive format") {
+		t.Fatalf("expected unsupported format error, got %v", err)
+	}
+}
+
+func TestFileStepLoader_IOFS(t *testing.T) {
+	// fstest.MapFS stands in for an embed.FS here: both are plain fs.FS.
+	embedded := pipeline.NewIOFS(fstest.MapFS{
+		"prompts/1.1_design.md": &fstest.MapFile{Data: []byte(step11)},
+		"prompts/2.1_rtl.md":    &fstest.MapFile{Data: []byte(step21)},
+	})
+
+	steps, err := NewFileStepLoader(embedded, "./prompts/").Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(steps))
+	}
+}
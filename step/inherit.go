@@ -0,0 +1,444 @@
+package step
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"gopkg.in/yaml.v3"
+)
+
+// appendSuffix marks a frontmatter list key whose value is appended to the
+// inherited list instead of replacing it, e.g. "tools+: [file]".
+const appendSuffix = "+"
+
+// rawStep is a prompt file whose frontmatter has not been decoded yet, so that
+// inherited keys can be merged before the result is typed.
+type rawStep struct {
+	path     string
+	dir      string
+	abstract bool  // "_" prefixed files are only usable as an extends base
+	err      error // parse error of an abstract file, reported only if extended
+	fields   map[string]any
+	body     string
+}
+
+// stem returns the file name without extension and leading "_".
+func (r *rawStep) stem() string {
+	name := strings.TrimSuffix(path.Base(r.path), path.Ext(r.path))
+	return strings.TrimPrefix(name, "_")
+}
+
+// parseRawStep splits a prompt file into untyped frontmatter fields and body.
+func parseRawStep(content, filePath string) (*rawStep, error) {
+	raw, body, err := pipeline.SplitPrompt(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	fields, err := parseFields([]byte(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return &rawStep{
+		path:   filePath,
+		dir:    path.Dir(filePath),
+		fields: fields,
+		body:   body,
+	}, nil
+}
+
+// parseFields decodes YAML frontmatter into a generic map. Scalars are kept as
+// *yaml.Node so that values such as step "3.10" survive re-encoding verbatim.
+func parseFields(data []byte) (map[string]any, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse frontmatter: %w", err)
+	}
+	switch v := nodeValue(&doc).(type) {
+	case nil:
+		return make(map[string]any), nil
+	case map[string]any:
+		normalizeToolsAlias(v)
+		return v, nil
+	default:
+		return nil, fmt.Errorf("parse frontmatter: expected a mapping")
+	}
+}
+
+// normalizeToolsAlias copies the legacy "mcp" key (and "mcp+") to "tools" when
+// a layer does not declare tools itself, so that the alias is merged against
+// inherited tools instead of being shadowed by them.
+func normalizeToolsAlias(fields map[string]any) {
+	_, hasTools := fields["tools"]
+	_, hasAppend := fields["tools"+appendSuffix]
+	if hasTools || hasAppend {
+		return
+	}
+	for _, suffix := range []string{"", appendSuffix} {
+		if v, ok := fields["mcp"+suffix]; ok {
+			fields["tools"+suffix] = v
+		}
+	}
+}
+
+// nodeValue converts a YAML node into maps, lists and scalar nodes.
+func nodeValue(n *yaml.Node) any {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil
+		}
+		return nodeValue(n.Content[0])
+	case yaml.MappingNode:
+		m := make(map[string]any, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			m[n.Content[i].Value] = nodeValue(n.Content[i+1])
+		}
+		return m
+	case yaml.SequenceNode:
+		list := make([]any, 0, len(n.Content))
+		for _, c := range n.Content {
+			list = append(list, nodeValue(c))
+		}
+		return list
+	case yaml.AliasNode:
+		return nodeValue(n.Alias)
+	case yaml.ScalarNode:
+		if n.Tag == "!!null" {
+			return nil
+		}
+		return n
+	default:
+		return nil
+	}
+}
+
+// inheritResolver applies directory defaults and extends chains to raw steps.
+//
+// Layers are applied lowest to highest precedence:
+//
+//  1. _defaults files from the loader root down to the step's own directory
+//  2. the extends base: its own frontmatter over that of its bases (excluding
+//     step, name and extends); the base's directory defaults are not
+//     inherited, so they cannot override those of the step's directory
+//  3. the step's own frontmatter
+type inheritResolver struct {
+	root     string
+	defaults map[string]map[string]any // dir → fields from its _defaults file
+	index    map[string]*rawStep       // name / step ID / file stem → raw step
+	resolved map[*rawStep]*pipeline.StepDefinition
+	own      map[*rawStep]map[string]any // extends chain and own fields, without defaults
+	visiting map[*rawStep]bool
+}
+
+func newInheritResolver(root string, raws []*rawStep, defaults map[string]map[string]any) *inheritResolver {
+	r := &inheritResolver{
+		root:     path.Clean(root),
+		defaults: defaults,
+		index:    make(map[string]*rawStep),
+		resolved: make(map[*rawStep]*pipeline.StepDefinition),
+		own:      make(map[*rawStep]map[string]any),
+		visiting: make(map[*rawStep]bool),
+	}
+	// Lookup priority: explicit name, then step ID, then file stem.
+	for _, key := range []func(*rawStep) string{
+		func(s *rawStep) string { return stringField(s.fields, "name") },
+		func(s *rawStep) string { return stringField(s.fields, "step") },
+		(*rawStep).stem,
+	} {
+		// Concrete steps take precedence over "_" prefixed files.
+		for _, abstract := range []bool{false, true} {
+			for _, s := range raws {
+				if s.abstract != abstract {
+					continue
+				}
+				if k := key(s); k != "" {
+					if _, exists := r.index[k]; !exists {
+						r.index[k] = s
+					}
+				}
+			}
+		}
+	}
+	return r
+}
+
+// resolve returns the step definition with all inherited values applied.
+func (r *inheritResolver) resolve(s *rawStep) (*pipeline.StepDefinition, error) {
+	if def, ok := r.resolved[s]; ok {
+		return def, nil
+	}
+	fields, body, err := r.mergeStep(s)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := yaml.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("%s: encode frontmatter: %w", s.path, err)
+	}
+	frontmatter, err := pipeline.DecodeFrontmatter(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", s.path, err)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	def := &pipeline.StepDefinition{
+		Path:        s.path,
+		Frontmatter: frontmatter,
+		Body:        body,
+		Keys:        keys,
+		Unset:       nullPaths(s.fields, ""),
+	}
+	r.resolved[s] = def
+	return def, nil
+}
+
+// mergeStep computes the merged frontmatter fields and body for a raw step.
+func (r *inheritResolver) mergeStep(s *rawStep) (map[string]any, string, error) {
+	if r.visiting[s] {
+		return nil, "", fmt.Errorf("%s: extends cycle detected", s.path)
+	}
+	r.visiting[s] = true
+	defer delete(r.visiting, s)
+
+	defaults := make(map[string]any)
+	for _, dir := range r.dirChain(s.dir) {
+		defaults = MergeFields(defaults, r.defaults[dir])
+	}
+
+	inherited := make(map[string]any)
+	var body string
+	if ext := stringField(s.fields, "extends"); ext != "" {
+		base, ok := r.index[ext]
+		if !ok {
+			return nil, "", fmt.Errorf("%s: extends %q: definition not found", s.path, ext)
+		}
+		if base.err != nil {
+			return nil, "", fmt.Errorf("%s: extends %q: %w", s.path, ext, base.err)
+		}
+		baseDef, err := r.resolve(base)
+		if err != nil {
+			return nil, "", err
+		}
+		for k, v := range r.own[base] {
+			switch k {
+			case "step", "name", "extends":
+				continue
+			}
+			inherited[k] = v
+		}
+		body = baseDef.Body
+	}
+
+	// The step's fields are merged last and unresolved, so that its "+" and
+	// null keys also apply to the directory defaults.
+	r.own[s] = MergeFields(inherited, s.fields)
+	body = MergeBody(body, s.body)
+	return MergeFields(MergeFields(defaults, inherited), s.fields), body, nil
+}
+
+// dirChain returns the directories from the loader root down to dir, inclusive.
+func (r *inheritResolver) dirChain(dir string) []string {
+	chain := []string{r.root}
+	if dir == r.root {
+		return chain
+	}
+	rel := dir
+	if r.root != "." {
+		rel = strings.TrimPrefix(dir, r.root+"/")
+	}
+	cur := r.root
+	for _, part := range strings.Split(rel, "/") {
+		cur = path.Join(cur, part)
+		chain = append(chain, cur)
+	}
+	return chain
+}
+
+// MergeFields layers overlay frontmatter onto base and returns a new map.
+// Neither input is modified.
+//
+//   - scalars: overlay wins
+//   - maps: merged recursively with the same rules
+//   - lists: overlay replaces; a key suffixed with "+" (e.g. "tools+") appends
+//     to the inherited list instead
+//   - null: overlay removes the inherited key (e.g. "fallback: null")
+func MergeFields(base, overlay map[string]any) map[string]any {
+	out := make(map[string]any, len(base)+len(overlay))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range overlay {
+		if key, ok := strings.CutSuffix(k, appendSuffix); ok {
+			out[key] = append(toList(out[key]), toList(v)...)
+			continue
+		}
+		if v == nil {
+			delete(out, k)
+			continue
+		}
+		baseMap, baseIsMap := out[k].(map[string]any)
+		overMap, overIsMap := v.(map[string]any)
+		if baseIsMap && overIsMap {
+			out[k] = MergeFields(baseMap, overMap)
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// nullPaths returns the dotted paths of the null values in fields, sorted.
+func nullPaths(fields map[string]any, prefix string) []string {
+	var out []string
+	for k, v := range fields {
+		if strings.HasSuffix(k, appendSuffix) {
+			continue
+		}
+		switch val := v.(type) {
+		case nil:
+			out = append(out, prefix+k)
+		case map[string]any:
+			out = append(out, nullPaths(val, prefix+k+".")...)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// toList normalizes a frontmatter value to a list; scalars become one element.
+func toList(v any) []any {
+	switch val := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		out := make([]any, len(val))
+		copy(out, val)
+		return out
+	default:
+		return []any{val}
+	}
+}
+
+// bodySection is a markdown heading and the content up to the next heading.
+type bodySection struct {
+	heading string // empty for the preamble before the first heading
+	content string
+}
+
+// MergeBody overlays the child body's markdown sections onto the base body.
+// Sections are keyed by their heading line: a child section replaces the base
+// section with the same heading in place, new child sections are appended in
+// order, and a non-empty child preamble replaces the base preamble. An empty
+// child body inherits the base body unchanged.
+func MergeBody(base, child string) string {
+	if strings.TrimSpace(base) == "" {
+		return child
+	}
+	if strings.TrimSpace(child) == "" {
+		return base
+	}
+
+	sections := splitSections(base)
+	pos := make(map[string]int, len(sections))
+	for i, sec := range sections {
+		pos[sec.heading] = i
+	}
+
+	for _, sec := range splitSections(child) {
+		if sec.heading == "" && strings.TrimSpace(sec.content) == "" {
+			continue
+		}
+		if i, ok := pos[sec.heading]; ok {
+			sections[i] = sec
+			continue
+		}
+		pos[sec.heading] = len(sections)
+		sections = append(sections, sec)
+	}
+
+	var sb strings.Builder
+	for _, sec := range sections {
+		if sec.heading != "" {
+			if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+				sb.WriteString("\n")
+			}
+			sb.WriteString(sec.heading)
+			sb.WriteString("\n")
+		}
+		sb.WriteString(sec.content)
+	}
+	return sb.String()
+}
+
+// splitSections splits markdown into sections at ATX heading lines. Lines
+// inside fenced code blocks are never headings.
+func splitSections(body string) []bodySection {
+	sections := []bodySection{{}}
+	var content strings.Builder
+	var fence string
+	for _, line := range strings.SplitAfter(body, "\n") {
+		trimmed := strings.TrimRight(line, "\r\n")
+		if fence != "" {
+			if closesFence(trimmed, fence) {
+				fence = ""
+			}
+		} else if f := openingFence(trimmed); f != "" {
+			fence = f
+		} else if isHeading(trimmed) {
+			sections[len(sections)-1].content = content.String()
+			content.Reset()
+			sections = append(sections, bodySection{heading: trimmed})
+			continue
+		}
+		content.WriteString(line)
+	}
+	sections[len(sections)-1].content = content.String()
+	return sections
+}
+
+// openingFence returns the ``` or ~~~ run that opens a fenced code block on
+// line, or "" if line does not open one.
+func openingFence(line string) string {
+	line = strings.TrimLeft(line, " ")
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 {
+			return line[:n]
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line closes the code block opened by fence: a
+// run of the same character at least as long, with nothing after it.
+func closesFence(line, fence string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) >= len(fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+// isHeading reports whether a line is a markdown ATX heading ("# ..." to "###### ...").
+func isHeading(line string) bool {
+	level := len(line) - len(strings.TrimLeft(line, "#"))
+	if level == 0 || level > 6 {
+		return false
+	}
+	return len(line) == level || line[level] == ' '
+}
+
+// stringField returns the scalar fields[key] as a trimmed string, or "".
+func stringField(fields map[string]any, key string) string {
+	if n, ok := fields[key].(*yaml.Node); ok {
+		return strings.TrimSpace(n.Value)
+	}
+	return ""
+}
@@ -0,0 +1,214 @@
+package step
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+func loadMap(t *testing.T, files map[string]string) []*pipeline.StepDefinition {
+	t.Helper()
+	m := make(fstest.MapFS)
+	for p, c := range files {
+		m[p] = &fstest.MapFile{Data: []byte(c)}
+	}
+	steps, err := NewFileStepLoader(testFS{m}, "prompts").Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return steps
+}
+
+func TestFileStepLoader_DirectoryDefaults(t *testing.T) {
+	steps := loadMap(t, map[string]string{
+		"prompts/_defaults.md": `---
+tools: [file]
+advance: confirm
+max_output_tokens: 4096
+fallback:
+  default: "1.1"
+---
+`,
+		"prompts/sim/_defaults.yaml": `
+tools+: [eda]
+fallback:
+  timeout: "3.1"
+`,
+		"prompts/1.1_design.md": step11,
+		"prompts/sim/3.1_sim.md": `---
+step: "3.1"
+advance: auto
+---
+Sim body.
+`,
+	})
+
+	if len(steps) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(steps))
+	}
+	design, sim := steps[0].Frontmatter, steps[1].Frontmatter
+
+	if design.Advance != pipeline.AdvanceConfirm || design.MaxOutputTokens != 4096 {
+		t.Fatalf("expected root defaults on 1.1, got advance=%s max=%d", design.Advance, design.MaxOutputTokens)
+	}
+	if strings.Join(design.Tools, ",") != "file" {
+		t.Fatalf("expected tools [file] on 1.1, got %v", design.Tools)
+	}
+
+	if sim.Advance != pipeline.AdvanceAuto {
+		t.Fatalf("expected own advance to win, got %s", sim.Advance)
+	}
+	if strings.Join(sim.Tools, ",") != "file,eda" {
+		t.Fatalf("expected appended tools [file eda], got %v", sim.Tools)
+	}
+	if sim.Fallback["default"] != "1.1" || sim.Fallback["timeout"] != "3.1" {
+		t.Fatalf("expected merged fallback map, got %v", sim.Fallback)
+	}
+}
+
+func TestFileStepLoader_Extends(t *testing.T) {
+	steps := loadMap(t, map[string]string{
+		"prompts/_base-sim.md": `---
+name: base-sim
+tools: [eda]
+output: docs/sim.md
+fallback:
+  default: "2.1"
+  compile_error: "2.1"
+---
+# Simulation
+
+## Setup
+Base setup.
+
+## Checks
+Base checks.
+`,
+		"prompts/2.1_rtl.md": step21,
+		"prompts/3.10_sim.md": `---
+step: 3.10
+extends: base-sim
+fallback:
+  compile_error: null
+---
+## Checks
+Custom checks.
+
+## Extra
+Extra section.
+`,
+	})
+
+	if len(steps) != 2 {
+		t.Fatalf("expected abstract base to be skipped, got %d steps", len(steps))
+	}
+	sim := steps[1]
+	if sim.Frontmatter.Step != "3.10" {
+		t.Fatalf("expected step ID preserved verbatim, got %q", sim.Frontmatter.Step)
+	}
+	if sim.Frontmatter.Name != "" {
+		t.Fatalf("expected name not to be inherited, got %q", sim.Frontmatter.Name)
+	}
+	if sim.Frontmatter.PrimaryOutput() != "docs/sim.md" || strings.Join(sim.Frontmatter.Tools, ",") != "eda" {
+		t.Fatalf("expected inherited output/tools, got %v %v", sim.Frontmatter.Output, sim.Frontmatter.Tools)
+	}
+	if _, ok := sim.Frontmatter.Fallback["compile_error"]; ok {
+		t.Fatalf("expected null to remove inherited key, got %v", sim.Frontmatter.Fallback)
+	}
+	if sim.Frontmatter.Fallback["default"] != "2.1" {
+		t.Fatalf("expected inherited fallback.default, got %v", sim.Frontmatter.Fallback)
+	}
+
+	want := "# Simulation\n\n## Setup\nBase setup.\n\n## Checks\nCustom checks.\n\n## Extra\nExtra section.\n"
+	if sim.Body != want {
+		t.Fatalf("unexpected merged body:\n%q\nwant:\n%q", sim.Body, want)
+	}
+}
+
+func TestFileStepLoader_ExtendsKeepsOwnDirDefaults(t *testing.T) {
+	steps := loadMap(t, map[string]string{
+		"prompts/_defaults.md":       "---\nadvance: confirm\nmax_output_tokens: 4096\n---\n",
+		"prompts/sim/_defaults.yaml": "advance: auto\ntools+: [eda]\n",
+		"prompts/_base.md":           "---\nname: base\noutput: docs/out.md\n---\nBase body.\n",
+		"prompts/sim/3.1_sim.md":     "---\nstep: \"3.1\"\nextends: base\n---\n",
+	})
+
+	if len(steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(steps))
+	}
+	sim := steps[0].Frontmatter
+	if sim.Advance != pipeline.AdvanceAuto {
+		t.Fatalf("expected sim/_defaults to win over the base's root defaults, got %s", sim.Advance)
+	}
+	if sim.MaxOutputTokens != 4096 || strings.Join(sim.Tools, ",") != "eda" {
+		t.Fatalf("expected root and sim defaults, got max=%d tools=%v", sim.MaxOutputTokens, sim.Tools)
+	}
+	if sim.PrimaryOutput() != "docs/out.md" || steps[0].Body != "Base body.\n" {
+		t.Fatalf("expected inherited output and body, got %v %q", sim.Output, steps[0].Body)
+	}
+}
+
+func TestFileStepLoader_ExtendsErrors(t *testing.T) {
+	cases := map[string]map[string]string{
+		"missing": {
+			"prompts/1.1.md": "---\nstep: \"1.1\"\nextends: nope\n---\n",
+		},
+		"cycle": {
+			"prompts/1.1.md": "---\nstep: \"1.1\"\nextends: \"1.2\"\n---\n",
+			"prompts/1.2.md": "---\nstep: \"1.2\"\nextends: \"1.1\"\n---\n",
+		},
+		"broken base": {
+			"prompts/_base.md": "no frontmatter",
+			"prompts/1.1.md":   "---\nstep: \"1.1\"\nextends: base\n---\n",
+		},
+	}
+	for name, files := range cases {
+		t.Run(name, func(t *testing.T) {
+			m := make(fstest.MapFS)
+			for p, c := range files {
+				m[p] = &fstest.MapFile{Data: []byte(c)}
+			}
+			if _, err := NewFileStepLoader(testFS{m}, "prompts").Load(); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestMergeBody_EmptyChildInherits(t *testing.T) {
+	base := "# Title\nBody.\n"
+	if got := MergeBody(base, ""); got != base {
+		t.Fatalf("expected base body, got %q", got)
+	}
+	if got := MergeBody("", "child"); got != "child" {
+		t.Fatalf("expected child body, got %q", got)
+	}
+}
+
+func TestFileStepLoader_MCPAliasOverridesInheritedTools(t *testing.T) {
+	steps := loadMap(t, map[string]string{
+		"prompts/_defaults.yaml": "tools: [file]\n",
+		"prompts/_base.md":       "---\nname: base\ntools: [shell]\n---\n",
+		"prompts/1.1.md":         "---\nstep: \"1.1\"\nmcp: [eda]\n---\n",
+		"prompts/1.2.md":         "---\nstep: \"1.2\"\nextends: base\nmcp: [eda]\n---\n",
+		"prompts/1.3.md":         "---\nstep: \"1.3\"\nmcp+: [eda]\n---\n",
+	})
+
+	for i, want := range []string{"eda", "eda", "file,eda"} {
+		if got := strings.Join(steps[i].Frontmatter.EffectiveTools(), ","); got != want {
+			t.Errorf("step %s: expected tools %s, got %s", steps[i].Frontmatter.Step, want, got)
+		}
+	}
+}
+
+func TestMergeBody_IgnoresHeadingsInCodeFences(t *testing.T) {
+	base := "## Setup\n```bash\n# install deps\nmake deps\n```\n## Run\nBase run.\n"
+	child := "## Run\nChild run.\n~~~\n# not a heading\n~~~\n"
+
+	want := "## Setup\n```bash\n# install deps\nmake deps\n```\n## Run\nChild run.\n~~~\n# not a heading\n~~~\n"
+	if got := MergeBody(base, child); got != want {
+		t.Fatalf("unexpected merged body:\n%q\nwant:\n%q", got, want)
+	}
+}
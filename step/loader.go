@@ -1,10 +1,13 @@
 package step
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"path"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/package-register/trpc-agent-go-extensions/pipeline"
 )
@@ -12,6 +15,16 @@ import (
 // FileStepLoader implements Loader.
 // It loads step definitions from a filesystem directory, skipping
 // "templates/" and "system/" subdirectories and "_" prefixed files.
+//
+// Shared values can be declared once instead of repeated in every step:
+//
+//   - _defaults.md / _defaults.yaml: frontmatter merged into every step in
+//     that directory and below (inner directories override outer ones)
+//   - extends: <ref>: inherits the frontmatter and body sections of another
+//     definition, looked up by name, step ID or file stem. "_" prefixed files
+//     (e.g. _base-sim.md) are never loaded as steps but can be extended.
+//
+// See MergeFields and MergeBody for the merge semantics.
 type FileStepLoader struct {
 	fs  pipeline.FileSystem
 	dir string
@@ -22,23 +35,59 @@ func NewFileStepLoader(fs pipeline.FileSystem, dir string) *FileStepLoader {
 	return &FileStepLoader{fs: fs, dir: dir}
 }
 
-// Load reads all prompt files from the directory, parses them, and returns
-// them sorted by step ID.
+// Load reads all prompt files from the directory, resolves defaults and
+// extends chains, and returns them sorted by step ID.
 func (l *FileStepLoader) Load() ([]*pipeline.StepDefinition, error) {
-	var steps []*pipeline.StepDefinition
+	var raws []*rawStep
+	defaults := make(map[string]map[string]any)
 
 	err := l.walkDir(l.dir, func(filePath string) error {
-		step, err := LoadStep(l.fs, filePath)
+		name := path.Base(filePath)
+		if isDefaultsFile(name) {
+			fields, err := l.loadDefaults(filePath)
+			if err != nil {
+				return err
+			}
+			defaults[path.Dir(filePath)] = fields
+			return nil
+		}
+		if !strings.HasSuffix(name, ".md") {
+			return nil
+		}
+
+		content, err := l.fs.ReadFile(filePath)
 		if err != nil {
-			return err
+			return fmt.Errorf("read step: %w", err)
 		}
-		steps = append(steps, step)
+		abstract := strings.HasPrefix(name, "_")
+		raw, err := parseRawStep(string(content), filePath)
+		if err != nil {
+			if !abstract {
+				return err
+			}
+			raw = &rawStep{path: filePath, dir: path.Dir(filePath), err: err}
+		}
+		raw.abstract = abstract
+		raws = append(raws, raw)
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	resolver := newInheritResolver(l.dir, raws, defaults)
+	var steps []*pipeline.StepDefinition
+	for _, raw := range raws {
+		if raw.abstract {
+			continue
+		}
+		step, err := resolver.resolve(raw)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, step)
+	}
+
 	if len(steps) == 0 {
 		return nil, fmt.Errorf("no steps found in %s", l.dir)
 	}
@@ -50,7 +99,55 @@ func (l *FileStepLoader) Load() ([]*pipeline.StepDefinition, error) {
 	return steps, nil
 }
 
-// walkDir recursively walks the directory, calling fn for each .md file.
+// loadDefaults reads the frontmatter of a _defaults.md or the body of a _defaults.yaml file.
+func (l *FileStepLoader) loadDefaults(filePath string) (map[string]any, error) {
+	content, err := l.fs.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("read defaults: %w", err)
+	}
+	data := string(content)
+	if strings.HasSuffix(filePath, ".md") {
+		data, _, err = pipeline.SplitPrompt(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+	}
+	fields, err := parseFields([]byte(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return fields, nil
+}
+
+// Fingerprint implements Fingerprinter from the path, size and modification
+// time of every file under the directory, without reading file contents.
+func (l *FileStepLoader) Fingerprint() (string, error) {
+	h := sha256.New()
+	err := l.walkDir(l.dir, func(filePath string) error {
+		info, err := l.fs.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("stat %s: %w", filePath, err)
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00%d\n", filePath, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// isDefaultsFile reports whether name is a directory defaults file.
+func isDefaultsFile(name string) bool {
+	switch name {
+	case "_defaults.md", "_defaults.yaml", "_defaults.yml":
+		return true
+	}
+	return false
+}
+
+// walkDir recursively walks the directory, calling fn for each file outside
+// the "templates/" and "system/" subdirectories.
 func (l *FileStepLoader) walkDir(dir string, fn func(string) error) error {
 	entries, err := l.fs.ReadDir(dir)
 	if err != nil {
@@ -71,13 +168,6 @@ func (l *FileStepLoader) walkDir(dir string, fn func(string) error) error {
 			continue
 		}
 
-		if !strings.HasSuffix(name, ".md") {
-			continue
-		}
-		if strings.HasPrefix(name, "_") {
-			continue
-		}
-
 		if err := fn(fullPath); err != nil {
 			return err
 		}
@@ -117,8 +207,15 @@ func (l *FilteredStepLoader) Load() ([]*pipeline.StepDefinition, error) {
 }
 
 // CompositeStepLoader merges results from multiple StepLoaders.
+// By default a step ID supplied by two loaders is an error; SetOverrideMode
+// lets later loaders replace or patch steps from earlier ones instead, e.g. a
+// base pipeline plus a project directory whose 3.1.md only changes fallback.
 type CompositeStepLoader struct {
 	loaders []Loader
+	mode    OverrideMode
+
+	mu         sync.RWMutex
+	provenance Provenance
 }
 
 // NewCompositeStepLoader creates a loader that merges multiple sources.
@@ -126,33 +223,80 @@ func NewCompositeStepLoader(loaders ...Loader) *CompositeStepLoader {
 	return &CompositeStepLoader{loaders: loaders}
 }
 
-// Load calls each inner loader, merges results, checks for duplicate step IDs,
-// and returns them sorted by step ID.
+// SetOverrideMode sets how duplicate step IDs are handled and returns the loader.
+func (l *CompositeStepLoader) SetOverrideMode(mode OverrideMode) *CompositeStepLoader {
+	l.mode = mode
+	return l
+}
+
+// Load calls each inner loader, merges results, resolves duplicate step IDs
+// according to the override mode, and returns them sorted by step ID.
 func (l *CompositeStepLoader) Load() ([]*pipeline.StepDefinition, error) {
-	seen := make(map[string]bool)
-	var all []*pipeline.StepDefinition
+	byID := make(map[string]*pipeline.StepDefinition)
+	provenance := make(Provenance)
 
-	for _, loader := range l.loaders {
+	for i, loader := range l.loaders {
 		steps, err := loader.Load()
 		if err != nil {
 			return nil, err
 		}
 		for _, s := range steps {
-			if seen[s.Frontmatter.Step] {
-				return nil, fmt.Errorf("duplicate step ID %q", s.Frontmatter.Step)
+			id := s.Frontmatter.Step
+			prev, exists := byID[id]
+			switch {
+			case !exists || l.mode == OverrideReplace:
+				fields, err := sourceFields(s)
+				if err != nil {
+					return nil, fmt.Errorf("step %s: %w", id, err)
+				}
+				delete(provenance, id)
+				provenance.record(i, s, fields)
+				byID[id] = s
+			case l.mode == OverridePatch:
+				patched, touched, err := patchStep(prev, s)
+				if err != nil {
+					return nil, fmt.Errorf("patch step %s: %w", id, err)
+				}
+				provenance.record(i, s, touched)
+				byID[id] = patched
+			default:
+				return nil, fmt.Errorf("duplicate step ID %q", id)
 			}
-			seen[s.Frontmatter.Step] = true
-			all = append(all, s)
 		}
 	}
 
+	all := make([]*pipeline.StepDefinition, 0, len(byID))
+	for _, s := range byID {
+		all = append(all, s)
+	}
 	sort.Slice(all, func(i, j int) bool {
 		return all[i].Frontmatter.Step < all[j].Frontmatter.Step
 	})
 
+	l.mu.Lock()
+	l.provenance = provenance
+	l.mu.Unlock()
 	return all, nil
 }
 
+// Provenance returns a copy of which loader supplied each field of each step
+// in the last successful Load, or nil before the first one.
+func (l *CompositeStepLoader) Provenance() Provenance {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.provenance == nil {
+		return nil
+	}
+	out := make(Provenance, len(l.provenance))
+	for id, fields := range l.provenance {
+		out[id] = make(map[string]FieldSource, len(fields))
+		for f, src := range fields {
+			out[id][f] = src
+		}
+	}
+	return out
+}
+
 // InMemoryStepLoader provides step definitions from memory, useful for testing.
 type InMemoryStepLoader struct {
 	steps []*pipeline.StepDefinition
@@ -179,4 +323,6 @@ var (
 	_ Loader = (*FilteredStepLoader)(nil)
 	_ Loader = (*CompositeStepLoader)(nil)
 	_ Loader = (*InMemoryStepLoader)(nil)
+
+	_ Fingerprinter = (*FileStepLoader)(nil)
 )
@@ -0,0 +1,219 @@
+package step
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OverrideMode controls how CompositeStepLoader handles a step ID supplied by
+// more than one loader.
+type OverrideMode int
+
+const (
+	// OverrideNone rejects duplicate step IDs (the default).
+	OverrideNone OverrideMode = iota
+	// OverrideReplace lets a later loader replace the whole step.
+	OverrideReplace
+	// OverridePatch lets a later loader patch the step: only the frontmatter
+	// keys it declares are applied (with MergeFields semantics) and its body
+	// is merged section by section with MergeBody.
+	OverridePatch
+)
+
+// BodyField is the provenance key used for a step's body.
+const BodyField = "body"
+
+// FieldSource identifies where the final value of a step field came from.
+type FieldSource struct {
+	Loader int    // index of the loader in the composite
+	Path   string // path of the step definition that supplied the value
+}
+
+// Provenance maps step ID → field (frontmatter key or BodyField) → source.
+type Provenance map[string]map[string]FieldSource
+
+// Report renders the provenance as one "step field ← source" line per field,
+// sorted by step ID and field.
+func (p Provenance) Report() string {
+	ids := make([]string, 0, len(p))
+	for id := range p {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var sb strings.Builder
+	for _, id := range ids {
+		fields := make([]string, 0, len(p[id]))
+		for f := range p[id] {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			src := p[id][f]
+			fmt.Fprintf(&sb, "%s %s ← [%d] %s\n", id, f, src.Loader, src.Path)
+		}
+	}
+	return sb.String()
+}
+
+// record attributes every declared field of def to the given loader.
+func (p Provenance) record(loader int, def *pipeline.StepDefinition, fields []string) {
+	id := def.Frontmatter.Step
+	if p[id] == nil {
+		p[id] = make(map[string]FieldSource)
+	}
+	for _, f := range fields {
+		p[id][f] = FieldSource{Loader: loader, Path: def.Path}
+	}
+}
+
+// patchStep applies the declared fields, null deletions and body of overlay
+// onto base. The legacy "mcp" key also patches "tools", which takes
+// precedence over it, unless the overlay declares "tools" too.
+func patchStep(base, overlay *pipeline.StepDefinition) (*pipeline.StepDefinition, []string, error) {
+	baseFields, err := frontmatterFields(base.Frontmatter)
+	if err != nil {
+		return nil, nil, err
+	}
+	overFields, err := frontmatterFields(overlay.Frontmatter)
+	if err != nil {
+		return nil, nil, err
+	}
+	keys := declaredKeys(overlay, overFields)
+	unset := append([]string(nil), overlay.Unset...)
+	if !slices.Contains(keys, "tools") && !slices.Contains(unset, "tools") {
+		if slices.Contains(keys, "mcp") {
+			keys = mergeKeys(keys, []string{"tools"})
+		}
+		if slices.Contains(unset, "mcp") {
+			unset = append(unset, "tools")
+		}
+	}
+
+	patch := make(map[string]any, len(keys)+len(unset))
+	for _, k := range keys {
+		patch[k] = overFields[k]
+	}
+	var removed []string
+	for _, p := range unset {
+		setNull(patch, strings.Split(p, "."))
+		if !strings.Contains(p, ".") {
+			removed = append(removed, p)
+		}
+	}
+
+	data, err := yaml.Marshal(MergeFields(baseFields, patch))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: encode frontmatter: %w", overlay.Path, err)
+	}
+	fm, err := pipeline.DecodeFrontmatter(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", overlay.Path, err)
+	}
+
+	touched := mergeKeys(keys, removed)
+	if strings.TrimSpace(overlay.Body) != "" {
+		touched = append(touched, BodyField)
+	}
+	var patchedKeys []string
+	for _, k := range mergeKeys(base.Keys, keys) {
+		if !slices.Contains(removed, k) {
+			patchedKeys = append(patchedKeys, k)
+		}
+	}
+	return &pipeline.StepDefinition{
+		Path:        overlay.Path,
+		Frontmatter: fm,
+		Body:        MergeBody(base.Body, overlay.Body),
+		Keys:        patchedKeys,
+	}, touched, nil
+}
+
+// setNull sets the value at path in fields to null, creating intermediate
+// maps, so that MergeFields removes it.
+func setNull(fields map[string]any, path []string) {
+	for _, part := range path[:len(path)-1] {
+		next, ok := fields[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			fields[part] = next
+		}
+		fields = next
+	}
+	fields[path[len(path)-1]] = nil
+}
+
+// frontmatterFields converts a typed Frontmatter back into a field map.
+func frontmatterFields(fm pipeline.Frontmatter) (map[string]any, error) {
+	data, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, fmt.Errorf("encode frontmatter: %w", err)
+	}
+	var fields map[string]any
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("decode frontmatter: %w", err)
+	}
+	return fields, nil
+}
+
+// declaredKeys returns the frontmatter keys def declares. Without Keys (steps
+// not read from files) it falls back to the non-empty fields, treating the
+// default advance mode as undeclared.
+func declaredKeys(def *pipeline.StepDefinition, fields map[string]any) []string {
+	if def.Keys != nil {
+		return append([]string(nil), def.Keys...)
+	}
+	var keys []string
+	for k, v := range fields {
+		if isEmptyField(v) || (k == "advance" && v == string(pipeline.AdvanceAuto)) {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sourceFields returns the fields attributed to def when it first provides a step.
+func sourceFields(def *pipeline.StepDefinition) ([]string, error) {
+	fields, err := frontmatterFields(def.Frontmatter)
+	if err != nil {
+		return nil, err
+	}
+	return append(declaredKeys(def, fields), BodyField), nil
+}
+
+func isEmptyField(v any) bool {
+	switch val := v.(type) {
+	case nil:
+		return true
+	case string:
+		return val == ""
+	case int:
+		return val == 0
+	case []any:
+		return len(val) == 0
+	case map[string]any:
+		return len(val) == 0
+	}
+	return false
+}
+
+func mergeKeys(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var out []string
+	for _, k := range append(append([]string(nil), a...), b...) {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
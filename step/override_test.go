@@ -0,0 +1,144 @@
+package step
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+func TestCompositeStepLoader_Patch(t *testing.T) {
+	tfs := testFS{fstest.MapFS{
+		"base/3.1_sim.md": &fstest.MapFile{Data: []byte(`---
+step: "3.1"
+title: "仿真"
+output: "docs/sim.md"
+advance: confirm
+fallback:
+  default: "2.1"
+---
+# Goal
+Run simulation.
+
+# Rules
+Base rules.
+`)},
+		"project/3.1.md": &fstest.MapFile{Data: []byte(`---
+step: "3.1"
+fallback:
+  timeout: "3.0"
+---
+# Rules
+Project rules.
+`)},
+	}}
+
+	loader := NewCompositeStepLoader(
+		NewFileStepLoader(tfs, "base"),
+		NewFileStepLoader(tfs, "project"),
+	).SetOverrideMode(OverridePatch)
+
+	steps, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(steps) != 1 {
+		t.Fatalf("expected 1 step, got %d", len(steps))
+	}
+	fm := steps[0].Frontmatter
+	if fm.Title != "仿真" || fm.Advance != pipeline.AdvanceConfirm || fm.PrimaryOutput() != "docs/sim.md" {
+		t.Fatalf("base fields lost: %+v", fm)
+	}
+	if fm.Fallback["default"] != "2.1" || fm.Fallback["timeout"] != "3.0" {
+		t.Fatalf("expected merged fallback, got %v", fm.Fallback)
+	}
+	if !strings.Contains(steps[0].Body, "Run simulation.") || !strings.Contains(steps[0].Body, "Project rules.") ||
+		strings.Contains(steps[0].Body, "Base rules.") {
+		t.Fatalf("unexpected body: %q", steps[0].Body)
+	}
+
+	prov := loader.Provenance()["3.1"]
+	if prov["title"].Path != "base/3.1_sim.md" || prov["fallback"].Loader != 1 || prov[BodyField].Loader != 1 {
+		t.Fatalf("unexpected provenance: %+v", prov)
+	}
+	if report := loader.Provenance().Report(); !strings.Contains(report, "3.1 fallback ← [1] project/3.1.md") {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+}
+
+func TestCompositeStepLoader_Replace(t *testing.T) {
+	l1 := NewInMemoryStepLoader(&pipeline.StepDefinition{
+		Path:        "base.md",
+		Frontmatter: pipeline.Frontmatter{Step: "1.1", Title: "base", Next: "1.2"},
+	})
+	l2 := NewInMemoryStepLoader(&pipeline.StepDefinition{
+		Path:        "override.md",
+		Frontmatter: pipeline.Frontmatter{Step: "1.1", Title: "override"},
+	})
+
+	loader := NewCompositeStepLoader(l1, l2).SetOverrideMode(OverrideReplace)
+	steps, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if steps[0].Frontmatter.Title != "override" || steps[0].Frontmatter.Next != "" {
+		t.Fatalf("expected full replacement, got %+v", steps[0].Frontmatter)
+	}
+	if _, ok := loader.Provenance()["1.1"]["next"]; ok {
+		t.Fatal("replaced fields should not keep provenance")
+	}
+}
+
+func TestCompositeStepLoader_PatchAliasAndNulls(t *testing.T) {
+	tfs := testFS{fstest.MapFS{
+		"base/3.1_sim.md": &fstest.MapFile{Data: []byte(`---
+step: "3.1"
+tools: [file]
+next: "3.2"
+fallback:
+  default: "2.1"
+  compile_error: "2.1"
+---
+Base.
+`)},
+		"project/3.1.md": &fstest.MapFile{Data: []byte(`---
+step: "3.1"
+mcp: [eda]
+next: null
+fallback:
+  compile_error: null
+---
+`)},
+	}}
+
+	loader := NewCompositeStepLoader(
+		NewFileStepLoader(tfs, "base"),
+		NewFileStepLoader(tfs, "project"),
+	).SetOverrideMode(OverridePatch)
+
+	steps, err := loader.Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	fm := steps[0].Frontmatter
+	if strings.Join(fm.EffectiveTools(), ",") != "eda" {
+		t.Fatalf("expected mcp alias to patch tools, got %v", fm.EffectiveTools())
+	}
+	if fm.Next != "" || slices.Contains(steps[0].Keys, "next") {
+		t.Fatalf("expected next removed, got %q (keys %v)", fm.Next, steps[0].Keys)
+	}
+	if _, ok := fm.Fallback["compile_error"]; ok || fm.Fallback["default"] != "2.1" {
+		t.Fatalf("expected fallback.compile_error removed, got %v", fm.Fallback)
+	}
+
+	prov := loader.Provenance()
+	if prov["3.1"]["next"].Loader != 1 || prov["3.1"]["tools"].Loader != 1 {
+		t.Fatalf("unexpected provenance: %+v", prov["3.1"])
+	}
+	delete(prov["3.1"], "next")
+	if _, ok := loader.Provenance()["3.1"]["next"]; !ok {
+		t.Fatal("Provenance must return a copy")
+	}
+}
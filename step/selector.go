@@ -0,0 +1,238 @@
+package step
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+// Selector picks a subset of steps. It is a list of clauses that must all
+// match, separated by ";":
+//
+//   - tags=sim,!slow   step has at least one of the positive tags (if any are
+//     given) and none of the negated ones
+//   - range=2.1..5.3   step ID within the inclusive range; either end may be
+//     omitted ("3.1.." = from 3.1 onward)
+//   - prefix=1.        step ID starts with the prefix
+//
+// Step IDs are compared numerically per dotted component, so 2.10 > 2.9.
+type Selector struct {
+	clauses []func(*pipeline.StepDefinition) bool
+}
+
+// ParseSelector parses a selector expression such as "tags=sim,!slow;range=2.1..5.3".
+// An empty expression selects every step.
+func ParseSelector(expr string) (*Selector, error) {
+	sel := &Selector{}
+	for _, clause := range strings.Split(expr, ";") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(clause, "=")
+		if !ok {
+			return nil, fmt.Errorf("selector clause %q: expected key=value", clause)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+
+		var match func(*pipeline.StepDefinition) bool
+		var err error
+		switch key {
+		case "tags":
+			match, err = parseTagsClause(value)
+		case "range":
+			match, err = parseRangeClause(value)
+		case "prefix":
+			match = func(s *pipeline.StepDefinition) bool {
+				return strings.HasPrefix(s.Frontmatter.Step, value)
+			}
+		default:
+			err = fmt.Errorf("unknown key %q (supported: tags, range, prefix)", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("selector clause %q: %w", clause, err)
+		}
+		sel.clauses = append(sel.clauses, match)
+	}
+	return sel, nil
+}
+
+// Match reports whether the step satisfies every clause.
+func (s *Selector) Match(step *pipeline.StepDefinition) bool {
+	for _, match := range s.clauses {
+		if !match(step) {
+			return false
+		}
+	}
+	return true
+}
+
+func parseTagsClause(value string) (func(*pipeline.StepDefinition) bool, error) {
+	var include, exclude []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if neg, ok := strings.CutPrefix(tag, "!"); ok {
+			if neg == "" {
+				return nil, fmt.Errorf("empty negated tag")
+			}
+			exclude = append(exclude, neg)
+		} else if tag != "" {
+			include = append(include, tag)
+		}
+	}
+	if len(include) == 0 && len(exclude) == 0 {
+		return nil, fmt.Errorf("no tags given")
+	}
+	return func(s *pipeline.StepDefinition) bool {
+		has := make(map[string]bool, len(s.Frontmatter.Tags))
+		for _, t := range s.Frontmatter.Tags {
+			has[t] = true
+		}
+		for _, t := range exclude {
+			if has[t] {
+				return false
+			}
+		}
+		if len(include) == 0 {
+			return true
+		}
+		for _, t := range include {
+			if has[t] {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func parseRangeClause(value string) (func(*pipeline.StepDefinition) bool, error) {
+	from, to, ok := strings.Cut(value, "..")
+	if !ok {
+		return nil, fmt.Errorf("expected from..to")
+	}
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if from == "" && to == "" {
+		return nil, fmt.Errorf("range needs at least one bound")
+	}
+	return func(s *pipeline.StepDefinition) bool {
+		id := s.Frontmatter.Step
+		if from != "" && CompareStepIDs(id, from) < 0 {
+			return false
+		}
+		if to != "" && CompareStepIDs(id, to) > 0 {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// CompareStepIDs compares dotted step IDs component by component, numerically
+// where both components are numbers. It returns -1, 0 or 1.
+func CompareStepIDs(a, b string) int {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, errA := strconv.Atoi(pa[i])
+		nb, errB := strconv.Atoi(pb[i])
+		switch {
+		case errA == nil && errB == nil:
+			if na != nb {
+				if na < nb {
+					return -1
+				}
+				return 1
+			}
+		case pa[i] != pb[i]:
+			if pa[i] < pb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+// SelectorStepLoader wraps another Loader and keeps only the steps matched by
+// a Selector. References to excluded steps are rewired: next and fallback
+// targets follow the excluded step's own next chain to the first included
+// step; a next chain that leaves the selection ends the flow, and such
+// fallback entries are dropped. The inner loader's definitions are not modified.
+type SelectorStepLoader struct {
+	inner    Loader
+	selector *Selector
+}
+
+// NewSelectorStepLoader creates a loader that returns the steps matched by selector.
+func NewSelectorStepLoader(inner Loader, selector *Selector) *SelectorStepLoader {
+	return &SelectorStepLoader{inner: inner, selector: selector}
+}
+
+// Load returns the selected steps with next/fallback references rewired.
+func (l *SelectorStepLoader) Load() ([]*pipeline.StepDefinition, error) {
+	all, err := l.inner.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*pipeline.StepDefinition, len(all))
+	included := make(map[string]bool)
+	for _, s := range all {
+		byID[s.Frontmatter.Step] = s
+		if l.selector.Match(s) {
+			included[s.Frontmatter.Step] = true
+		}
+	}
+	if len(included) == 0 {
+		return nil, fmt.Errorf("no steps match selector")
+	}
+
+	// rewire follows the next chain from target to the first included step.
+	rewire := func(target string) string {
+		seen := make(map[string]bool)
+		for target != "" && !included[target] {
+			s, ok := byID[target]
+			if !ok {
+				return target // dangling: left for ValidateReferences to report
+			}
+			if seen[target] {
+				return ""
+			}
+			seen[target] = true
+			target = s.Frontmatter.Next
+		}
+		return target
+	}
+
+	var selected []*pipeline.StepDefinition
+	for _, s := range all {
+		if !included[s.Frontmatter.Step] {
+			continue
+		}
+		cp := *s
+		if next := rewire(s.Frontmatter.Next); next != s.Frontmatter.Step {
+			cp.Frontmatter.Next = next
+		} else {
+			cp.Frontmatter.Next = ""
+		}
+		if len(s.Frontmatter.Fallback) > 0 {
+			cp.Frontmatter.Fallback = make(map[string]string, len(s.Frontmatter.Fallback))
+			for code, target := range s.Frontmatter.Fallback {
+				if t := rewire(target); t != "" {
+					cp.Frontmatter.Fallback[code] = t
+				}
+			}
+		}
+		selected = append(selected, &cp)
+	}
+	return selected, nil
+}
+
+// Verify interface compliance at compile time.
+var _ Loader = (*SelectorStepLoader)(nil)
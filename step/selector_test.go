@@ -0,0 +1,94 @@
+package step
+
+import (
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+func selectorSteps() []*pipeline.StepDefinition {
+	mk := func(id, next string, tags ...string) *pipeline.StepDefinition {
+		return &pipeline.StepDefinition{Frontmatter: pipeline.Frontmatter{Step: id, Next: next, Tags: tags}}
+	}
+	return []*pipeline.StepDefinition{
+		mk("1.1", "2.1", "design"),
+		mk("2.1", "2.9", "rtl"),
+		mk("2.9", "2.10", "sim", "slow"),
+		mk("2.10", "3.1", "sim"),
+		mk("3.1", "", "synth"),
+	}
+}
+
+func selectIDs(t *testing.T, expr string) []*pipeline.StepDefinition {
+	t.Helper()
+	sel, err := ParseSelector(expr)
+	if err != nil {
+		t.Fatalf("parse %q: %v", expr, err)
+	}
+	steps, err := NewSelectorStepLoader(NewInMemoryStepLoader(selectorSteps()...), sel).Load()
+	if err != nil {
+		t.Fatalf("load %q: %v", expr, err)
+	}
+	return steps
+}
+
+func TestSelectorStepLoader_Tags(t *testing.T) {
+	steps := selectIDs(t, "tags=sim,!slow")
+	if len(steps) != 1 || steps[0].Frontmatter.Step != "2.10" {
+		t.Fatalf("expected only 2.10, got %d steps", len(steps))
+	}
+	if steps[0].Frontmatter.Next != "" {
+		t.Fatalf("next to excluded 3.1 should end the flow, got %q", steps[0].Frontmatter.Next)
+	}
+}
+
+func TestSelectorStepLoader_RangeRewire(t *testing.T) {
+	steps := selectIDs(t, "range=1.1..2.10; tags=!slow")
+	var ids []string
+	for _, s := range steps {
+		ids = append(ids, s.Frontmatter.Step)
+	}
+	if len(ids) != 3 || ids[0] != "1.1" || ids[1] != "2.1" || ids[2] != "2.10" {
+		t.Fatalf("unexpected selection %v", ids)
+	}
+	if steps[1].Frontmatter.Next != "2.10" {
+		t.Fatalf("expected 2.1 rewired past 2.9 to 2.10, got %q", steps[1].Frontmatter.Next)
+	}
+
+	// The inner definitions must be left untouched.
+	if all := selectorSteps(); all[1].Frontmatter.Next != "2.9" {
+		t.Fatal("inner step modified")
+	}
+}
+
+func TestSelectorStepLoader_OpenRange(t *testing.T) {
+	steps := selectIDs(t, "range=2.10..")
+	if len(steps) != 2 || steps[0].Frontmatter.Step != "2.10" {
+		t.Fatalf("expected 2.10 onward, got %d steps", len(steps))
+	}
+}
+
+func TestParseSelector_Errors(t *testing.T) {
+	for _, expr := range []string{"tags", "colour=red", "range=2.1", "range=..", "tags=!"} {
+		if _, err := ParseSelector(expr); err == nil {
+			t.Fatalf("expected error for %q", expr)
+		}
+	}
+}
+
+func TestCompareStepIDs(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"2.9", "2.10", -1},
+		{"3.1", "3.1", 0},
+		{"3", "3.1", -1},
+		{"1.b", "1.a", 1},
+	}
+	for _, c := range cases {
+		if got := CompareStepIDs(c.a, c.b); got != c.want {
+			t.Errorf("CompareStepIDs(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
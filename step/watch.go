@@ -0,0 +1,237 @@
+package step
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/logger"
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+// Fingerprinter is implemented by loaders that can cheaply detect changes
+// (e.g. from file sizes and modification times) without re-parsing.
+type Fingerprinter interface {
+	Fingerprint() (string, error)
+}
+
+// StepSet is a validated set of step definitions published by WatchingLoader.
+type StepSet struct {
+	Steps    []*pipeline.StepDefinition
+	Version  int // increments on every published change, starting at 1
+	LoadedAt time.Time
+}
+
+// WatchingLoader implements Loader.
+// It wraps another Loader and polls it for changes. When the inner loader
+// implements Fingerprinter, unchanged fingerprints skip the reload entirely;
+// otherwise the steps are reloaded and compared by content. Changed step sets
+// are validated with ValidateReferences and published to subscribers; invalid
+// sets are reported to the error handler and the previous set stays current;
+// with a Fingerprinter, a failing set is reported once until it changes again.
+type WatchingLoader struct {
+	inner    Loader
+	interval time.Duration
+	onError  func(error)
+
+	mu          sync.RWMutex
+	current     StepSet
+	fingerprint string
+	contentHash string
+	failed      string // fingerprint of the last set that failed to load
+	failedErr   error
+	subs        map[int]func(StepSet)
+	nextSubID   int
+}
+
+// NewWatchingLoader creates a loader that polls inner every interval
+// (default 2s) once Start is called.
+func NewWatchingLoader(inner Loader, interval time.Duration) *WatchingLoader {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &WatchingLoader{
+		inner:    inner,
+		interval: interval,
+		subs:     make(map[int]func(StepSet)),
+	}
+}
+
+// SetErrorHandler registers a callback for reload failures (parse or validation
+// errors). Without a handler, failures are logged as warnings.
+func (w *WatchingLoader) SetErrorHandler(fn func(error)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.onError = fn
+}
+
+// Load returns the current step set, loading it on first use.
+func (w *WatchingLoader) Load() ([]*pipeline.StepDefinition, error) {
+	w.mu.RLock()
+	steps := w.current.Steps
+	w.mu.RUnlock()
+	if steps == nil {
+		if _, err := w.Poll(); err != nil {
+			return nil, err
+		}
+		w.mu.RLock()
+		steps = w.current.Steps
+		w.mu.RUnlock()
+	}
+	out := make([]*pipeline.StepDefinition, len(steps))
+	copy(out, steps)
+	return out, nil
+}
+
+// Current returns the current step set (zero value before the first load).
+func (w *WatchingLoader) Current() StepSet {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// Subscribe registers fn to receive every newly published step set.
+// It returns a function that removes the subscription.
+func (w *WatchingLoader) Subscribe(fn func(StepSet)) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	id := w.nextSubID
+	w.nextSubID++
+	w.subs[id] = fn
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subs, id)
+	}
+}
+
+// Start performs the initial load and then polls in a background goroutine
+// until ctx is cancelled. The initial load error, if any, is returned.
+func (w *WatchingLoader) Start(ctx context.Context) error {
+	if _, err := w.Poll(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := w.Poll(); err != nil {
+					w.reportError(err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// Poll checks the inner loader once and publishes the step set if it changed.
+// It reports whether a new set was published.
+func (w *WatchingLoader) Poll() (bool, error) {
+	var fingerprint string
+	if fp, ok := w.inner.(Fingerprinter); ok {
+		f, err := fp.Fingerprint()
+		if err != nil {
+			return false, fmt.Errorf("fingerprint steps: %w", err)
+		}
+		w.mu.RLock()
+		loaded := w.current.Steps != nil
+		unchanged := f == w.fingerprint && loaded
+		failed, failedErr := f != "" && f == w.failed, w.failedErr
+		w.mu.RUnlock()
+		if unchanged {
+			return false, nil
+		}
+		if failed {
+			// Already reported: wait for the files to change again.
+			if loaded {
+				return false, nil
+			}
+			return false, failedErr
+		}
+		fingerprint = f
+	}
+
+	steps, err := w.inner.Load()
+	if err != nil {
+		return false, w.fail(fingerprint, fmt.Errorf("reload steps: %w", err))
+	}
+	if errs := ValidateReferences(steps); len(errs) > 0 {
+		joined := make([]error, len(errs))
+		for i, e := range errs {
+			joined[i] = e
+		}
+		return false, w.fail(fingerprint, fmt.Errorf("validate steps: %w", errors.Join(joined...)))
+	}
+	hash, err := hashSteps(steps)
+	if err != nil {
+		return false, err
+	}
+
+	w.mu.Lock()
+	w.fingerprint = fingerprint
+	w.failed, w.failedErr = "", nil
+	if hash == w.contentHash {
+		w.mu.Unlock()
+		return false, nil
+	}
+	w.contentHash = hash
+	w.current = StepSet{
+		Steps:    steps,
+		Version:  w.current.Version + 1,
+		LoadedAt: time.Now(),
+	}
+	set := w.current
+	subs := make([]func(StepSet), 0, len(w.subs))
+	for _, fn := range w.subs {
+		subs = append(subs, fn)
+	}
+	w.mu.Unlock()
+
+	logger.L().Info("Step definitions reloaded", "version", set.Version, "steps", len(steps))
+	for _, fn := range subs {
+		fn(set)
+	}
+	return true, nil
+}
+
+// fail records the fingerprint of a step set that failed to load and returns
+// err.
+func (w *WatchingLoader) fail(fingerprint string, err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.failed, w.failedErr = fingerprint, err
+	return err
+}
+
+func (w *WatchingLoader) reportError(err error) {
+	w.mu.RLock()
+	fn := w.onError
+	w.mu.RUnlock()
+	if fn != nil {
+		fn(err)
+		return
+	}
+	logger.L().Warn("Step reload failed, keeping previous definitions", "error", err)
+}
+
+// hashSteps returns a content hash of the step definitions.
+func hashSteps(steps []*pipeline.StepDefinition) (string, error) {
+	data, err := json.Marshal(steps)
+	if err != nil {
+		return "", fmt.Errorf("hash steps: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify interface compliance at compile time.
+var _ Loader = (*WatchingLoader)(nil)
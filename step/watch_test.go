@@ -0,0 +1,88 @@
+package step
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/package-register/trpc-agent-go-extensions/pipeline"
+)
+
+func TestWatchingLoader_Poll(t *testing.T) {
+	files := fstest.MapFS{
+		"prompts/2.1_rtl.md": &fstest.MapFile{Data: []byte(step21)},
+	}
+	w := NewWatchingLoader(NewFileStepLoader(testFS{files}, "prompts"), 0)
+
+	var published []StepSet
+	unsubscribe := w.Subscribe(func(set StepSet) { published = append(published, set) })
+
+	if changed, err := w.Poll(); err != nil || !changed {
+		t.Fatalf("initial poll: changed=%v err=%v", changed, err)
+	}
+	if changed, err := w.Poll(); err != nil || changed {
+		t.Fatalf("unchanged poll: changed=%v err=%v", changed, err)
+	}
+
+	files["prompts/2.1_rtl.md"] = &fstest.MapFile{Data: []byte(strings.Replace(step21, "Step 2.1 body.", "Edited body.", 1))}
+	if changed, err := w.Poll(); err != nil || !changed {
+		t.Fatalf("edited poll: changed=%v err=%v", changed, err)
+	}
+	if len(published) != 2 || published[1].Version != 2 || !strings.Contains(published[1].Steps[0].Body, "Edited body.") {
+		t.Fatalf("unexpected published sets: %+v", published)
+	}
+
+	// step11 references the missing step 1.2: the reload is rejected.
+	files["prompts/1.1_design.md"] = &fstest.MapFile{Data: []byte(step11)}
+	if _, err := w.Poll(); err == nil || !strings.Contains(err.Error(), "validate steps") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	if cur := w.Current(); cur.Version != 2 || len(cur.Steps) != 1 {
+		t.Fatalf("expected previous set to stay current, got version %d", cur.Version)
+	}
+	// The failure is reported once until the files change again.
+	if changed, err := w.Poll(); err != nil || changed {
+		t.Fatalf("repeated poll of a failed set: changed=%v err=%v", changed, err)
+	}
+
+	unsubscribe()
+	files["prompts/1.2_confirm.md"] = &fstest.MapFile{Data: []byte(step12)}
+	if changed, err := w.Poll(); err != nil || !changed {
+		t.Fatalf("fixed poll: changed=%v err=%v", changed, err)
+	}
+	if len(published) != 2 {
+		t.Fatalf("unsubscribed callback should not be called, got %d sets", len(published))
+	}
+	steps, err := w.Load()
+	if err != nil || len(steps) != 3 {
+		t.Fatalf("expected 3 steps from Load, got %d (%v)", len(steps), err)
+	}
+}
+
+func TestWatchingLoader_ContentHash(t *testing.T) {
+	fm, body, err := pipeline.ParsePrompt(step21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inner := NewInMemoryStepLoader(&pipeline.StepDefinition{Frontmatter: fm, Body: body})
+	w := NewWatchingLoader(inner, 0)
+
+	// Without a Fingerprinter every poll reloads, but identical content is not republished.
+	if changed, _ := w.Poll(); !changed {
+		t.Fatal("expected initial publish")
+	}
+	if changed, err := w.Poll(); err != nil || changed {
+		t.Fatalf("expected no change, got changed=%v err=%v", changed, err)
+	}
+}
+
+func TestWatchingLoader_InitialFailureIsReturned(t *testing.T) {
+	files := fstest.MapFS{"prompts/1.1_design.md": &fstest.MapFile{Data: []byte(step11)}}
+	w := NewWatchingLoader(NewFileStepLoader(testFS{files}, "prompts"), 0)
+
+	for i := 0; i < 2; i++ {
+		if _, err := w.Load(); err == nil || !strings.Contains(err.Error(), "validate steps") {
+			t.Fatalf("load %d: expected validation error, got %v", i, err)
+		}
+	}
+}
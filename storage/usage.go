@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/package-register/trpc-agent-go-extensions/token"
+	"gorm.io/gorm"
+)
+
+// UsageRecord is one LLM invocation of a pipeline run.
+type UsageRecord struct {
+	ID               uint   `gorm:"primaryKey"`
+	RunID            string `gorm:"index"`
+	Variant          string `gorm:"index"` // pipeline variant being compared, e.g. a flow config name
+	Turn             int
+	StepID           string
+	NodeType         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+	Cost             float64
+	DurationMs       int64
+	CreatedAt        time.Time
+}
+
+// VariantCost sums the usage of all runs of one variant.
+type VariantCost struct {
+	Variant     string
+	Runs        int
+	TotalTokens int
+	Cost        float64
+}
+
+// MigrateUsage creates or updates the usage table.
+func MigrateUsage(db *gorm.DB) error {
+	if err := db.AutoMigrate(&UsageRecord{}); err != nil {
+		return fmt.Errorf("failed to migrate usage table: %w", err)
+	}
+	return nil
+}
+
+// SaveUsage stores the records of one run. token.Monitor.History keeps only
+// the most recent 1000 records; for longer runs store every record as it is
+// made with UsageRecorder instead.
+func SaveUsage(db *gorm.DB, runID, variant string, usages []token.TokenUsage) error {
+	if len(usages) == 0 {
+		return nil
+	}
+	records := make([]UsageRecord, len(usages))
+	for i, u := range usages {
+		records[i] = UsageRecord{
+			RunID:            runID,
+			Variant:          variant,
+			Turn:             u.TurnNumber,
+			StepID:           u.StepID,
+			NodeType:         u.NodeType,
+			Model:            u.Model,
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			TotalTokens:      u.TotalTokens,
+			Cost:             u.Cost,
+			DurationMs:       u.Duration.Milliseconds(),
+			CreatedAt:        u.Timestamp,
+		}
+	}
+	if err := db.Create(&records).Error; err != nil {
+		return fmt.Errorf("failed to save usage: %w", err)
+	}
+	return nil
+}
+
+// UsageRecorder returns a callback for token.WithRecordHook that stores every
+// usage of a run as soon as it is recorded. Errors are passed to onErr, if
+// set; the run is not interrupted.
+func UsageRecorder(db *gorm.DB, runID, variant string, onErr func(error)) func(token.TokenUsage) {
+	return func(u token.TokenUsage) {
+		if err := SaveUsage(db, runID, variant, []token.TokenUsage{u}); err != nil && onErr != nil {
+			onErr(err)
+		}
+	}
+}
+
+// CostByVariant returns the usage of each variant, cheapest first.
+func CostByVariant(db *gorm.DB) ([]VariantCost, error) {
+	var out []VariantCost
+	err := db.Model(&UsageRecord{}).
+		Select("variant, COUNT(DISTINCT run_id) AS runs, SUM(total_tokens) AS total_tokens, SUM(cost) AS cost").
+		Group("variant").
+		Order("cost").
+		Scan(&out).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	return out, nil
+}
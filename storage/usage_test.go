@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/log"
+	"github.com/package-register/trpc-agent-go-extensions/token"
+)
+
+func TestUsage_SaveAndCompareVariants(t *testing.T) {
+	db, err := NewSQLite(SQLiteConfig{Path: filepath.Join(t.TempDir(), "usage.db"), Logger: log.New(io.Discard)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUsage(db); err != nil {
+		t.Fatal(err)
+	}
+
+	runs := []struct {
+		run, variant string
+		cost         float64
+	}{
+		{"r1", "full", 0.5},
+		{"r2", "full", 0.7},
+		{"r3", "lite", 0.2},
+	}
+	for _, r := range runs {
+		usage := []token.TokenUsage{{TurnNumber: 1, StepID: "1.1", Model: "gpt-4o", TotalTokens: 100, Cost: r.cost}}
+		if err := SaveUsage(db, r.run, r.variant, usage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	costs, err := CostByVariant(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(costs) != 2 || costs[0].Variant != "lite" || costs[1].Runs != 2 || costs[1].TotalTokens != 200 {
+		t.Fatalf("unexpected variant costs: %+v", costs)
+	}
+}
+
+func TestUsageRecorder_StoresEveryRecord(t *testing.T) {
+	db, err := NewSQLite(SQLiteConfig{Path: filepath.Join(t.TempDir(), "usage.db"), Logger: log.New(io.Discard)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MigrateUsage(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var saveErr error
+	m := token.NewMonitor(0, token.WithRecordHook(UsageRecorder(db, "r1", "full", func(err error) { saveErr = err })))
+	const calls = 1005 // more than the monitor's history keeps
+	for i := 0; i < calls; i++ {
+		m.RecordUsage(token.TokenUsage{StepID: "1.1", Model: "gpt-4o", TotalTokens: 10, Cost: 0.001})
+	}
+	if saveErr != nil {
+		t.Fatal(saveErr)
+	}
+	if len(m.History()) >= calls {
+		t.Fatalf("expected capped history, got %d records", len(m.History()))
+	}
+
+	costs, err := CostByVariant(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(costs) != 1 || costs[0].TotalTokens != calls*10 {
+		t.Fatalf("expected all %d calls stored, got %+v", calls, costs)
+	}
+}
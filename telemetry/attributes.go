@@ -18,12 +18,34 @@ const (
 	AttrObservationType         = "langfuse.observation.type"
 	AttrObservationMetadata     = "langfuse.observation.metadata"
 	AttrObservationLevel        = "langfuse.observation.level"
+	AttrObservationStatus       = "langfuse.observation.status_message"
 	AttrObservationInput        = "langfuse.observation.input"
 	AttrObservationOutput       = "langfuse.observation.output"
 	AttrObservationModel        = "langfuse.observation.model.name"
 	AttrObservationUsageDetails = "langfuse.observation.usage_details"
 )
 
+// Pipeline attributes set by flow.TracingMiddleware
+const (
+	AttrPipelineRunID        = "pipeline.run.id"
+	AttrPipelineInvocationID = "pipeline.invocation.id"
+	AttrPipelineStepID       = "pipeline.step.id"
+	AttrPipelineStepTitle    = "pipeline.step.title"
+	AttrPipelineStepAttempt  = "pipeline.step.attempt"
+	AttrPipelineInterrupted  = "pipeline.interrupted"
+	AttrToolName             = "pipeline.tool.name"
+	AttrToolCallID           = "pipeline.tool.call_id"
+	AttrToolErrorCode        = "pipeline.tool.error_code"
+	AttrCompressionTokens    = "pipeline.compression.tokens_before"
+	AttrCompressionMsgsIn    = "pipeline.compression.messages_before"
+	AttrCompressionMsgsOut   = "pipeline.compression.messages_after"
+	AttrCompressionDuration  = "pipeline.compression.duration_ms"
+	AttrSummaryLength        = "pipeline.summary.length"
+
+	AttrUsageInputTokens  = "gen_ai.usage.input_tokens"
+	AttrUsageOutputTokens = "gen_ai.usage.output_tokens"
+)
+
 // Standard observation types
 const (
 	ObservationTypeEvent      = "event"
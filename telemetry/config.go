@@ -0,0 +1,60 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+)
+
+// NewFromConfig 按配置创建追踪器
+// 每个已配置的后端（Langfuse、OTLP、JSON）都会启用，多个后端时通过 Fanout 同时发送；
+// 均未配置时返回 Noop。采样、截断和脱敏策略（cfg.Policy）作用于所有后端。
+// 任一后端创建失败时关闭已创建的后端并返回错误
+func NewFromConfig(ctx context.Context, cfg config.TelemetryConfig) (Tracer, error) {
+	policy, err := NewTracePolicy(cfg.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracers []Tracer
+	fail := func(err error) (Tracer, error) {
+		for _, t := range tracers {
+			_ = t.Shutdown(ctx)
+		}
+		return nil, err
+	}
+
+	if lf := NewLangfuse(cfg.Langfuse); lf.IsEnabled() {
+		tracers = append(tracers, lf)
+	}
+	if cfg.OTLP.Endpoint != "" {
+		t, err := NewOTLP(ctx, cfg.OTLP)
+		if err != nil {
+			return fail(err)
+		}
+		tracers = append(tracers, t)
+	}
+	if cfg.JSON.Path != "" {
+		t, err := NewJSONFile(cfg.JSON.Path, cfg.OTLP.ServiceName)
+		if err != nil {
+			return fail(err)
+		}
+		tracers = append(tracers, t)
+	}
+	tracer := Fanout(tracers...)
+	if !tracer.IsEnabled() {
+		return tracer, nil
+	}
+	return policy.Wrap(tracer), nil
+}
+
+// InitFromConfig 按配置创建追踪器并设为全局追踪器
+func InitFromConfig(ctx context.Context, cfg config.TelemetryConfig) error {
+	tracer, err := NewFromConfig(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to init telemetry: %w", err)
+	}
+	Init(tracer)
+	return nil
+}
@@ -0,0 +1,150 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fanoutTracer 将每个 span 同时发送到多个追踪后端
+type fanoutTracer struct {
+	tracers []Tracer
+}
+
+// fanoutSpan 各后端 span 的组合
+type fanoutSpan struct {
+	spans []Span
+}
+
+// fanoutKey context 中保存 fanoutState 的键
+type fanoutKey struct{}
+
+// fanoutState 各后端的当前 span，仅对创建它的 tracer 实例有效
+type fanoutState struct {
+	t     *fanoutTracer
+	spans []trace.Span
+}
+
+// Fanout 返回同时写入多个后端的追踪器
+// 未启用的后端会被忽略；只剩一个后端时直接返回该后端，没有时返回 Noop
+func Fanout(tracers ...Tracer) Tracer {
+	var enabled []Tracer
+	for _, t := range tracers {
+		if t != nil && t.IsEnabled() {
+			enabled = append(enabled, t)
+		}
+	}
+	switch len(enabled) {
+	case 0:
+		return Noop()
+	case 1:
+		return enabled[0]
+	default:
+		return &fanoutTracer{tracers: enabled}
+	}
+}
+
+// StartSpan 在每个后端开始 span
+// 各后端的父 span 分别取自本 tracer 在 ctx 中保存的状态，避免一个后端的
+// span 成为另一个后端 span 的父节点；返回的 ctx 中当前 span 为第一个后端的 span
+func (t *fanoutTracer) StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	var parents []trace.Span
+	if st, ok := ctx.Value(fanoutKey{}).(*fanoutState); ok && st.t == t {
+		parents = st.spans
+	}
+	cfg := &SpanConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
+	spans := make([]Span, len(t.tracers))
+	current := make([]trace.Span, len(t.tracers))
+	for i, tracer := range t.tracers {
+		parentCtx := ctx
+		if parents != nil {
+			parentCtx = trace.ContextWithSpan(ctx, parents[i])
+		}
+		backendOpts := opts
+		if len(cfg.Links) > 0 {
+			backendOpts = append(opts[:len(opts):len(opts)], t.backendLinks(cfg.Links, i))
+		}
+		childCtx, span := tracer.StartSpan(parentCtx, name, backendOpts...)
+		spans[i] = span
+		current[i] = trace.SpanFromContext(childCtx)
+	}
+
+	ctx = context.WithValue(ctx, fanoutKey{}, &fanoutState{t: t, spans: current})
+	ctx = trace.ContextWithSpan(ctx, current[0])
+	return ctx, &fanoutSpan{spans: spans}
+}
+
+// backendLinks 将链接中的 fanoutSpan 替换为第 i 个后端的 span
+func (t *fanoutTracer) backendLinks(links []Span, i int) SpanOption {
+	return func(cfg *SpanConfig) {
+		cfg.Links = make([]Span, 0, len(links))
+		for _, l := range links {
+			if fs, ok := l.(*fanoutSpan); ok && len(fs.spans) == len(t.tracers) {
+				l = fs.spans[i]
+			}
+			cfg.Links = append(cfg.Links, l)
+		}
+	}
+}
+
+// Shutdown 关闭所有后端，返回合并的错误
+func (t *fanoutTracer) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, tracer := range t.tracers {
+		if err := tracer.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsEnabled 实现 Tracer 接口
+func (t *fanoutTracer) IsEnabled() bool {
+	return true
+}
+
+// SetAttributes 实现 Span 接口
+func (s *fanoutSpan) SetAttributes(attrs ...Attribute) {
+	for _, span := range s.spans {
+		span.SetAttributes(attrs...)
+	}
+}
+
+// SetStatus 实现 Span 接口
+func (s *fanoutSpan) SetStatus(status Status, description string) {
+	for _, span := range s.spans {
+		span.SetStatus(status, description)
+	}
+}
+
+// RecordError 实现 Span 接口
+func (s *fanoutSpan) RecordError(err error) {
+	for _, span := range s.spans {
+		span.RecordError(err)
+	}
+}
+
+// AddEvent 实现 Span 接口
+func (s *fanoutSpan) AddEvent(name string, attrs ...Attribute) {
+	for _, span := range s.spans {
+		span.AddEvent(name, attrs...)
+	}
+}
+
+// End 实现 Span 接口
+func (s *fanoutSpan) End() {
+	for _, span := range s.spans {
+		span.End()
+	}
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ Tracer = (*fanoutTracer)(nil)
+	_ Span   = (*fanoutSpan)(nil)
+)
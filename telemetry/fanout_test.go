@@ -0,0 +1,96 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+)
+
+func TestFanout_SendsToEveryBackend(t *testing.T) {
+	var a, b bytes.Buffer
+	tracer := Fanout(NewJSON(&a, "a"), Noop(), NewJSON(&b, "b"))
+
+	ctx, parent := tracer.StartSpan(context.Background(), "pipeline")
+	_, child := tracer.StartSpan(ctx, "step")
+	child.SetAttributes(Attribute{Key: "k", Value: "v"})
+	child.End()
+	parent.End()
+
+	for name, buf := range map[string]*bytes.Buffer{"a": &a, "b": &b} {
+		spans := decodeSpans(t, buf.Bytes())
+		if len(spans) != 2 {
+			t.Fatalf("backend %s: expected 2 spans, got %d", name, len(spans))
+		}
+		// 每个后端的父子关系只在本后端内部建立
+		if spans[0].ParentSpanID != spans[1].SpanID || spans[0].TraceID != spans[1].TraceID {
+			t.Fatalf("backend %s: child not linked to its own parent", name)
+		}
+		if spans[0].Attributes["k"] != "v" {
+			t.Fatalf("backend %s: attribute missing", name)
+		}
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFanout_Collapses(t *testing.T) {
+	if Fanout().IsEnabled() || Fanout(nil, Noop()).IsEnabled() {
+		t.Fatal("fanout without enabled backends should be noop")
+	}
+	single := NewJSON(&bytes.Buffer{}, "")
+	if Fanout(Noop(), single) != single {
+		t.Fatal("fanout with one backend should return it")
+	}
+}
+
+func TestNewFromConfig(t *testing.T) {
+	tracer, err := NewFromConfig(context.Background(), config.TelemetryConfig{})
+	if err != nil || tracer.IsEnabled() {
+		t.Fatalf("empty config should give noop, got %v, %v", tracer, err)
+	}
+
+	_, err = NewFromConfig(context.Background(), config.TelemetryConfig{
+		OTLP: config.OTLPConfig{Endpoint: "localhost:4317", Protocol: "zipkin"},
+	})
+	if err == nil {
+		t.Fatal("expected error for unsupported protocol")
+	}
+
+	tracer, err = NewFromConfig(context.Background(), config.TelemetryConfig{
+		OTLP: config.OTLPConfig{Endpoint: "http://localhost:4318", Protocol: "http/protobuf"},
+		JSON: config.JSONExporterConfig{Path: t.TempDir() + "/trace.jsonl"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt, ok := tracer.(*policyTracer)
+	if !ok {
+		t.Fatalf("expected policy-wrapped tracer, got %T", tracer)
+	}
+	if _, ok := pt.inner.(*fanoutTracer); !ok {
+		t.Fatalf("expected fanout tracer, got %T", pt.inner)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // 不等待导出到不存在的 collector
+	_ = tracer.Shutdown(ctx)
+}
+
+func TestFanout_LinksPerBackend(t *testing.T) {
+	var a, b bytes.Buffer
+	tracer := Fanout(NewJSON(&a, "a"), NewJSON(&b, "b"))
+
+	_, first := tracer.StartSpan(context.Background(), "attempt 1")
+	first.End()
+	_, second := tracer.StartSpan(context.Background(), "attempt 2", WithLinks(first))
+	second.End()
+
+	for name, buf := range map[string]*bytes.Buffer{"a": &a, "b": &b} {
+		spans := decodeSpans(t, buf.Bytes())
+		if len(spans[1].Links) != 1 || spans[1].Links[0].SpanID != spans[0].SpanID {
+			t.Fatalf("backend %s: link should point to its own span: %+v", name, spans[1].Links)
+		}
+	}
+}
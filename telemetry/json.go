@@ -0,0 +1,140 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// JSONSpan JSON 导出器每行输出的 span 记录
+type JSONSpan struct {
+	TraceID       string         `json:"trace_id"`
+	SpanID        string         `json:"span_id"`
+	ParentSpanID  string         `json:"parent_span_id,omitempty"`
+	Name          string         `json:"name"`
+	StartTime     time.Time      `json:"start_time"`
+	EndTime       time.Time      `json:"end_time"`
+	DurationMs    float64        `json:"duration_ms"`
+	Status        string         `json:"status,omitempty"`
+	StatusMessage string         `json:"status_message,omitempty"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Events        []JSONEvent    `json:"events,omitempty"`
+	Links         []JSONLink     `json:"links,omitempty"`
+}
+
+// JSONEvent span 上的事件（包括 RecordError 记录的异常）
+type JSONEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// JSONLink 指向其他 span 的链接
+type JSONLink struct {
+	TraceID string `json:"trace_id"`
+	SpanID  string `json:"span_id"`
+}
+
+// NewJSON 创建将 span 以 JSON Lines 写入 w 的追踪器，用于本地调试
+// span 在结束时同步写出
+func NewJSON(w io.Writer, serviceName string) Tracer {
+	return newOTelTracer(serviceName, sdktrace.NewSimpleSpanProcessor(&jsonExporter{w: w}))
+}
+
+// NewJSONFile 创建写入文件的 JSON 追踪器，path 为 "-" 时写入标准输出
+// 文件以追加方式打开，Shutdown 时关闭
+func NewJSONFile(path, serviceName string) (Tracer, error) {
+	if path == "-" {
+		return NewJSON(os.Stdout, serviceName), nil
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return newOTelTracer(serviceName, sdktrace.NewSimpleSpanProcessor(&jsonExporter{w: f, closer: f})), nil
+}
+
+// jsonExporter 实现 sdktrace.SpanExporter，每个 span 输出一行 JSON
+type jsonExporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// ExportSpans 实现 sdktrace.SpanExporter 接口
+func (e *jsonExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	enc := json.NewEncoder(e.w)
+	for _, s := range spans {
+		if err := enc.Encode(toJSONSpan(s)); err != nil {
+			return fmt.Errorf("failed to write span: %w", err)
+		}
+	}
+	return nil
+}
+
+// Shutdown 实现 sdktrace.SpanExporter 接口
+func (e *jsonExporter) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closer == nil {
+		return nil
+	}
+	err := e.closer.Close()
+	e.closer = nil
+	return err
+}
+
+// toJSONSpan 转换 span 快照
+func toJSONSpan(s sdktrace.ReadOnlySpan) JSONSpan {
+	out := JSONSpan{
+		TraceID:    s.SpanContext().TraceID().String(),
+		SpanID:     s.SpanContext().SpanID().String(),
+		Name:       s.Name(),
+		StartTime:  s.StartTime(),
+		EndTime:    s.EndTime(),
+		DurationMs: float64(s.EndTime().Sub(s.StartTime())) / float64(time.Millisecond),
+	}
+	if s.Parent().IsValid() {
+		out.ParentSpanID = s.Parent().SpanID().String()
+	}
+	if code := s.Status().Code; code != 0 {
+		out.Status = code.String()
+		out.StatusMessage = s.Status().Description
+	}
+	if attrs := s.Attributes(); len(attrs) > 0 {
+		out.Attributes = make(map[string]any, len(attrs))
+		for _, kv := range attrs {
+			out.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+		}
+	}
+	for _, ev := range s.Events() {
+		je := JSONEvent{Name: ev.Name, Time: ev.Time}
+		if len(ev.Attributes) > 0 {
+			je.Attributes = make(map[string]any, len(ev.Attributes))
+			for _, kv := range ev.Attributes {
+				je.Attributes[string(kv.Key)] = kv.Value.AsInterface()
+			}
+		}
+		out.Events = append(out.Events, je)
+	}
+	for _, l := range s.Links() {
+		out.Links = append(out.Links, JSONLink{
+			TraceID: l.SpanContext.TraceID().String(),
+			SpanID:  l.SpanContext.SpanID().String(),
+		})
+	}
+	return out
+}
+
+// Verify interface compliance at compile time.
+var _ sdktrace.SpanExporter = (*jsonExporter)(nil)
@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func decodeSpans(t *testing.T, data []byte) []JSONSpan {
+	t.Helper()
+	var spans []JSONSpan
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		var s JSONSpan
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", sc.Text(), err)
+		}
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func TestJSONTracer_WritesSpans(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewJSON(&buf, "test")
+
+	ctx, parent := tracer.StartSpan(context.Background(), "pipeline",
+		WithAttributes(map[string]any{"step": "draft", "attempt": 2}))
+	_, child := tracer.StartSpan(ctx, "tool")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.SetStatus(StatusOK, "")
+	parent.End()
+
+	spans := decodeSpans(t, buf.Bytes())
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if c.Name != "tool" || p.Name != "pipeline" {
+		t.Fatalf("unexpected span order: %s, %s", c.Name, p.Name)
+	}
+	if c.TraceID != p.TraceID || c.ParentSpanID != p.SpanID {
+		t.Fatalf("child not linked to parent: %+v / %+v", c, p)
+	}
+	if c.Status != "Error" || c.StatusMessage != "boom" || len(c.Events) != 1 {
+		t.Fatalf("error not recorded: %+v", c)
+	}
+	if p.Status != "Ok" || p.Attributes["step"] != "draft" || p.Attributes["attempt"] != float64(2) {
+		t.Fatalf("unexpected parent: %+v", p)
+	}
+}
+
+func TestNewJSONFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	tracer, err := NewJSONFile(path, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracer.StartSpan(context.Background(), "step")
+	span.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spans := decodeSpans(t, data); len(spans) != 1 || spans[0].Name != "step" {
+		t.Fatalf("unexpected spans: %+v", spans)
+	}
+}
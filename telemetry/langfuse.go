@@ -22,8 +22,10 @@ type langfuseTracer struct {
 }
 
 // langfuseSpan Langfuse span 包装
+// 在 OpenTelemetry 状态之外同步设置 Langfuse 的 observation level，
+// 使错误在 Langfuse 界面中正确显示
 type langfuseSpan struct {
-	span trace.Span
+	otelSpan
 }
 
 // NewLangfuse 从配置创建 Langfuse 追踪器
@@ -46,20 +48,17 @@ func (t *langfuseTracer) StartSpan(ctx context.Context, name string, opts ...Spa
 		return ctx, &noopSpan{}
 	}
 
-	// 构建属性
-	var attrs []attribute.KeyValue
 	cfg := &SpanConfig{}
 	for _, opt := range opts {
 		opt(cfg)
 	}
-
-	for k, v := range cfg.Attributes {
-		attrs = append(attrs, attribute.String(k, fmt.Sprintf("%v", v)))
-	}
+	applyRunAttributes(ctx, cfg)
 
 	// 创建 span
-	ctx, span := atrace.Tracer.Start(ctx, name, trace.WithAttributes(attrs...))
-	return ctx, &langfuseSpan{span: span}
+	ctx, span := atrace.Tracer.Start(ctx, name,
+		trace.WithAttributes(otelAttributeMap(cfg.Attributes)...),
+		trace.WithLinks(otelLinks(cfg.Links)...))
+	return ctx, &langfuseSpan{otelSpan{span: span}}
 }
 
 // Shutdown 关闭追踪器
@@ -88,41 +87,29 @@ func (t *langfuseTracer) lazyInit(ctx context.Context) error {
 	return t.initErr
 }
 
-// SetAttributes 设置属性
-func (s *langfuseSpan) SetAttributes(attrs ...Attribute) {
-	if s.span == nil {
-		return
-	}
-
-	var otelAttrs []attribute.KeyValue
-	for _, attr := range attrs {
-		otelAttrs = append(otelAttrs, attribute.String(attr.Key, fmt.Sprintf("%v", attr.Value)))
-	}
-	s.span.SetAttributes(otelAttrs...)
-}
-
-// SetStatus 设置状态
+// SetStatus 设置状态，错误时将 observation level 置为 ERROR
 func (s *langfuseSpan) SetStatus(status Status, description string) {
-	// OpenTelemetry 的状态设置较为复杂，这里简化处理
-	if s.span != nil && status.Code == StatusError.Code {
-		s.span.SetAttributes(attribute.String("error", description))
+	s.otelSpan.SetStatus(status, description)
+	if status.Code == StatusError.Code {
+		s.markError(description)
 	}
 }
 
-// RecordError 记录错误
+// RecordError 记录异常事件并将 span 置为错误
 func (s *langfuseSpan) RecordError(err error) {
-	if s.span == nil || err == nil {
+	if err == nil {
 		return
 	}
-	s.span.SetAttributes(attribute.String("error.message", err.Error()))
-	s.span.SetAttributes(attribute.String(AttrObservationLevel, "ERROR"))
+	s.otelSpan.RecordError(err)
+	s.markError(err.Error())
 }
 
-// End 结束 span
-func (s *langfuseSpan) End() {
-	if s.span != nil {
-		s.span.End()
-	}
+// markError 设置 Langfuse 的错误级别和状态信息
+func (s *langfuseSpan) markError(message string) {
+	s.span.SetAttributes(
+		attribute.String(AttrObservationLevel, "ERROR"),
+		attribute.String(AttrObservationStatus, message),
+	)
 }
 
 // InitLangfuse 初始化 Langfuse（由 main.go 调用）
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordedLangfuseSpan(t *testing.T) (*langfuseSpan, *tracetest.SpanRecorder) {
+	t.Helper()
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+	_, span := provider.Tracer("test").Start(context.Background(), "step")
+	return &langfuseSpan{otelSpan{span: span}}, rec
+}
+
+func TestLangfuseSpan_RecordError(t *testing.T) {
+	span, rec := recordedLangfuseSpan(t)
+	span.RecordError(errors.New("tool timed out"))
+	span.End()
+
+	ended := rec.Ended()[0]
+	if ended.Status().Code != codes.Error || ended.Status().Description != "tool timed out" {
+		t.Errorf("unexpected status: %+v", ended.Status())
+	}
+	if len(ended.Events()) != 1 || ended.Events()[0].Name != "exception" {
+		t.Errorf("expected exception event, got %+v", ended.Events())
+	}
+	attrs := attribute.NewSet(ended.Attributes()...)
+	if v, _ := attrs.Value(AttrObservationLevel); v.AsString() != "ERROR" {
+		t.Errorf("expected ERROR level, got %q", v.AsString())
+	}
+}
+
+func TestLangfuseSpan_TypedAttributesAndEvents(t *testing.T) {
+	span, rec := recordedLangfuseSpan(t)
+	span.SetAttributes(
+		IntAttr("tokens", 42),
+		BoolAttr("cached", true),
+		Attribute{Key: "tags", Value: []string{"a", "b"}},
+	)
+	span.AddEvent("compression", IntAttr("before", 9000))
+	span.SetStatus(StatusOK, "")
+	span.End()
+
+	ended := rec.Ended()[0]
+	attrs := attribute.NewSet(ended.Attributes()...)
+	if v, _ := attrs.Value("tokens"); v.Type() != attribute.INT64 || v.AsInt64() != 42 {
+		t.Errorf("tokens not typed: %v", v)
+	}
+	if v, _ := attrs.Value("cached"); v.Type() != attribute.BOOL {
+		t.Errorf("cached not typed: %v", v)
+	}
+	if v, _ := attrs.Value("tags"); v.Type() != attribute.STRINGSLICE {
+		t.Errorf("tags not typed: %v", v)
+	}
+	if ended.Status().Code != codes.Ok {
+		t.Errorf("unexpected status: %+v", ended.Status())
+	}
+	if len(ended.Events()) != 1 || ended.Events()[0].Name != "compression" {
+		t.Errorf("unexpected events: %+v", ended.Events())
+	}
+}
@@ -40,5 +40,8 @@ func (s *noopSpan) SetStatus(status Status, description string) {}
 // RecordError 实现 Span 接口
 func (s *noopSpan) RecordError(err error) {}
 
+// AddEvent 实现 Span 接口
+func (s *noopSpan) AddEvent(name string, attrs ...Attribute) {}
+
 // End 实现 Span 接口
 func (s *noopSpan) End() {}
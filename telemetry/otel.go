@@ -0,0 +1,190 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 本模块创建的 span 所属的 instrumentation scope
+const instrumentationName = "github.com/package-register/trpc-agent-go-extensions/telemetry"
+
+// defaultServiceName 未配置服务名时使用
+const defaultServiceName = "trpc-agent"
+
+// otelTracer 基于 OpenTelemetry SDK 的追踪器
+// 使用独立的 TracerProvider，不修改 otel 全局状态，可与 Langfuse 并存
+type otelTracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// otelSpan OpenTelemetry span 包装
+type otelSpan struct {
+	span trace.Span
+}
+
+// newOTelTracer 使用给定的 span 处理器创建追踪器
+func newOTelTracer(serviceName string, processor sdktrace.SpanProcessor) *otelTracer {
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", serviceName)))
+	if err != nil {
+		res = resource.NewSchemaless(attribute.String("service.name", serviceName))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+		sdktrace.WithSpanProcessor(processor),
+	)
+	return &otelTracer{provider: provider, tracer: provider.Tracer(instrumentationName)}
+}
+
+// StartSpan 开始一个新的 span
+func (t *otelTracer) StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	cfg := &SpanConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	applyRunAttributes(ctx, cfg)
+
+	attrs := otelAttributeMap(cfg.Attributes)
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(attrs...), trace.WithLinks(otelLinks(cfg.Links)...))
+	return ctx, &otelSpan{span: span}
+}
+
+// Shutdown 导出剩余 span 并关闭追踪器
+func (t *otelTracer) Shutdown(ctx context.Context) error {
+	return t.provider.Shutdown(ctx)
+}
+
+// IsEnabled 检查是否启用
+func (t *otelTracer) IsEnabled() bool {
+	return true
+}
+
+// SetAttributes 设置属性
+func (s *otelSpan) SetAttributes(attrs ...Attribute) {
+	s.span.SetAttributes(otelAttributes(attrs)...)
+}
+
+// AddEvent 记录事件
+func (s *otelSpan) AddEvent(name string, attrs ...Attribute) {
+	s.span.AddEvent(name, trace.WithAttributes(otelAttributes(attrs)...))
+}
+
+// SetStatus 设置状态
+func (s *otelSpan) SetStatus(status Status, description string) {
+	switch status.Code {
+	case StatusOK.Code:
+		s.span.SetStatus(codes.Ok, "")
+	case StatusError.Code:
+		s.span.SetStatus(codes.Error, description)
+	}
+}
+
+// RecordError 记录错误
+func (s *otelSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End 结束 span
+func (s *otelSpan) End() {
+	s.span.End()
+}
+
+// spanContext 供其他 span 建立链接
+func (s *otelSpan) spanContext() trace.SpanContext {
+	return s.span.SpanContext()
+}
+
+// linkable 可被链接的 span（基于 OpenTelemetry 的实现）
+type linkable interface {
+	spanContext() trace.SpanContext
+}
+
+// otelLinks 转换链接，忽略不基于 OpenTelemetry 的 span（如 noop）
+func otelLinks(spans []Span) []trace.Link {
+	var links []trace.Link
+	for _, s := range spans {
+		l, ok := s.(linkable)
+		if !ok {
+			continue
+		}
+		if sc := l.spanContext(); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return links
+}
+
+// otelAttributes 转换属性列表
+func otelAttributes(attrs []Attribute) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		out = append(out, otelAttribute(attr.Key, attr.Value))
+	}
+	return out
+}
+
+// otelAttributeMap 转换 SpanConfig 中的属性
+func otelAttributeMap(attrs map[string]any) []attribute.KeyValue {
+	out := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		out = append(out, otelAttribute(k, v))
+	}
+	return out
+}
+
+// otelAttribute 按值类型转换属性，time.Duration 记为毫秒，其他类型格式化为字符串
+func otelAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	case int32:
+		return attribute.Int(key, int(v))
+	case float32:
+		return attribute.Float64(key, float64(v))
+	case []string:
+		return attribute.StringSlice(key, v)
+	case []int:
+		return attribute.IntSlice(key, v)
+	case []int64:
+		return attribute.Int64Slice(key, v)
+	case []float64:
+		return attribute.Float64Slice(key, v)
+	case []bool:
+		return attribute.BoolSlice(key, v)
+	case time.Duration:
+		return attribute.Int64(key, v.Milliseconds())
+	case fmt.Stringer:
+		return attribute.String(key, v.String())
+	default:
+		return attribute.String(key, fmt.Sprintf("%v", v))
+	}
+}
+
+// Verify interface compliance at compile time.
+var (
+	_ Tracer = (*otelTracer)(nil)
+	_ Span   = (*otelSpan)(nil)
+)
@@ -0,0 +1,94 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// OTLP 传输协议
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http"
+)
+
+// NewOTLP 从配置创建 OTLP 追踪器（Jaeger、Tempo、OTel Collector 等）
+// 导出器不会在创建时建立连接，span 批量异步发送
+func NewOTLP(ctx context.Context, cfg config.OTLPConfig) (Tracer, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("otlp endpoint not provided")
+	}
+
+	exporter, err := newOTLPExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newOTelTracer(cfg.ServiceName, sdktrace.NewBatchSpanProcessor(exporter)), nil
+}
+
+// newOTLPExporter 按协议创建导出器
+// Endpoint 带 scheme 时按 URL 解析，否则视为 host:port
+func newOTLPExporter(ctx context.Context, cfg config.OTLPConfig) (*otlptrace.Exporter, error) {
+	isURL := strings.Contains(cfg.Endpoint, "://")
+
+	switch normalizeProtocol(cfg.Protocol) {
+	case ProtocolGRPC:
+		var opts []otlptracegrpc.Option
+		if isURL {
+			opts = append(opts, otlptracegrpc.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracegrpc.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracegrpc.WithHeaders(cfg.Headers))
+		}
+		exporter, err := otlptracegrpc.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp grpc exporter: %w", err)
+		}
+		return exporter, nil
+
+	case ProtocolHTTP:
+		var opts []otlptracehttp.Option
+		if isURL {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.Endpoint))
+		} else {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		if len(cfg.Headers) > 0 {
+			opts = append(opts, otlptracehttp.WithHeaders(cfg.Headers))
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create otlp http exporter: %w", err)
+		}
+		return exporter, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported otlp protocol %q", cfg.Protocol)
+	}
+}
+
+// normalizeProtocol 兼容 OTEL_EXPORTER_OTLP_PROTOCOL 的取值
+func normalizeProtocol(protocol string) string {
+	switch strings.ToLower(protocol) {
+	case "", ProtocolGRPC:
+		return ProtocolGRPC
+	case ProtocolHTTP, "http/protobuf":
+		return ProtocolHTTP
+	default:
+		return protocol
+	}
+}
@@ -0,0 +1,51 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+)
+
+func TestNormalizeProtocol(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              ProtocolGRPC,
+		"GRPC":          ProtocolGRPC,
+		"http":          ProtocolHTTP,
+		"http/protobuf": ProtocolHTTP,
+		"http/json":     "http/json",
+	} {
+		if got := normalizeProtocol(in); got != want {
+			t.Errorf("normalizeProtocol(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNewOTLP(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewOTLP(ctx, config.OTLPConfig{}); err == nil {
+		t.Error("expected error for empty endpoint")
+	}
+
+	_, err := NewOTLP(ctx, config.OTLPConfig{Endpoint: "localhost:4318", Protocol: "http/json"})
+	if err == nil || !strings.Contains(err.Error(), `unsupported otlp protocol "http/json"`) {
+		t.Errorf("expected unsupported protocol error, got %v", err)
+	}
+
+	for _, cfg := range []config.OTLPConfig{
+		{Endpoint: "localhost:4317", Insecure: true, ServiceName: "test"},
+		{Endpoint: "http://localhost:4318/v1/traces", Protocol: "http/protobuf", ServiceName: "test"},
+	} {
+		tracer, err := NewOTLP(ctx, cfg)
+		if err != nil {
+			t.Fatalf("NewOTLP(%+v): %v", cfg, err)
+		}
+		if !tracer.IsEnabled() {
+			t.Errorf("expected OTLP tracer for %q to be enabled", cfg.Endpoint)
+		}
+		if err := tracer.Shutdown(ctx); err != nil {
+			t.Errorf("shutdown %q: %v", cfg.Endpoint, err)
+		}
+	}
+}
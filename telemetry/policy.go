@@ -0,0 +1,265 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedText 替换被脱敏内容的占位符
+const redactedText = "[REDACTED]"
+
+// redaction 脱敏规则，匹配内容按 replacement 替换（支持 $1 等分组引用）
+type redaction struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// defaultRedactions 内置脱敏规则：API key、Bearer token、云厂商密钥、
+// key=value 形式的凭证和用户目录路径（暴露用户名）
+var defaultRedactions = []struct{ expr, replacement string }{
+	{`sk-[A-Za-z0-9_\-]{16,}`, redactedText},
+	{`(?i)bearer\s+[A-Za-z0-9._\-+/=]{8,}`, "Bearer " + redactedText},
+	{`AKIA[0-9A-Z]{16}`, redactedText},
+	{`(?i)\b(api[_-]?key|secret|token|password)(["']?\s*[:=]\s*["']?)[^\s"',}]+`, "${1}${2}" + redactedText},
+	{`(/home|/Users)/[^/\s"']+`, "${1}/" + redactedText},
+}
+
+// ioAttributes 仅在开启 CaptureIO 时记录的输入输出属性
+var ioAttributes = map[string]bool{
+	AttrObservationInput:  true,
+	AttrObservationOutput: true,
+	AttrTraceInput:        true,
+	AttrTraceOutput:       true,
+}
+
+// TracePolicy 追踪策略：头部采样、属性截断、正则脱敏和输入输出采集开关
+// 通过 Wrap 作用于任意追踪器，对所有后端生效
+type TracePolicy struct {
+	sampleRate float64
+	maxLen     int
+	limits     map[string]int
+	redact     []redaction
+	captureIO  bool
+	random     func() float64 // 可替换，便于测试
+}
+
+// NewTracePolicy 从配置创建追踪策略，正则无效时返回错误
+func NewTracePolicy(cfg config.TracePolicyConfig) (*TracePolicy, error) {
+	p := &TracePolicy{
+		sampleRate: cfg.SampleRate,
+		maxLen:     cfg.MaxAttributeLength,
+		limits:     cfg.AttributeLimits,
+		captureIO:  cfg.CaptureIO,
+		random:     rand.Float64,
+	}
+	if p.sampleRate <= 0 || p.sampleRate > 1 {
+		p.sampleRate = 1
+	}
+	for _, r := range defaultRedactions {
+		p.redact = append(p.redact, redaction{re: regexp.MustCompile(r.expr), replacement: r.replacement})
+	}
+	for _, expr := range cfg.Redact {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		p.redact = append(p.redact, redaction{re: re, replacement: redactedText})
+	}
+	return p, nil
+}
+
+// Wrap 返回应用该策略的追踪器
+func (p *TracePolicy) Wrap(t Tracer) Tracer {
+	return &policyTracer{inner: t, policy: p}
+}
+
+// CapturesIO 检查追踪器是否开启了完整输入输出采集
+// 未经策略包装的追踪器不采集（输入输出未经脱敏）
+func CapturesIO(t Tracer) bool {
+	pt, ok := t.(*policyTracer)
+	return ok && pt.policy.captureIO && pt.IsEnabled()
+}
+
+// Redact 替换 s 中所有匹配脱敏规则的内容
+func (p *TracePolicy) Redact(s string) string {
+	for _, r := range p.redact {
+		s = r.re.ReplaceAllString(s, r.replacement)
+	}
+	return s
+}
+
+// sanitize 处理单个属性；返回 false 表示丢弃该属性
+func (p *TracePolicy) sanitize(key string, value any) (any, bool) {
+	if ioAttributes[key] && !p.captureIO {
+		return nil, false
+	}
+	// 输入输出属性默认不截断，除非为该键显式配置了长度限制
+	limit := p.maxLen
+	if ioAttributes[key] {
+		limit = 0
+	}
+	if l, ok := p.limits[key]; ok {
+		limit = l
+	}
+
+	switch v := value.(type) {
+	case string:
+		return truncate(p.Redact(v), limit), true
+	case []string:
+		out := make([]string, len(v))
+		for i, s := range v {
+			out[i] = truncate(p.Redact(s), limit)
+		}
+		return out, true
+	case error:
+		return truncate(p.Redact(v.Error()), limit), true
+	case fmt.Stringer:
+		return truncate(p.Redact(v.String()), limit), true
+	default:
+		return value, true
+	}
+}
+
+func (p *TracePolicy) sanitizeAttributes(attrs []Attribute) []Attribute {
+	out := make([]Attribute, 0, len(attrs))
+	for _, a := range attrs {
+		if v, ok := p.sanitize(a.Key, a.Value); ok {
+			out = append(out, Attribute{Key: a.Key, Value: v})
+		}
+	}
+	return out
+}
+
+// truncate 按字节截断（保持 UTF-8 完整），limit <= 0 不截断
+func truncate(s string, limit int) string {
+	if limit <= 0 || len(s) <= limit {
+		return s
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s...(truncated %d bytes)", s[:cut], len(s)-cut)
+}
+
+// samplingKey context 中保存的采样决定
+type samplingKey struct{}
+
+// policyTracer 应用 TracePolicy 的追踪器包装
+type policyTracer struct {
+	inner  Tracer
+	policy *TracePolicy
+}
+
+// policySpan 对属性、事件和错误做截断与脱敏
+type policySpan struct {
+	inner  Span
+	policy *TracePolicy
+}
+
+// StartSpan 在根 span 处做采样决定，子 span 继承该决定
+// 属性在交给后端前处理，链接中的 policySpan 还原为后端 span
+func (t *policyTracer) StartSpan(ctx context.Context, name string, opts ...SpanOption) (context.Context, Span) {
+	sampled, decided := ctx.Value(samplingKey{}).(bool)
+	if !decided {
+		sampled = t.policy.sampleRate >= 1 || t.policy.random() < t.policy.sampleRate
+		ctx = context.WithValue(ctx, samplingKey{}, sampled)
+	}
+	if !sampled {
+		return ctx, &noopSpan{}
+	}
+
+	cfg := &SpanConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	attrs := make(map[string]any, len(cfg.Attributes))
+	for k, v := range cfg.Attributes {
+		if sv, ok := t.policy.sanitize(k, v); ok {
+			attrs[k] = sv
+		}
+	}
+	links := make([]Span, len(cfg.Links))
+	for i, l := range cfg.Links {
+		if ps, ok := l.(*policySpan); ok {
+			l = ps.inner
+		}
+		links[i] = l
+	}
+	sanitized := func(c *SpanConfig) {
+		c.Attributes = attrs
+		c.Links = links
+	}
+
+	ctx, span := t.inner.StartSpan(ctx, name, append(opts[:len(opts):len(opts)], sanitized)...)
+	return ctx, &policySpan{inner: span, policy: t.policy}
+}
+
+// Shutdown 实现 Tracer 接口
+func (t *policyTracer) Shutdown(ctx context.Context) error {
+	return t.inner.Shutdown(ctx)
+}
+
+// IsEnabled 实现 Tracer 接口
+func (t *policyTracer) IsEnabled() bool {
+	return t.inner.IsEnabled()
+}
+
+// SetAttributes 实现 Span 接口
+func (s *policySpan) SetAttributes(attrs ...Attribute) {
+	if attrs = s.policy.sanitizeAttributes(attrs); len(attrs) > 0 {
+		s.inner.SetAttributes(attrs...)
+	}
+}
+
+// SetStatus 实现 Span 接口
+func (s *policySpan) SetStatus(status Status, description string) {
+	s.inner.SetStatus(status, s.policy.Redact(description))
+}
+
+// RecordError 实现 Span 接口，错误信息经过脱敏
+func (s *policySpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.inner.RecordError(redactedError{msg: s.policy.Redact(err.Error()), err: err})
+}
+
+// AddEvent 实现 Span 接口
+func (s *policySpan) AddEvent(name string, attrs ...Attribute) {
+	s.inner.AddEvent(name, s.policy.sanitizeAttributes(attrs)...)
+}
+
+// End 实现 Span 接口
+func (s *policySpan) End() {
+	s.inner.End()
+}
+
+// spanContext 透传被包装 span 的链接信息
+func (s *policySpan) spanContext() trace.SpanContext {
+	if l, ok := s.inner.(linkable); ok {
+		return l.spanContext()
+	}
+	return trace.SpanContext{}
+}
+
+// redactedError 以脱敏后的信息替代原错误信息，保留原错误链
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e redactedError) Error() string { return e.msg }
+func (e redactedError) Unwrap() error { return e.err }
+
+// Verify interface compliance at compile time.
+var (
+	_ Tracer = (*policyTracer)(nil)
+	_ Span   = (*policySpan)(nil)
+)
@@ -0,0 +1,142 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/package-register/trpc-agent-go-extensions/config"
+)
+
+func TestTracePolicy_RedactsAndTruncates(t *testing.T) {
+	policy, err := NewTracePolicy(config.TracePolicyConfig{
+		MaxAttributeLength: 16,
+		AttributeLimits:    map[string]int{"long": 64, "auth": 0},
+		Redact:             []string{`internal-[0-9]+`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tracer := policy.Wrap(NewJSON(&buf, "test"))
+
+	_, span := tracer.StartSpan(context.Background(), "step", WithAttributes(map[string]any{
+		"auth": "Bearer abcdefghijklmnop",
+		"n":    42,
+	}))
+	span.SetAttributes(
+		StringAttr("short", "汉字汉字汉字汉字汉字"),
+		StringAttr("long", "key sk-abcdefghijklmnopqrstuvwxyz in /home/alice/project"),
+		StringAttr("host", "internal-42"),
+		StringAttr(AttrObservationInput, "full prompt"),
+	)
+	span.RecordError(errors.New("api_key=secret123 rejected"))
+	span.End()
+
+	spans := decodeSpans(t, buf.Bytes())
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	attrs := spans[0].Attributes
+	if attrs["auth"] != "Bearer [REDACTED]" || attrs["n"] != float64(42) {
+		t.Errorf("unexpected start attributes: %v", attrs)
+	}
+	if short := attrs["short"].(string); !strings.HasPrefix(short, "汉字汉字汉...(truncated") {
+		t.Errorf("expected rune-safe truncation, got %q", short)
+	}
+	if attrs["long"] != "key [REDACTED] in /home/[REDACTED]/project" {
+		t.Errorf("per-key limit or redaction not applied: %q", attrs["long"])
+	}
+	if attrs["host"] != "[REDACTED]" {
+		t.Errorf("custom rule not applied: %q", attrs["host"])
+	}
+	if _, ok := attrs[AttrObservationInput]; ok {
+		t.Error("input should not be captured without CaptureIO")
+	}
+	if msg := spans[0].StatusMessage; msg != "api_key=[REDACTED] rejected" {
+		t.Errorf("error not redacted: %q", msg)
+	}
+}
+
+func TestTracePolicy_CaptureIO(t *testing.T) {
+	policy, err := NewTracePolicy(config.TracePolicyConfig{MaxAttributeLength: 8, CaptureIO: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tracer := policy.Wrap(NewJSON(&buf, "test"))
+	if !CapturesIO(tracer) || CapturesIO(NewJSON(&buf, "test")) {
+		t.Fatal("CapturesIO should only report policy tracers that opted in")
+	}
+
+	_, span := tracer.StartSpan(context.Background(), "generation")
+	span.SetAttributes(StringAttr(AttrObservationOutput, "a long answer with token: abc123"))
+	span.End()
+
+	out := decodeSpans(t, buf.Bytes())[0].Attributes[AttrObservationOutput]
+	if out != "a long answer with token: [REDACTED]" {
+		t.Errorf("captured output should be redacted but not truncated, got %q", out)
+	}
+}
+func TestTracePolicy_CaptureIOHonorsKeyLimit(t *testing.T) {
+	policy, err := NewTracePolicy(config.TracePolicyConfig{
+		MaxAttributeLength: 8,
+		AttributeLimits:    map[string]int{AttrObservationInput: 12},
+		CaptureIO:          true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	tracer := policy.Wrap(NewJSON(&buf, "test"))
+
+	_, span := tracer.StartSpan(context.Background(), "generation")
+	span.SetAttributes(
+		StringAttr(AttrObservationInput, "a very long prompt that exceeds the limit"),
+		StringAttr(AttrObservationOutput, "a long answer that stays whole"),
+	)
+	span.End()
+
+	attrs := decodeSpans(t, buf.Bytes())[0].Attributes
+	if in := attrs[AttrObservationInput].(string); !strings.HasPrefix(in, "a very long ...(truncated") {
+		t.Errorf("explicit input limit not applied, got %q", in)
+	}
+	if attrs[AttrObservationOutput] != "a long answer that stays whole" {
+		t.Errorf("output without a key limit should not be truncated, got %q", attrs[AttrObservationOutput])
+	}
+}
+
+func TestTracePolicy_SamplesWholeTraces(t *testing.T) {
+	policy, err := NewTracePolicy(config.TracePolicyConfig{SampleRate: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	draws := []float64{0.9, 0.1}
+	policy.random = func() float64 {
+		d := draws[0]
+		draws = draws[1:]
+		return d
+	}
+	var buf bytes.Buffer
+	tracer := policy.Wrap(NewJSON(&buf, "test"))
+
+	for _, name := range []string{"dropped", "kept"} {
+		ctx, root := tracer.StartSpan(context.Background(), name)
+		_, child := tracer.StartSpan(ctx, name+".child")
+		child.End()
+		root.End()
+	}
+
+	spans := decodeSpans(t, buf.Bytes())
+	if len(spans) != 2 || spans[0].Name != "kept.child" || spans[1].Name != "kept" {
+		t.Fatalf("expected only the sampled trace, got %+v", spans)
+	}
+}
+
+func TestNewTracePolicy_InvalidPattern(t *testing.T) {
+	if _, err := NewTracePolicy(config.TracePolicyConfig{Redact: []string{"("}}); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
@@ -0,0 +1,92 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RunInfo 描述一次 pipeline 运行
+// 通过 WithRun 挂载到 context 后，该运行内创建的所有 span 都会带上这些属性
+type RunInfo struct {
+	RunID     string
+	SessionID string
+	UserID    string
+	Tags      []string
+}
+
+type runInfoKey struct{}
+
+// WithRun 在 pipeline 开始时将运行信息挂载到 context
+func WithRun(ctx context.Context, info RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoKey{}, info)
+}
+
+// RunFromContext 获取 context 中的运行信息
+func RunFromContext(ctx context.Context) (RunInfo, bool) {
+	info, ok := ctx.Value(runInfoKey{}).(RunInfo)
+	return info, ok
+}
+
+// attributes 返回非空的运行属性
+func (r RunInfo) attributes() map[string]any {
+	attrs := make(map[string]any, 4)
+	if r.RunID != "" {
+		attrs[AttrPipelineRunID] = r.RunID
+	}
+	if r.SessionID != "" {
+		attrs[AttrTraceSessionID] = r.SessionID
+	}
+	if r.UserID != "" {
+		attrs[AttrTraceUserID] = r.UserID
+	}
+	if len(r.Tags) > 0 {
+		attrs[AttrTraceTags] = r.Tags
+	}
+	return attrs
+}
+
+// applyRunAttributes 将 ctx 中的运行属性补充到 span 配置，显式设置的属性优先
+func applyRunAttributes(ctx context.Context, cfg *SpanConfig) {
+	info, ok := RunFromContext(ctx)
+	if !ok {
+		return
+	}
+	for k, v := range info.attributes() {
+		if _, set := cfg.Attributes[k]; set {
+			continue
+		}
+		if cfg.Attributes == nil {
+			cfg.Attributes = make(map[string]any)
+		}
+		cfg.Attributes[k] = v
+	}
+}
+
+// ContextWithSpan 将 src 中的当前 span（及运行信息）转移到 dst
+// 用于在框架提供的 context 中继续传递 span，例如让工具调用携带 traceparent
+func ContextWithSpan(dst, src context.Context) context.Context {
+	if span := trace.SpanFromContext(src); span.SpanContext().IsValid() {
+		dst = trace.ContextWithSpan(dst, span)
+	}
+	if st, ok := src.Value(fanoutKey{}).(*fanoutState); ok {
+		dst = context.WithValue(dst, fanoutKey{}, st)
+	}
+	if _, ok := RunFromContext(dst); !ok {
+		if info, ok := RunFromContext(src); ok {
+			dst = WithRun(dst, info)
+		}
+	}
+	return dst
+}
+
+// propagator W3C Trace Context（traceparent / tracestate）
+var propagator = propagation.TraceContext{}
+
+// InjectTraceContext 将 ctx 中当前 span 以 W3C traceparent 写入 HTTP 头
+// ctx 中没有有效 span 时不做任何修改
+func InjectTraceContext(ctx context.Context, header http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,66 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWithRun_SpansInheritRunAttributes(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := NewJSON(&buf, "test")
+
+	ctx := WithRun(context.Background(), RunInfo{RunID: "run-7", SessionID: "sess-1", UserID: "alice", Tags: []string{"nightly"}})
+	ctx, root := tracer.StartSpan(ctx, "pipeline")
+	_, child := tracer.StartSpan(ctx, "step", WithAttributes(map[string]any{AttrTraceUserID: "bob"}))
+	child.End()
+	root.End()
+
+	spans := decodeSpans(t, buf.Bytes())
+	for _, s := range spans {
+		if s.Attributes[AttrPipelineRunID] != "run-7" || s.Attributes[AttrTraceSessionID] != "sess-1" {
+			t.Errorf("%s missing run attributes: %v", s.Name, s.Attributes)
+		}
+		if tags, _ := s.Attributes[AttrTraceTags].([]any); len(tags) != 1 || tags[0] != "nightly" {
+			t.Errorf("%s missing tags: %v", s.Name, s.Attributes[AttrTraceTags])
+		}
+	}
+	if spans[0].Attributes[AttrTraceUserID] != "bob" || spans[1].Attributes[AttrTraceUserID] != "alice" {
+		t.Errorf("explicit attributes should win over run attributes")
+	}
+}
+
+func TestContextWithSpan_InjectsTraceparent(t *testing.T) {
+	var buf bytes.Buffer
+	tracer := Fanout(NewJSON(&buf, "a"), NewJSON(&bytes.Buffer{}, "b"))
+
+	spanCtx, span := tracer.StartSpan(WithRun(context.Background(), RunInfo{RunID: "r"}), "tool")
+	ctx := ContextWithSpan(context.Background(), spanCtx)
+
+	header := http.Header{}
+	InjectTraceContext(ctx, header)
+	span.End()
+
+	traceID := decodeSpans(t, buf.Bytes())[0].TraceID
+	if tp := header.Get("traceparent"); !strings.HasPrefix(tp, "00-"+traceID+"-") {
+		t.Fatalf("unexpected traceparent %q for trace %s", tp, traceID)
+	}
+	if info, ok := RunFromContext(ctx); !ok || info.RunID != "r" {
+		t.Fatal("run info not transferred")
+	}
+
+	// 子 span 仍按后端分别挂到各自的父 span 下
+	_, child := tracer.StartSpan(ctx, "child")
+	child.End()
+	if spans := decodeSpans(t, buf.Bytes()); spans[1].ParentSpanID != spans[0].SpanID {
+		t.Fatal("child started from transferred context not nested")
+	}
+
+	empty := http.Header{}
+	InjectTraceContext(context.Background(), empty)
+	if len(empty) != 0 {
+		t.Fatalf("no span should inject nothing, got %v", empty)
+	}
+}
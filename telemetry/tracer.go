@@ -26,9 +26,12 @@ type Span interface {
 	// SetStatus 设置 span 状态
 	SetStatus(status Status, description string)
 
-	// RecordError 记录错误
+	// RecordError 记录错误（异常事件），并将 span 状态置为错误
 	RecordError(err error)
 
+	// AddEvent 在 span 上记录一个带属性的事件
+	AddEvent(name string, attrs ...Attribute)
+
 	// End 结束 span
 	End()
 }
@@ -38,6 +41,7 @@ type SpanOption func(*SpanConfig)
 
 type SpanConfig struct {
 	Attributes map[string]any
+	Links      []Span
 }
 
 // Attribute 追踪属性
@@ -66,3 +70,11 @@ func WithAttributes(attrs map[string]any) SpanOption {
 		maps.Copy(cfg.Attributes, attrs)
 	}
 }
+
+// WithLinks 将新 span 关联到其他 span（如同一步骤的上一次尝试）
+// 链接不建立父子关系，可跨 trace
+func WithLinks(spans ...Span) SpanOption {
+	return func(cfg *SpanConfig) {
+		cfg.Links = append(cfg.Links, spans...)
+	}
+}
@@ -1,26 +1,35 @@
 package token
 
 import (
+	"encoding/json"
+	"strings"
 	"sync"
 	"time"
 
 	"trpc.group/trpc-go/trpc-agent-go/event"
+	"trpc.group/trpc-go/trpc-agent-go/graph"
 )
 
 // TokenUsage represents token usage for a single LLM invocation.
 type TokenUsage struct {
 	TurnNumber       int           `json:"turnNumber"`
+	InvocationID     string        `json:"invocationId,omitempty"`
+	StepID           string        `json:"stepId,omitempty"`
+	NodeType         string        `json:"nodeType,omitempty"`
 	PromptTokens     int           `json:"promptTokens"`
 	CompletionTokens int           `json:"completionTokens"`
 	TotalTokens      int           `json:"totalTokens"`
 	Model            string        `json:"model"`
+	Cost             float64       `json:"cost,omitempty"` // estimated from the monitor's pricing
 	Timestamp        time.Time     `json:"timestamp"`
 	Duration         time.Duration `json:"duration,omitempty"`
 }
 
 const maxUsageHistory = 1000
 
-// Monitor tracks cumulative token usage across pipeline steps.
+// Monitor tracks cumulative billed token usage across pipeline steps, and
+// separately the current context occupancy (the prompt size of the latest LLM
+// call) against the context window.
 // It implements pipeline.TokenObserver via the OnCompression method.
 type Monitor struct {
 	mu                    sync.RWMutex
@@ -31,37 +40,101 @@ type Monitor struct {
 	turnCount             int
 	usageHistory          []TokenUsage
 	warningThreshold      float64
-	pendingUpdate         bool // set by OnCompression, cleared by translator after push
+	pendingUpdate         bool                    // set by OnCompression, cleared by translator after push
+	contextTokens         int                     // prompt size of the latest LLM call
+	contexts              map[string]ContextUsage // latest context per step
+	currentStep           string                  // step of the latest LLM call
+	pricing               Pricing
+	totalCost             float64
+	byStep                map[string]*UsageAggregate
+	byModel               map[string]*UsageAggregate
+	onRecord              func(TokenUsage) // optional, from WithRecordHook
+}
+
+// MonitorOption configures a Monitor.
+type MonitorOption func(*Monitor)
+
+// WithPricing sets the pricing table used to estimate the cost of each
+// recorded usage.
+func WithPricing(p Pricing) MonitorOption {
+	return func(tm *Monitor) { tm.pricing = p }
+}
+
+// WithRecordHook calls fn with every recorded usage, turn number and cost
+// filled in, outside the monitor's lock. History and Report keep only the most
+// recent 1000 records; use the hook to persist all of them (e.g.
+// storage.UsageRecorder).
+func WithRecordHook(fn func(TokenUsage)) MonitorOption {
+	return func(tm *Monitor) { tm.onRecord = fn }
 }
 
 // NewMonitor creates a new token monitor with the given context-window size.
-func NewMonitor(maxTokens int) *Monitor {
-	return &Monitor{
+func NewMonitor(maxTokens int, opts ...MonitorOption) *Monitor {
+	tm := &Monitor{
 		maxTokens:        maxTokens,
 		usageHistory:     make([]TokenUsage, 0),
 		warningThreshold: 0.8,
+		byStep:           make(map[string]*UsageAggregate),
+		byModel:          make(map[string]*UsageAggregate),
+		contexts:         make(map[string]ContextUsage),
+	}
+	for _, opt := range opts {
+		opt(tm)
 	}
+	return tm
 }
 
-// RecordUsage adds a single-turn usage record.
+// RecordUsage adds a single-turn usage record. Its cost is estimated from
+// the pricing table unless already set.
 func (tm *Monitor) RecordUsage(usage TokenUsage) {
+	tm.record(usage)
+}
+
+// record stores usage and returns it with turn number and cost filled in.
+func (tm *Monitor) record(usage TokenUsage) TokenUsage {
+	usage = tm.store(usage)
+	if tm.onRecord != nil {
+		tm.onRecord(usage)
+	}
+	return usage
+}
+
+func (tm *Monitor) store(usage TokenUsage) TokenUsage {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	if usage.Cost == 0 && tm.pricing != nil {
+		usage.Cost = tm.pricing.Cost(usage)
+	}
 	tm.totalPromptTokens += usage.PromptTokens
 	tm.totalCompletionTokens += usage.CompletionTokens
 	tm.totalTokens += usage.TotalTokens
+	tm.totalCost += usage.Cost
 	tm.turnCount++
 	usage.TurnNumber = tm.turnCount
 	tm.usageHistory = append(tm.usageHistory, usage)
+	aggregate(tm.byStep, usage.StepID, usage)
+	aggregate(tm.byModel, usage.Model, usage)
+
+	tm.contextTokens = usage.PromptTokens
+	tm.currentStep = usage.StepID
+	tm.contexts[usage.StepID] = ContextUsage{
+		StepID:       usage.StepID,
+		InvocationID: usage.InvocationID,
+		PromptTokens: usage.PromptTokens,
+		UpdatedAt:    time.Now(),
+	}
 
 	if len(tm.usageHistory) > maxUsageHistory {
 		tm.usageHistory = tm.usageHistory[len(tm.usageHistory)-maxUsageHistory:]
 	}
+	return usage
 }
 
 // ProcessEvent extracts token usage from a trpc-agent-go event and records it.
-// Returns the recorded TokenUsage (zero value if no usage found).
+// Graph LLM nodes author their events with the node ID, which is the step ID
+// in pipeline flows. Returns the recorded TokenUsage (zero value if no usage
+// found).
 func (tm *Monitor) ProcessEvent(evt *event.Event) TokenUsage {
 	if evt == nil || evt.Response == nil || evt.Response.Usage == nil {
 		return TokenUsage{}
@@ -72,86 +145,137 @@ func (tm *Monitor) ProcessEvent(evt *event.Event) TokenUsage {
 		CompletionTokens: evt.Response.Usage.CompletionTokens,
 		TotalTokens:      evt.Response.Usage.TotalTokens,
 		Model:            evt.Response.Model,
+		InvocationID:     evt.InvocationID,
 		Timestamp:        time.Now(),
 	}
+	usage.StepID, usage.NodeType = eventNode(evt)
 
-	tm.RecordUsage(usage)
-	return usage
+	return tm.record(usage)
+}
+
+// eventNode returns the node ID and type an event was emitted by. Usage is
+// only reported by model calls, so nodes without execution metadata are LLM
+// nodes.
+func eventNode(evt *event.Event) (string, string) {
+	if raw, ok := evt.StateDelta[graph.MetadataKeyNode]; ok {
+		var meta graph.NodeExecutionMetadata
+		if json.Unmarshal(raw, &meta) == nil && meta.NodeID != "" {
+			return meta.NodeID, string(meta.NodeType)
+		}
+	}
+	if evt.Author == "" || strings.HasPrefix(evt.Author, "graph-") {
+		return "", ""
+	}
+	return evt.Author, string(graph.NodeTypeLLM)
 }
 
-// GetStats returns a snapshot of cumulative statistics.
-func (tm *Monitor) GetStats() map[string]any {
+// ContextUsage is the context occupancy of a node: the prompt size of its
+// latest LLM call.
+type ContextUsage struct {
+	StepID       string    `json:"stepId"`
+	InvocationID string    `json:"invocationId,omitempty"`
+	PromptTokens int       `json:"promptTokens"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// Stats is a snapshot of a Monitor. Billed usage is cumulative and never
+// reduced by compression; context occupancy is the prompt size of the latest
+// LLM call, compared against the context window.
+type Stats struct {
+	// Cumulative billed usage.
+	TotalPromptTokens     int     `json:"totalPromptTokens"`
+	TotalCompletionTokens int     `json:"totalCompletionTokens"`
+	TotalTokens           int     `json:"totalTokens"`
+	TotalCost             float64 `json:"totalCost"`
+	TurnCount             int     `json:"turnCount"`
+	AvgPromptTokens       int     `json:"avgPromptTokens"`
+	AvgCompletionTokens   int     `json:"avgCompletionTokens"`
+	AvgTotalTokens        int     `json:"avgTotalTokens"`
+
+	// Context occupancy.
+	MaxTokens       int                     `json:"maxTokens"`       // context window
+	ContextTokens   int                     `json:"contextTokens"`   // current prompt size
+	RemainingTokens int                     `json:"remainingTokens"` // MaxTokens - ContextTokens
+	UsagePercent    float64                 `json:"usagePercent"`    // ContextTokens relative to MaxTokens
+	Contexts        map[string]ContextUsage `json:"contexts"`        // latest per node (step)
+	// EstimatedRemainingTurns is a rough estimate assuming each turn grows
+	// the context by the average completion size.
+	EstimatedRemainingTurns int `json:"estimatedRemainingTurns,omitempty"`
+}
+
+// GetStats returns a snapshot of billed usage and context occupancy.
+func (tm *Monitor) GetStats() Stats {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
 
-	remaining := tm.maxTokens - tm.totalTokens
-	usagePercent := 0.0
-	if tm.maxTokens > 0 {
-		usagePercent = float64(tm.totalTokens) / float64(tm.maxTokens) * 100
+	stats := Stats{
+		TotalPromptTokens:     tm.totalPromptTokens,
+		TotalCompletionTokens: tm.totalCompletionTokens,
+		TotalTokens:           tm.totalTokens,
+		TotalCost:             tm.totalCost,
+		TurnCount:             tm.turnCount,
+		MaxTokens:             tm.maxTokens,
+		ContextTokens:         tm.contextTokens,
+		RemainingTokens:       tm.maxTokens - tm.contextTokens,
+		Contexts:              make(map[string]ContextUsage, len(tm.contexts)),
 	}
-
-	stats := map[string]any{
-		"maxTokens":             tm.maxTokens,
-		"totalPromptTokens":     tm.totalPromptTokens,
-		"totalCompletionTokens": tm.totalCompletionTokens,
-		"totalTokens":           tm.totalTokens,
-		"remainingTokens":       remaining,
-		"usagePercent":          usagePercent,
-		"turnCount":             tm.turnCount,
+	for k, v := range tm.contexts {
+		stats.Contexts[k] = v
+	}
+	if tm.maxTokens > 0 {
+		stats.UsagePercent = float64(tm.contextTokens) / float64(tm.maxTokens) * 100
 	}
-
 	if tm.turnCount > 0 {
-		stats["avgPromptTokens"] = tm.totalPromptTokens / tm.turnCount
-		stats["avgCompletionTokens"] = tm.totalCompletionTokens / tm.turnCount
-		stats["avgTotalTokens"] = tm.totalTokens / tm.turnCount
-		avgTotal := tm.totalTokens / tm.turnCount
-		if avgTotal > 0 {
-			stats["estimatedRemainingTurns"] = remaining / avgTotal
+		stats.AvgPromptTokens = tm.totalPromptTokens / tm.turnCount
+		stats.AvgCompletionTokens = tm.totalCompletionTokens / tm.turnCount
+		stats.AvgTotalTokens = tm.totalTokens / tm.turnCount
+		if stats.AvgCompletionTokens > 0 && stats.RemainingTokens > 0 {
+			stats.EstimatedRemainingTurns = stats.RemainingTokens / stats.AvgCompletionTokens
 		}
 	}
-
 	return stats
 }
 
-// IsWarning returns true when usage exceeds the warning threshold.
+// contextRatio returns the context occupancy relative to the window.
+// Callers must hold tm.mu.
+func (tm *Monitor) contextRatio() float64 {
+	if tm.maxTokens <= 0 {
+		return 0
+	}
+	return float64(tm.contextTokens) / float64(tm.maxTokens)
+}
+
+// IsWarning returns true when the context occupancy exceeds the warning threshold.
 func (tm *Monitor) IsWarning() bool {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
-	if tm.maxTokens <= 0 {
-		return false
-	}
-	return float64(tm.totalTokens)/float64(tm.maxTokens) >= tm.warningThreshold
+	return tm.maxTokens > 0 && tm.contextRatio() >= tm.warningThreshold
 }
 
-// IsCritical returns true when usage exceeds 95%.
+// IsCritical returns true when the context occupancy exceeds 95%.
 func (tm *Monitor) IsCritical() bool {
 	tm.mu.RLock()
 	defer tm.mu.RUnlock()
-	if tm.maxTokens <= 0 {
-		return false
-	}
-	return float64(tm.totalTokens)/float64(tm.maxTokens) >= 0.95
+	return tm.maxTokens > 0 && tm.contextRatio() >= 0.95
 }
 
 // OnCompression implements pipeline.TokenObserver.
-// It adjusts the cumulative token counts to reflect the compressed context size
-// and marks a pending update so the translator pushes refreshed stats to the frontend.
+// It lowers the current context occupancy to the compressed size and marks a
+// pending update so the translator pushes refreshed stats to the frontend.
+// Billed usage is unchanged: the tokens were already spent.
 func (tm *Monitor) OnCompression(beforeTokens, afterTokens int) {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
-	saved := beforeTokens - afterTokens
-	if saved <= 0 {
+	if beforeTokens-afterTokens <= 0 {
 		return
 	}
 
-	tm.totalPromptTokens -= saved
-	if tm.totalPromptTokens < 0 {
-		tm.totalPromptTokens = 0
-	}
-	tm.totalTokens -= saved
-	if tm.totalTokens < 0 {
-		tm.totalTokens = 0
+	tm.contextTokens = afterTokens
+	if c, ok := tm.contexts[tm.currentStep]; ok {
+		c.PromptTokens = afterTokens
+		c.UpdatedAt = time.Now()
+		tm.contexts[tm.currentStep] = c
 	}
 	tm.pendingUpdate = true
 }
@@ -175,6 +299,12 @@ func (tm *Monitor) Reset() {
 	tm.totalPromptTokens = 0
 	tm.totalCompletionTokens = 0
 	tm.totalTokens = 0
+	tm.totalCost = 0
+	tm.contextTokens = 0
+	tm.contexts = make(map[string]ContextUsage)
+	tm.currentStep = ""
 	tm.turnCount = 0
 	tm.usageHistory = make([]TokenUsage, 0)
+	tm.byStep = make(map[string]*UsageAggregate)
+	tm.byModel = make(map[string]*UsageAggregate)
 }
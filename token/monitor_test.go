@@ -9,11 +9,35 @@ func TestMonitor_RecordUsage(t *testing.T) {
 	m.RecordUsage(TokenUsage{PromptTokens: 100, CompletionTokens: 50, TotalTokens: 150})
 
 	stats := m.GetStats()
-	if stats["totalTokens"] != 150 {
-		t.Fatalf("expected totalTokens=150, got %v", stats["totalTokens"])
+	if stats.TotalTokens != 150 {
+		t.Fatalf("expected totalTokens=150, got %v", stats.TotalTokens)
 	}
-	if stats["turnCount"] != 1 {
-		t.Fatalf("expected turnCount=1, got %v", stats["turnCount"])
+	if stats.TurnCount != 1 {
+		t.Fatalf("expected turnCount=1, got %v", stats.TurnCount)
+	}
+	if stats.ContextTokens != 100 {
+		t.Fatalf("expected contextTokens=100, got %v", stats.ContextTokens)
+	}
+}
+
+func TestMonitor_ContextTracksLatestPrompt(t *testing.T) {
+	m := NewMonitor(10000)
+	m.RecordUsage(TokenUsage{StepID: "1.1", InvocationID: "inv-1", PromptTokens: 3000, CompletionTokens: 500, TotalTokens: 3500})
+	m.RecordUsage(TokenUsage{StepID: "1.1", InvocationID: "inv-1", PromptTokens: 4000, CompletionTokens: 500, TotalTokens: 4500})
+	m.RecordUsage(TokenUsage{StepID: "2.1", InvocationID: "inv-1", PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100})
+
+	stats := m.GetStats()
+	if stats.TotalTokens != 9100 {
+		t.Fatalf("expected cumulative totalTokens=9100, got %d", stats.TotalTokens)
+	}
+	if stats.ContextTokens != 1000 || stats.RemainingTokens != 9000 || stats.UsagePercent != 10 {
+		t.Fatalf("expected context of the latest call, got %+v", stats)
+	}
+	if c := stats.Contexts["1.1"]; c.PromptTokens != 4000 || c.InvocationID != "inv-1" {
+		t.Fatalf("expected latest context of step 1.1, got %+v", c)
+	}
+	if m.IsWarning() {
+		t.Fatal("cumulative usage over the window should not warn")
 	}
 }
 
@@ -24,13 +48,11 @@ func TestMonitor_OnCompression(t *testing.T) {
 	m.OnCompression(5000, 2000) // saved 3000
 
 	stats := m.GetStats()
-	totalTokens, _ := stats["totalTokens"].(int)
-	if totalTokens != 3000 {
-		t.Fatalf("expected totalTokens=3000 after compression, got %d", totalTokens)
+	if stats.ContextTokens != 2000 {
+		t.Fatalf("expected contextTokens=2000 after compression, got %d", stats.ContextTokens)
 	}
-	promptTokens, _ := stats["totalPromptTokens"].(int)
-	if promptTokens != 2000 {
-		t.Fatalf("expected totalPromptTokens=2000 after compression, got %d", promptTokens)
+	if stats.TotalTokens != 6000 || stats.TotalPromptTokens != 5000 {
+		t.Fatalf("billed usage should not change on compression, got %+v", stats)
 	}
 }
 
@@ -52,10 +74,10 @@ func TestMonitor_DrainPendingUpdate(t *testing.T) {
 
 func TestMonitor_IsWarning(t *testing.T) {
 	m := NewMonitor(1000)
-	m.RecordUsage(TokenUsage{PromptTokens: 700, CompletionTokens: 100, TotalTokens: 800})
+	m.RecordUsage(TokenUsage{PromptTokens: 800, CompletionTokens: 100, TotalTokens: 900})
 
 	if !m.IsWarning() {
-		t.Fatal("expected warning at 80% usage")
+		t.Fatal("expected warning at 80% context usage")
 	}
 
 	m2 := NewMonitor(1000)
@@ -67,10 +89,10 @@ func TestMonitor_IsWarning(t *testing.T) {
 
 func TestMonitor_IsCritical(t *testing.T) {
 	m := NewMonitor(1000)
-	m.RecordUsage(TokenUsage{PromptTokens: 900, CompletionTokens: 60, TotalTokens: 960})
+	m.RecordUsage(TokenUsage{PromptTokens: 960, CompletionTokens: 60, TotalTokens: 1020})
 
 	if !m.IsCritical() {
-		t.Fatal("expected critical at 96% usage")
+		t.Fatal("expected critical at 96% context usage")
 	}
 }
 
@@ -95,11 +117,14 @@ func TestMonitor_Reset(t *testing.T) {
 	m.Reset()
 
 	stats := m.GetStats()
-	if stats["totalTokens"] != 0 {
-		t.Fatalf("expected totalTokens=0 after reset, got %v", stats["totalTokens"])
+	if stats.TotalTokens != 0 {
+		t.Fatalf("expected totalTokens=0 after reset, got %v", stats.TotalTokens)
+	}
+	if stats.TurnCount != 0 {
+		t.Fatalf("expected turnCount=0 after reset, got %v", stats.TurnCount)
 	}
-	if stats["turnCount"] != 0 {
-		t.Fatalf("expected turnCount=0 after reset, got %v", stats["turnCount"])
+	if stats.ContextTokens != 0 || len(stats.Contexts) != 0 {
+		t.Fatalf("expected no context after reset, got %+v", stats)
 	}
 }
 
@@ -0,0 +1,60 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is the cost of a model in currency units per million tokens.
+type Price struct {
+	InputPerMillion  float64 `json:"input"`
+	OutputPerMillion float64 `json:"output"`
+}
+
+// Pricing maps model names to prices. A key also matches model names it is
+// a prefix of (e.g. "gpt-4o" matches "gpt-4o-2024-08-06"); the longest
+// matching key wins.
+type Pricing map[string]Price
+
+// LoadPricing reads a pricing table from a JSON file of the form
+// {"model": {"input": 2.5, "output": 10}}.
+func LoadPricing(path string) (Pricing, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pricing file: %w", err)
+	}
+	var p Pricing
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse pricing file: %w", err)
+	}
+	return p, nil
+}
+
+// Lookup returns the price of model.
+func (p Pricing) Lookup(model string) (Price, bool) {
+	if price, ok := p[model]; ok {
+		return price, true
+	}
+	var best string
+	for key := range p {
+		if strings.HasPrefix(model, key) && len(key) > len(best) {
+			best = key
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return p[best], true
+}
+
+// Cost estimates the cost of a usage record. Models without a price cost 0.
+func (p Pricing) Cost(usage TokenUsage) float64 {
+	price, ok := p.Lookup(usage.Model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.InputPerMillion +
+		float64(usage.CompletionTokens)*price.OutputPerMillion) / 1e6
+}
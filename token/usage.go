@@ -0,0 +1,173 @@
+package token
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// UsageAggregate sums the usage of several LLM invocations.
+type UsageAggregate struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"promptTokens"`
+	CompletionTokens int     `json:"completionTokens"`
+	TotalTokens      int     `json:"totalTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+func (a *UsageAggregate) add(u TokenUsage) {
+	a.Calls++
+	a.PromptTokens += u.PromptTokens
+	a.CompletionTokens += u.CompletionTokens
+	a.TotalTokens += u.TotalTokens
+	a.Cost += u.Cost
+}
+
+// aggregate adds u to the aggregate of key. Usage without a key (e.g. no
+// step attribution) is not aggregated.
+func aggregate(m map[string]*UsageAggregate, key string, u TokenUsage) {
+	if key == "" {
+		return
+	}
+	a := m[key]
+	if a == nil {
+		a = &UsageAggregate{}
+		m[key] = a
+	}
+	a.add(u)
+}
+
+// UsageReport is a snapshot of all recorded usage, suitable for comparing
+// pipeline variants.
+type UsageReport struct {
+	Total   UsageAggregate            `json:"total"`
+	ByStep  map[string]UsageAggregate `json:"byStep"`
+	ByModel map[string]UsageAggregate `json:"byModel"`
+	Records []TokenUsage              `json:"records"` // the most recent 1000 invocations
+}
+
+// UsageByStep returns the usage aggregated by step ID.
+func (tm *Monitor) UsageByStep() map[string]UsageAggregate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return snapshot(tm.byStep)
+}
+
+// UsageByModel returns the usage aggregated by model name.
+func (tm *Monitor) UsageByModel() map[string]UsageAggregate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return snapshot(tm.byModel)
+}
+
+// StepUsage returns the usage aggregated for one step.
+func (tm *Monitor) StepUsage(stepID string) UsageAggregate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	if a := tm.byStep[stepID]; a != nil {
+		return *a
+	}
+	return UsageAggregate{}
+}
+
+// Total returns the usage aggregated over all records. Unlike Report it
+// copies no records, so it is cheap enough to call on every LLM call.
+func (tm *Monitor) Total() UsageAggregate {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.total()
+}
+
+// total returns the overall aggregate. Callers must hold tm.mu.
+func (tm *Monitor) total() UsageAggregate {
+	return UsageAggregate{
+		Calls:            tm.turnCount,
+		PromptTokens:     tm.totalPromptTokens,
+		CompletionTokens: tm.totalCompletionTokens,
+		TotalTokens:      tm.totalTokens,
+		Cost:             tm.totalCost,
+	}
+}
+
+// TotalCost returns the estimated cost of all recorded usage.
+func (tm *Monitor) TotalCost() float64 {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.totalCost
+}
+
+// History returns a copy of the most recent usage records.
+func (tm *Monitor) History() []TokenUsage {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return append([]TokenUsage(nil), tm.usageHistory...)
+}
+
+// Report returns a snapshot of totals, aggregates and records.
+func (tm *Monitor) Report() UsageReport {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return UsageReport{
+		Total:   tm.total(),
+		ByStep:  snapshot(tm.byStep),
+		ByModel: snapshot(tm.byModel),
+		Records: append([]TokenUsage(nil), tm.usageHistory...),
+	}
+}
+
+func snapshot(m map[string]*UsageAggregate) map[string]UsageAggregate {
+	out := make(map[string]UsageAggregate, len(m))
+	for k, v := range m {
+		out[k] = *v
+	}
+	return out
+}
+
+// WriteJSON writes the usage report as indented JSON.
+func (tm *Monitor) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(tm.Report()); err != nil {
+		return fmt.Errorf("failed to write usage report: %w", err)
+	}
+	return nil
+}
+
+// csvHeader is the column order of WriteCSV.
+var csvHeader = []string{
+	"turn", "timestamp", "step", "node_type", "model",
+	"prompt_tokens", "completion_tokens", "total_tokens", "cost", "duration_ms",
+}
+
+// WriteCSV writes one row per usage record.
+func (tm *Monitor) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return fmt.Errorf("failed to write usage csv: %w", err)
+	}
+	for _, u := range tm.History() {
+		row := []string{
+			strconv.Itoa(u.TurnNumber),
+			u.Timestamp.Format(time.RFC3339),
+			u.StepID,
+			u.NodeType,
+			u.Model,
+			strconv.Itoa(u.PromptTokens),
+			strconv.Itoa(u.CompletionTokens),
+			strconv.Itoa(u.TotalTokens),
+			strconv.FormatFloat(u.Cost, 'f', -1, 64),
+			strconv.FormatInt(u.Duration.Milliseconds(), 10),
+		}
+		if err := cw.Write(row); err != nil {
+			return fmt.Errorf("failed to write usage csv: %w", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("failed to write usage csv: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package token
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"trpc.group/trpc-go/trpc-agent-go/event"
+	"trpc.group/trpc-go/trpc-agent-go/model"
+)
+
+var testPricing = Pricing{
+	"gpt-4o":      {InputPerMillion: 2.5, OutputPerMillion: 10},
+	"gpt-4o-mini": {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+}
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestPricing_Lookup(t *testing.T) {
+	if p, ok := testPricing.Lookup("gpt-4o-mini-2024-07-18"); !ok || p.InputPerMillion != 0.15 {
+		t.Errorf("expected longest prefix match, got %+v", p)
+	}
+	if _, ok := testPricing.Lookup("claude"); ok {
+		t.Error("unknown model should have no price")
+	}
+	cost := testPricing.Cost(TokenUsage{Model: "gpt-4o", PromptTokens: 1_000_000, CompletionTokens: 100_000})
+	if !approx(cost, 3.5) {
+		t.Errorf("expected cost 3.5, got %v", cost)
+	}
+}
+
+func TestMonitor_AggregatesByStepAndModel(t *testing.T) {
+	m := NewMonitor(100000, WithPricing(testPricing))
+	m.RecordUsage(TokenUsage{StepID: "1.1", Model: "gpt-4o", PromptTokens: 1000, CompletionTokens: 100, TotalTokens: 1100})
+	m.RecordUsage(TokenUsage{StepID: "1.1", Model: "gpt-4o-mini", PromptTokens: 2000, CompletionTokens: 200, TotalTokens: 2200})
+	m.RecordUsage(TokenUsage{StepID: "2.1", Model: "gpt-4o", PromptTokens: 500, CompletionTokens: 50, TotalTokens: 550})
+
+	byStep := m.UsageByStep()
+	if s := byStep["1.1"]; s.Calls != 2 || s.TotalTokens != 3300 {
+		t.Errorf("unexpected step aggregate: %+v", s)
+	}
+	byModel := m.UsageByModel()
+	if g := byModel["gpt-4o"]; g.Calls != 2 || g.PromptTokens != 1500 || !approx(g.Cost, 0.00525) {
+		t.Errorf("unexpected model aggregate: %+v", g)
+	}
+	total := byModel["gpt-4o"].Cost + byModel["gpt-4o-mini"].Cost
+	if !approx(m.TotalCost(), total) || m.GetStats().TotalCost != m.TotalCost() {
+		t.Errorf("total cost %v does not match aggregates %v", m.TotalCost(), total)
+	}
+	if m.StepUsage("1.1") != byStep["1.1"] || m.StepUsage("9.9") != (UsageAggregate{}) || m.Total() != m.Report().Total {
+		t.Errorf("unexpected accessors: step %+v total %+v", m.StepUsage("1.1"), m.Total())
+	}
+
+	m.Reset()
+	if len(m.UsageByStep()) != 0 || m.TotalCost() != 0 {
+		t.Error("reset should clear aggregates")
+	}
+}
+
+func TestMonitor_ProcessEventAttributesStep(t *testing.T) {
+	m := NewMonitor(100000, WithPricing(testPricing))
+	evt := event.New("inv-1", "3.1", event.WithResponse(&model.Response{
+		Model: "gpt-4o",
+		Usage: &model.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110},
+	}))
+
+	u := m.ProcessEvent(evt)
+	if u.StepID != "3.1" || u.NodeType != "llm" || u.TurnNumber != 1 || u.Cost == 0 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestMonitor_Export(t *testing.T) {
+	m := NewMonitor(100000, WithPricing(testPricing))
+	m.RecordUsage(TokenUsage{StepID: "1.1", NodeType: "llm", Model: "gpt-4o", PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15})
+
+	var jsonBuf bytes.Buffer
+	if err := m.WriteJSON(&jsonBuf); err != nil {
+		t.Fatal(err)
+	}
+	var report UsageReport
+	if err := json.Unmarshal(jsonBuf.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Total.Calls != 1 || report.ByStep["1.1"].TotalTokens != 15 || len(report.Records) != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	var csvBuf bytes.Buffer
+	if err := m.WriteCSV(&csvBuf); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&csvBuf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[1][2] != "1.1" || rows[1][4] != "gpt-4o" || rows[1][7] != "15" {
+		t.Errorf("unexpected csv: %v", rows)
+	}
+}